@@ -0,0 +1,91 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [name]",
+	Short: "Archive the workspace home to an Object Storage bucket",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			backup, err := o.Backup(ctx, opts, name)
+			if err != nil {
+				return errors.Wrap(err, "backup")
+			}
+
+			fmt.Println(backup.Object)
+			return nil
+		})
+	},
+}
+
+// backupListCmd represents the backup list command
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backups of the workspace in the bucket",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMachine(cmd, false, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			backups, err := o.ListBackups(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "list backups")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "OBJECT\tCREATED\tSIZE (MB)")
+			for _, b := range backups {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", b.Object, b.Created.Format("2006-01-02 15:04:05"), b.Size>>20)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup>",
+	Short: "Unpack a backup from the bucket over the workspace home",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			return errors.Wrap(o.RestoreBackup(ctx, opts, args[0]), "restore")
+		})
+	},
+}
+
+func init() {
+	backupCmd.AddCommand(backupListCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// bakeImageCmd represents the bake-image command
+var bakeImageCmd = &cobra.Command{
+	Use:   "bake-image [name]",
+	Short: "Create a custom image from a running instance to use as DISK_IMAGE",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			image, err := o.BakeImage(ctx, opts, name)
+			if err != nil {
+				return errors.Wrap(err, "bake image")
+			}
+
+			fmt.Printf("%s\t%s\n", *image.DisplayName, *image.Id)
+			return nil
+		})
+	},
+}
+
+func init() {
+	bakeImageCmd.Flags().Bool("no-wait", false, "Return without waiting for the image to be available")
+	rootCmd.AddCommand(bakeImageCmd)
+}
@@ -22,10 +22,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -35,55 +34,40 @@ var commandCmd = &cobra.Command{
 	Use:   "command",
 	Short: "Run a command on an instance",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		opts, err := options.FromEnv(false)
-		if err != nil {
-			return err
-		}
-
-		ctx := context.Background()
-		
-		configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-		if err != nil {
-			return err
-		}
-
-		o, err := oracle.NewOracle(configProvider)
-		if err != nil {
-			return err
-		}
-
-		// Get instance IP
-		ip, err := o.GetInstanceIP(ctx, opts.MachineID)
-		if err != nil {
-			return errors.Wrap(err, "get instance IP")
-		}
+		return withMachine(cmd, false, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			// Get instance IP
+			ip, err := o.GetInstanceIP(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "get instance IP")
+			}
 
-		// Get command
-		command := os.Getenv("COMMAND")
-		if command == "" {
-			return fmt.Errorf("COMMAND environment variable is not set")
-		}
+			// Get command
+			command := os.Getenv("COMMAND")
+			if command == "" {
+				return fmt.Errorf("COMMAND environment variable is not set")
+			}
 
-		// Get SSH key
-		keyDir := filepath.Join(opts.MachineFolder, ".ssh")
-		privateKeyPath := filepath.Join(keyDir, "id_rsa")
+			// Get SSH key
+			keyDir := filepath.Join(opts.MachineFolder, ".ssh")
+			privateKeyPath := filepath.Join(keyDir, "id_rsa")
 
-		// Build SSH command
-		sshArgs := []string{
-			"-o", "StrictHostKeyChecking=no",
-			"-o", "UserKnownHostsFile=/dev/null",
-			"-i", privateKeyPath,
-			fmt.Sprintf("devpod@%s", ip),
-			command,
-		}
+			// Build SSH command
+			sshArgs := []string{
+				"-o", "StrictHostKeyChecking=no",
+				"-o", "UserKnownHostsFile=/dev/null",
+				"-i", privateKeyPath,
+				fmt.Sprintf("devpod@%s", ip),
+				command,
+			}
 
-		// Execute SSH command
-		sshCmd := exec.Command("ssh", sshArgs...)
-		sshCmd.Stdin = os.Stdin
-		sshCmd.Stdout = os.Stdout
-		sshCmd.Stderr = os.Stderr
+			// Execute SSH command
+			sshCmd := exec.Command("ssh", sshArgs...)
+			sshCmd.Stdin = os.Stdin
+			sshCmd.Stdout = os.Stdout
+			sshCmd.Stderr = os.Stderr
 
-		return sshCmd.Run()
+			return sshCmd.Run()
+		})
 	},
 }
 
@@ -22,8 +22,8 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
@@ -38,93 +38,109 @@ var createCmd = &cobra.Command{
 }
 
 func createOrStartServer(cmd *cobra.Command, args []string) error {
-	opts, err := options.FromEnv(false)
-	if err != nil {
-		return err
-	}
-
-	ctx := context.Background()
-	
-	configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-	if err != nil {
-		return err
-	}
-
-	o, err := oracle.NewOracle(configProvider)
-	if err != nil {
-		return err
-	}
-
-	// Get SSH key
-	keyDir := filepath.Join(opts.MachineFolder, ".ssh")
-	err = os.MkdirAll(keyDir, 0755)
-	if err != nil {
-		return errors.Wrap(err, "create key dir")
-	}
-
-	privateKeyPath := filepath.Join(keyDir, "id_rsa")
-	publicKeyPath := filepath.Join(keyDir, "id_rsa.pub")
-
-	var publicKey string
-	var privateKey string
-
-	// Check if keys exist
-	if _, err := os.Stat(privateKeyPath); os.IsNotExist(err) {
-		// Generate new keys
-		log.Default.Infof("Generating new SSH key pair...")
-		publicKey, privateKey, err = client.CreateSSHKeyPair()
+	return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+		// A retried create picks up the instance launched by the previous attempt
+		resumed, err := o.ResumeInstance(ctx, opts)
 		if err != nil {
-			return errors.Wrap(err, "create ssh key pair")
+			return errors.Wrap(err, "resume instance")
+		}
+		if resumed {
+			// The previous attempt may have stopped before the restore finished
+			err = o.RestoreFromObject(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "restore from object")
+			}
+			return nil
 		}
 
-		// Write keys to disk
-		err = ioutil.WriteFile(privateKeyPath, []byte(privateKey), 0600)
+		// Get SSH key
+		keyDir := filepath.Join(opts.MachineFolder, ".ssh")
+		err = os.MkdirAll(keyDir, 0755)
 		if err != nil {
-			return errors.Wrap(err, "write private key")
+			return errors.Wrap(err, "create key dir")
+		}
+
+		privateKeyPath := filepath.Join(keyDir, "id_rsa")
+		publicKeyPath := filepath.Join(keyDir, "id_rsa.pub")
+
+		var publicKey string
+		var privateKey string
+
+		// Check if keys exist
+		if _, err := os.Stat(privateKeyPath); os.IsNotExist(err) {
+			// Generate new keys
+			log.Default.Infof("Generating new SSH key pair...")
+			publicKey, privateKey, err = client.CreateSSHKeyPair()
+			if err != nil {
+				return errors.Wrap(err, "create ssh key pair")
+			}
+
+			// Write keys to disk
+			err = ioutil.WriteFile(privateKeyPath, []byte(privateKey), 0600)
+			if err != nil {
+				return errors.Wrap(err, "write private key")
+			}
+
+			err = ioutil.WriteFile(publicKeyPath, []byte(publicKey), 0644)
+			if err != nil {
+				return errors.Wrap(err, "write public key")
+			}
+		} else {
+			// Read existing keys
+			privateKeyBytes, err := ioutil.ReadFile(privateKeyPath)
+			if err != nil {
+				return errors.Wrap(err, "read private key")
+			}
+			privateKey = string(privateKeyBytes)
+
+			publicKeyBytes, err := ioutil.ReadFile(publicKeyPath)
+			if err != nil {
+				return errors.Wrap(err, "read public key")
+			}
+			publicKey = string(publicKeyBytes)
 		}
 
-		err = ioutil.WriteFile(publicKeyPath, []byte(publicKey), 0644)
+		// Take a provisioned instance from the warm pool if there is one
+		instance, err := o.ClaimPoolInstance(ctx, opts, publicKey)
 		if err != nil {
-			return errors.Wrap(err, "write public key")
+			return errors.Wrap(err, "claim pool instance")
 		}
-	} else {
-		// Read existing keys
-		privateKeyBytes, err := ioutil.ReadFile(privateKeyPath)
+		claimed := instance != nil
+
+		if !claimed {
+			// Create instance
+			request, err := o.BuildInstanceOptions(ctx, opts, publicKey)
+			if err != nil {
+				return errors.Wrap(err, "build instance options")
+			}
+
+			// Launch instance
+			instance, err = o.LaunchInstance(ctx, opts, request)
+			if err != nil {
+				return errors.Wrap(err, "launch instance")
+			}
+		}
+
+		err = o.AttachVolumes(ctx, opts, instance)
 		if err != nil {
-			return errors.Wrap(err, "read private key")
+			return errors.Wrap(err, "attach volumes")
 		}
-		privateKey = string(privateKeyBytes)
 
-		publicKeyBytes, err := ioutil.ReadFile(publicKeyPath)
+		// A claimed instance is still stopped
+		if claimed {
+			err = o.StartInstance(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "start pool instance")
+			}
+		}
+
+		err = o.RestoreFromObject(ctx, opts)
 		if err != nil {
-			return errors.Wrap(err, "read public key")
+			return errors.Wrap(err, "restore from object")
 		}
-		publicKey = string(publicKeyBytes)
-	}
-
-	// Create instance
-	request, err := o.BuildInstanceOptions(
-		ctx,
-		opts.MachineID,
-		opts.DiskImage,
-		opts.DiskSize,
-		opts.MachineType,
-		opts.Region,
-		opts.AvailabilityDomain,
-		opts.CompartmentID,
-		publicKey,
-	)
-	if err != nil {
-		return errors.Wrap(err, "build instance options")
-	}
-
-	// Launch instance
-	_, err = o.computeClient.LaunchInstance(ctx, *request)
-	if err != nil {
-		return errors.Wrap(err, "launch instance")
-	}
-
-	return nil
+
+		return nil
+	})
 }
 
 func init() {
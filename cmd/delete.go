@@ -19,8 +19,8 @@ package cmd
 import (
 	"context"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -30,32 +30,32 @@ var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete an instance",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		opts, err := options.FromEnv(false)
-		if err != nil {
-			return err
-		}
-
-		ctx := context.Background()
-		
-		configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-		if err != nil {
-			return err
-		}
-
-		o, err := oracle.NewOracle(configProvider)
-		if err != nil {
-			return err
-		}
-
-		err = o.DeleteInstance(ctx, opts.MachineID)
-		if err != nil {
-			return errors.Wrap(err, "delete instance")
-		}
-
-		return nil
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			// The network can only be removed once the instance has released
+			// it. DeleteInstance waits for the volumes by itself.
+			err := o.DeleteInstance(ctx, opts, !opts.NoWait || opts.CleanupNetwork)
+			if err != nil {
+				return errors.Wrap(err, "delete instance")
+			}
+
+			err = o.RemoveBackupRetention(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "remove backup retention")
+			}
+
+			if opts.CleanupNetwork {
+				err = o.DestroyNetwork(ctx, opts.CompartmentID)
+				if err != nil {
+					return errors.Wrap(err, "destroy network")
+				}
+			}
+
+			return nil
+		})
 	},
 }
 
 func init() {
+	deleteCmd.Flags().Bool("no-wait", false, "Return without waiting for the instance to be terminated")
 	rootCmd.AddCommand(deleteCmd)
 }
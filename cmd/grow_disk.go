@@ -0,0 +1,60 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// growDiskCmd represents the grow-disk command
+var growDiskCmd = &cobra.Command{
+	Use:   "grow-disk <size in GB>",
+	Short: "Grow the boot or home volume of a running instance and its filesystem",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		size, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("size must be a number of GB, got %q", args[0])
+		}
+		home, _ := cmd.Flags().GetBool("home")
+
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			err := o.GrowDisk(ctx, opts, home, size)
+			if err != nil {
+				return errors.Wrap(err, "grow disk")
+			}
+
+			err = o.GrowFilesystem(ctx, opts, home)
+			if err != nil {
+				return errors.Wrap(err, "grow filesystem")
+			}
+
+			return nil
+		})
+	},
+}
+
+func init() {
+	growDiskCmd.Flags().Bool("home", false, "Grow the home volume instead of the boot volume")
+	rootCmd.AddCommand(growDiskCmd)
+}
@@ -19,8 +19,8 @@ package cmd
 import (
 	"context"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/spf13/cobra"
 )
 
@@ -28,23 +28,10 @@ import (
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialise an instance",
-	RunE: func(_ *cobra.Command, args []string) error {
-		opts, err := options.FromEnv(true)
-		if err != nil {
-			return err
-		}
-
-		configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-		if err != nil {
-			return err
-		}
-
-		client, err := oracle.NewOracle(configProvider)
-		if err != nil {
-			return err
-		}
-
-		return nil
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withProvider(cmd, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			return o.Init(ctx, opts)
+		})
 	},
 }
 
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Manage the shared DevPod network",
+}
+
+// networkDestroyCmd represents the network destroy command
+var networkDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Destroy the shared DevPod network once no workspaces use it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withProvider(cmd, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			err := o.DestroyNetwork(ctx, opts.CompartmentID)
+			if err != nil {
+				return errors.Wrap(err, "destroy network")
+			}
+
+			return nil
+		})
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkDestroyCmd)
+	rootCmd.AddCommand(networkCmd)
+}
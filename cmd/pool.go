@@ -0,0 +1,82 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/loft-sh/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// poolCmd represents the pool command
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the warm pool of stopped, provisioned instances",
+}
+
+// poolFillCmd represents the pool fill command
+var poolFillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "Launch instances into the warm pool until it holds WARM_POOL_SIZE of them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withProvider(cmd, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			if opts.WarmPoolSize == 0 {
+				return fmt.Errorf("option WARM_POOL_SIZE must be set to fill the warm pool")
+			}
+
+			launched, err := o.FillPool(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "fill pool")
+			}
+
+			for _, instance := range launched {
+				fmt.Println(*instance.Id)
+			}
+			return nil
+		})
+	},
+}
+
+// poolDrainCmd represents the pool drain command
+var poolDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Terminate the unclaimed instances of the warm pool",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withProvider(cmd, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			terminated, err := o.DrainPool(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "drain pool")
+			}
+
+			log.Default.Infof("Terminated %d pooled instance(s)", terminated)
+			return nil
+		})
+	},
+}
+
+func init() {
+	poolFillCmd.Flags().Bool("no-wait", false, "Return without waiting for the instances to be provisioned and stopped")
+	poolCmd.AddCommand(poolFillCmd)
+	poolCmd.AddCommand(poolDrainCmd)
+	rootCmd.AddCommand(poolCmd)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// resizeCmd represents the resize command
+var resizeCmd = &cobra.Command{
+	Use:   "resize",
+	Short: "Change the shape, OCPUs or memory of an instance",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var target oracle.Size
+		target.Shape, _ = cmd.Flags().GetString("shape")
+		target.Ocpus, _ = cmd.Flags().GetFloat32("ocpus")
+		target.MemoryInGBs, _ = cmd.Flags().GetFloat32("memory")
+		if target == (oracle.Size{}) {
+			return fmt.Errorf("set at least one of --shape, --ocpus and --memory")
+		}
+
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			resize, err := o.ResizeInstance(ctx, opts, target)
+			if err != nil {
+				return errors.Wrap(err, "resize instance")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\tSHAPE\tOCPUS\tMEMORY\tESTIMATED COST")
+			for _, row := range []struct {
+				name string
+				size oracle.Size
+			}{{"before", resize.Before}, {"after", resize.After}} {
+				fmt.Fprintf(w, "%s\t%s\t%g\t%g GB\t%s\n", row.name, row.size.Shape, row.size.Ocpus, row.size.MemoryInGBs, cost(row.size))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Printf("\nCosts are estimated from the OCI list prices of %s, before any discounts.\n", oracle.ShapePricesAsOf)
+			return nil
+		})
+	},
+}
+
+// cost formats the estimated cost of a size, or unknown for a shape without
+// a known price
+func cost(size oracle.Size) string {
+	hourly, ok := size.HourlyCost()
+	if !ok {
+		return "unknown"
+	}
+	monthly, _ := size.MonthlyCost()
+	return fmt.Sprintf("$%.3f/hour ($%.2f/month)", hourly, monthly)
+}
+
+func init() {
+	resizeCmd.Flags().String("shape", "", "New shape, e.g. VM.Standard.E5.Flex")
+	resizeCmd.Flags().Float32("ocpus", 0, "New number of OCPUs for a flexible shape")
+	resizeCmd.Flags().Float32("memory", 0, "New memory in GB for a flexible shape")
+	resizeCmd.Flags().Bool("no-wait", false, "Return without waiting for a restarted instance to be running")
+	rootCmd.AddCommand(resizeCmd)
+}
@@ -17,8 +17,11 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -32,6 +35,8 @@ var rootCmd = &cobra.Command{
 	PersistentPreRunE: func(cobraCmd *cobra.Command, args []string) error {
 		log.Default.MakeRaw()
 
+		oracle.ProviderVersion = Version
+
 		logLevel := os.Getenv("DEVPOD_LOG_LEVEL")
 		if logLevel != "" {
 			if lvl, err := logrus.ParseLevel(logLevel); err != nil {
@@ -51,3 +56,54 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+// withMachine runs a command against the machine, holding the machine lock
+// for commands that use its instance or change its volumes. Commands with a
+// --no-wait flag pass it on in the options.
+func withMachine(cmd *cobra.Command, lock bool, run func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error) error {
+	opts, err := options.FromEnv(false)
+	if err != nil {
+		return err
+	}
+	opts.NoWait, _ = cmd.Flags().GetBool("no-wait")
+
+	ctx := context.Background()
+
+	if lock {
+		unlock, err := oracle.LockMachine(ctx, opts)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	return runWithOracle(ctx, opts, run)
+}
+
+// withProvider runs a command on what the workspaces share, such as the
+// network and the warm pool, which is not tied to a machine
+func withProvider(cmd *cobra.Command, run func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error) error {
+	opts, err := options.FromEnv(true)
+	if err != nil {
+		return err
+	}
+	opts.NoWait, _ = cmd.Flags().GetBool("no-wait")
+
+	return runWithOracle(context.Background(), opts, run)
+}
+
+func runWithOracle(
+	ctx context.Context, opts *options.Options, run func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error,
+) error {
+	configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
+	if err != nil {
+		return err
+	}
+
+	o, err := oracle.NewOracle(configProvider)
+	if err != nil {
+		return err
+	}
+
+	return run(ctx, o, opts)
+}
@@ -20,8 +20,8 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -31,30 +31,15 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Retrieve the status of an instance",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		opts, err := options.FromEnv(false)
-		if err != nil {
-			return err
-		}
-
-		ctx := context.Background()
-		
-		configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-		if err != nil {
-			return err
-		}
-
-		o, err := oracle.NewOracle(configProvider)
-		if err != nil {
-			return err
-		}
-
-		status, err := o.GetInstanceStatus(ctx, opts.MachineID)
-		if err != nil {
-			return errors.Wrap(err, "get instance status")
-		}
-
-		fmt.Print(status)
-		return nil
+		return withMachine(cmd, false, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			status, err := o.GetInstanceStatus(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "get instance status")
+			}
+
+			fmt.Print(status)
+			return nil
+		})
 	},
 }
 
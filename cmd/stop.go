@@ -19,8 +19,8 @@ package cmd
 import (
 	"context"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -30,32 +30,18 @@ var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop an instance",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		opts, err := options.FromEnv(false)
-		if err != nil {
-			return err
-		}
-
-		ctx := context.Background()
-		
-		configProvider, err := oracle.CreateOCIConfigurationProvider(opts.OCIConfigFile, opts.OCIProfile)
-		if err != nil {
-			return err
-		}
-
-		o, err := oracle.NewOracle(configProvider)
-		if err != nil {
-			return err
-		}
-
-		err = o.StopInstance(ctx, opts.MachineID)
-		if err != nil {
-			return errors.Wrap(err, "stop instance")
-		}
-
-		return nil
+		return withMachine(cmd, true, func(ctx context.Context, o *oracle.Oracle, opts *options.Options) error {
+			err := o.StopInstance(ctx, opts)
+			if err != nil {
+				return errors.Wrap(err, "stop instance")
+			}
+
+			return nil
+		})
 	},
 }
 
 func init() {
+	stopCmd.Flags().Bool("no-wait", false, "Return without waiting for a forced stop to complete. The grace period still applies")
 	rootCmd.AddCommand(stopCmd)
 }
@@ -24,8 +24,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/oracle"
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -57,36 +57,26 @@ func TestCreateAndDeleteInstance(t *testing.T) {
 	ctx := context.Background()
 
 	// Generate SSH key pair
-	publicKey, privateKey, err := client.CreateSSHKeyPair()
+	publicKey, _, err := client.CreateSSHKeyPair()
 	require.NoError(t, err)
 
 	// Create instance options
-	request, err := o.BuildInstanceOptions(
-		ctx,
-		opts.MachineID,
-		opts.DiskImage,
-		opts.DiskSize,
-		opts.MachineType,
-		opts.Region,
-		opts.AvailabilityDomain,
-		opts.CompartmentID,
-		publicKey,
-	)
+	request, err := o.BuildInstanceOptions(ctx, opts, publicKey)
 	require.NoError(t, err)
 
 	// Launch instance
-	_, err = o.computeClient.LaunchInstance(ctx, *request)
+	_, err = o.LaunchInstance(ctx, opts, request)
 	require.NoError(t, err)
 
 	// Cleanup at the end of the test
 	defer func() {
-		err := o.DeleteInstance(ctx, opts.MachineID)
+		err := o.DeleteInstance(ctx, opts, false)
 		assert.NoError(t, err)
 
 		// Wait for instance to be deleted
 		for i := 0; i < 30; i++ {
-			status, err := o.GetInstanceStatus(ctx, opts.MachineID)
-			if err != nil || status == "not_found" {
+			status, err := o.GetInstanceStatus(ctx, opts)
+			if err != nil || status == client.StatusNotFound {
 				break
 			}
 			time.Sleep(10 * time.Second)
@@ -94,49 +84,49 @@ func TestCreateAndDeleteInstance(t *testing.T) {
 	}()
 
 	// Wait for instance to be running
-	var status string
+	var status client.Status
 	for i := 0; i < 30; i++ {
-		status, err = o.GetInstanceStatus(ctx, opts.MachineID)
+		status, err = o.GetInstanceStatus(ctx, opts)
 		require.NoError(t, err)
-		if status == "running" {
+		if status == client.StatusRunning {
 			break
 		}
 		time.Sleep(10 * time.Second)
 	}
-	assert.Equal(t, "running", status)
+	assert.Equal(t, client.StatusRunning, status)
 
 	// Get instance IP
-	ip, err := o.GetInstanceIP(ctx, opts.MachineID)
+	ip, err := o.GetInstanceIP(ctx, opts)
 	require.NoError(t, err)
 	assert.NotEmpty(t, ip)
 
 	// Test stopping the instance
-	err = o.StopInstance(ctx, opts.MachineID)
+	err = o.StopInstance(ctx, opts)
 	require.NoError(t, err)
 
 	// Wait for instance to be stopped
 	for i := 0; i < 30; i++ {
-		status, err = o.GetInstanceStatus(ctx, opts.MachineID)
+		status, err = o.GetInstanceStatus(ctx, opts)
 		require.NoError(t, err)
-		if status == "stopped" {
+		if status == client.StatusStopped {
 			break
 		}
 		time.Sleep(10 * time.Second)
 	}
-	assert.Equal(t, "stopped", status)
+	assert.Equal(t, client.StatusStopped, status)
 
 	// Test starting the instance
-	err = o.StartInstance(ctx, opts.MachineID)
+	err = o.StartInstance(ctx, opts)
 	require.NoError(t, err)
 
 	// Wait for instance to be running again
 	for i := 0; i < 30; i++ {
-		status, err = o.GetInstanceStatus(ctx, opts.MachineID)
+		status, err = o.GetInstanceStatus(ctx, opts)
 		require.NoError(t, err)
-		if status == "running" {
+		if status == client.StatusRunning {
 			break
 		}
 		time.Sleep(10 * time.Second)
 	}
-	assert.Equal(t, "running", status)
-} 
\ No newline at end of file
+	assert.Equal(t, client.StatusRunning, status)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lock implements advisory file locks between provider processes on
+// the same host. A lock is an OS lock (flock or LockFileEx) on a file that is
+// kept open while it is held, so the OS releases it when its owner exits,
+// however it exits. The file holds the owner's PID for error messages only.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pollInterval = 250 * time.Millisecond
+
+// ErrLocked is returned when the lock is still held once the wait is over
+var ErrLocked = errors.New("lock is held by another process")
+
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock at path, waiting up to timeout for another process
+// to release it. A zero timeout tries exactly once.
+func Acquire(ctx context.Context, path string, timeout time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		file, err := tryAcquire(path)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return &Lock{file: file}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, &HeldError{Path: path, PID: Owner(path)}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Release unlocks and closes the lock file. The file is left in place:
+// removing it would let a waiter that already opened it lock a file that no
+// longer has a name while the next process creates a new one.
+func (l *Lock) Release() error {
+	// Clear the PID first, as the file can only be written while it is held
+	err := l.file.Truncate(0)
+	if unlockErr := unlockFile(l.file); err == nil {
+		err = unlockErr
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Owner returns the PID recorded in the lock file, or 0 if it cannot be read
+func Owner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
+
+// HeldError reports who holds a lock that could not be acquired
+type HeldError struct {
+	Path string
+	PID  int
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s (pid %d, %s)", ErrLocked, e.PID, e.Path)
+}
+
+func (e *HeldError) Unwrap() error {
+	return ErrLocked
+}
+
+// tryAcquire opens the lock file and locks it without waiting. It returns
+// the open file if the lock was taken and nil if another process holds it.
+func tryAcquire(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := lockFile(file)
+	if err != nil || !ok {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// The previous owner may have died before clearing its PID
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	if err != nil {
+		_ = unlockFile(file)
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Existing string
+		Held     bool
+		Error    error
+	}{
+		{
+			Name: "free",
+		},
+		{
+			Name:  "held",
+			Held:  true,
+			Error: ErrLocked,
+		},
+		{
+			Name:     "left behind",
+			Existing: "999999999",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			path := filepath.Join(t.TempDir(), "test.lock")
+			if test.Existing != "" {
+				assert.NoError(os.WriteFile(path, []byte(test.Existing), 0o644))
+			}
+			if test.Held {
+				held, err := Acquire(context.Background(), path, 0)
+				assert.NoError(err)
+				defer func() { assert.NoError(held.Release()) }()
+			}
+
+			l, err := Acquire(context.Background(), path, 300*time.Millisecond)
+
+			if test.Error == nil {
+				assert.NoError(err)
+				assert.Equal(os.Getpid(), Owner(path))
+				assert.NoError(l.Release())
+				assert.Zero(Owner(path))
+			} else {
+				assert.ErrorIs(err, test.Error)
+				var held *HeldError
+				if assert.ErrorAs(err, &held) {
+					assert.Equal(os.Getpid(), held.PID)
+				}
+				assert.Nil(l)
+			}
+		})
+	}
+}
+
+func TestAcquireAfterOwnerExits(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	// Closing the file without releasing is what the OS does for a process
+	// that dies holding the lock
+	first, err := Acquire(context.Background(), path, 0)
+	assert.NoError(err)
+	assert.NoError(first.file.Close())
+
+	second, err := Acquire(context.Background(), path, 0)
+	assert.NoError(err)
+	assert.NoError(second.Release())
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	first, err := Acquire(context.Background(), path, 0)
+	assert.NoError(err)
+
+	go func() {
+		time.Sleep(2 * pollInterval)
+		_ = first.Release()
+	}()
+
+	second, err := Acquire(context.Background(), path, 5*time.Second)
+	assert.NoError(err)
+	assert.NoError(second.Release())
+}
@@ -19,21 +19,101 @@ package options
 import (
 	"fmt"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Stop modes
+const (
+	StopModeStop      = "stop"
+	StopModeTerminate = "terminate"
+)
+
+// Capacity types
+const (
+	CapacityTypeOnDemand    = "on-demand"
+	CapacityTypePreemptible = "preemptible"
+)
+
+// Docker data locations
+const (
+	DockerDataBoot  = "boot"
+	DockerDataBlock = "block"
+	DockerDataNVMe  = "nvme"
+)
+
+// FSSMountTargetAuto creates a devpod file system and mount target in the
+// devpod subnet instead of using an existing mount target
+const FSSMountTargetAuto = "auto"
+
+// AgentPlugin is the desired state of an Oracle Cloud Agent plugin
+type AgentPlugin struct {
+	Name    string
+	Enabled bool
+}
+
 type Options struct {
 	MachineID     string
 	MachineFolder string
 
-	Region            string
-	CompartmentID     string
-	AvailabilityDomain string
-	DiskImage         string
-	DiskSize          string
-	MachineType       string
-	OCIConfigFile     string
-	OCIProfile        string
+	Region              string
+	CompartmentID       string
+	AvailabilityDomain  string
+	DiskImage           string
+	DiskSize            int
+	BootVolumeVPUsPerGB int
+	MachineType         string
+	OCIConfigFile       string
+	OCIProfile          string
+	HomeVolumeSize      int
+	CleanupNetwork      bool
+	LockTimeout         time.Duration
+	WaitTimeout         time.Duration
+	StopGracePeriod     time.Duration
+	StopMode            string
+	PreStopCommand      string
+
+	CapacityType          string
+	PreemptibleRelaunch   bool
+	CapacityReservationID string
+	DedicatedVMHostID     string
+
+	KMSKeyID              string
+	KMSVaultCompartmentID string
+	PvEncryptionInTransit bool
+	ShieldedInstance      bool
+	ConfidentialComputing bool
+	LegacyIMDSEndpoints   bool
+	AgentPlugins          []AgentPlugin
+	RestoreFromBackup     string
+	WarmPoolSize          int
+
+	// DockerData is where Docker keeps its data. A block volume is
+	// DockerDataSize GB.
+	DockerData     string
+	DockerDataSize int
+
+	// FSSMountTarget is the mount target of the shared file system, or
+	// FSSMountTargetAuto. Every instance mounts FSSExportPath from it at
+	// FSSMountPath.
+	FSSMountTarget string
+	FSSExportPath  string
+	FSSMountPath   string
+
+	// Backups are kept in BackupBucket in BackupRegion, or the region of the
+	// OCI config if that is empty, encrypted with BackupKMSKeyID. A new
+	// workspace restores its home from RestoreFromObject.
+	BackupBucket        string
+	BackupRegion        string
+	BackupKMSKeyID      string
+	BackupRetentionDays int
+	RestoreFromObject   string
+
+	// NoWait returns from start, stop and delete as soon as OCI accepts the
+	// request. It is set by the --no-wait flag.
+	NoWait bool
 }
 
 func FromEnv(skipMachine bool) (*Options, error) {
@@ -70,10 +150,23 @@ func FromEnv(skipMachine bool) (*Options, error) {
 		return nil, err
 	}
 
-	retOptions.DiskSize, err = fromEnvOrError("DISK_SIZE")
+	diskSize, err := fromEnvOrError("DISK_SIZE")
 	if err != nil {
 		return nil, err
 	}
+	retOptions.DiskSize, err = strconv.Atoi(diskSize)
+	if err != nil || retOptions.DiskSize < 50 || retOptions.DiskSize > 32768 {
+		return nil, fmt.Errorf("option DISK_SIZE must be between 50 and 32768 GB, got %q", diskSize)
+	}
+
+	retOptions.BootVolumeVPUsPerGB, err = fromEnvInt("BOOT_VOLUME_VPUS_PER_GB", 10)
+	if err != nil {
+		return nil, err
+	}
+	if retOptions.BootVolumeVPUsPerGB < 10 || retOptions.BootVolumeVPUsPerGB > 120 || retOptions.BootVolumeVPUsPerGB%10 != 0 {
+		return nil, fmt.Errorf("option BOOT_VOLUME_VPUS_PER_GB must be a multiple of 10 between 10 and 120, got %d",
+			retOptions.BootVolumeVPUsPerGB)
+	}
 
 	retOptions.DiskImage, err = fromEnvOrError("DISK_IMAGE")
 	if err != nil {
@@ -95,9 +188,247 @@ func FromEnv(skipMachine bool) (*Options, error) {
 		return nil, err
 	}
 
+	retOptions.HomeVolumeSize, err = fromEnvInt("HOME_VOLUME_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if retOptions.HomeVolumeSize != 0 && (retOptions.HomeVolumeSize < 50 || retOptions.HomeVolumeSize > 32768) {
+		return nil, fmt.Errorf("option HOME_VOLUME_SIZE must be 0 or between 50 and 32768 GB, got %d", retOptions.HomeVolumeSize)
+	}
+
+	retOptions.CleanupNetwork, err = fromEnvBool("CLEANUP_NETWORK", false)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.LockTimeout, err = fromEnvDuration("LOCK_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.WaitTimeout, err = fromEnvDuration("WAIT_TIMEOUT", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.StopGracePeriod, err = fromEnvDuration("STOP_GRACE_PERIOD", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.PreStopCommand = os.Getenv("PRE_STOP_COMMAND")
+
+	retOptions.StopMode = os.Getenv("STOP_MODE")
+	switch retOptions.StopMode {
+	case "":
+		retOptions.StopMode = StopModeStop
+	case StopModeStop, StopModeTerminate:
+	default:
+		return nil, fmt.Errorf("option STOP_MODE must be %s or %s, got %q", StopModeStop, StopModeTerminate, retOptions.StopMode)
+	}
+
+	retOptions.CapacityType = os.Getenv("CAPACITY_TYPE")
+	switch retOptions.CapacityType {
+	case "":
+		retOptions.CapacityType = CapacityTypeOnDemand
+	case CapacityTypeOnDemand, CapacityTypePreemptible:
+	default:
+		return nil, fmt.Errorf(
+			"option CAPACITY_TYPE must be %s or %s, got %q", CapacityTypeOnDemand, CapacityTypePreemptible, retOptions.CapacityType,
+		)
+	}
+
+	retOptions.PreemptibleRelaunch, err = fromEnvBool("PREEMPTIBLE_RELAUNCH", true)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.CapacityReservationID = os.Getenv("CAPACITY_RESERVATION_ID")
+	retOptions.DedicatedVMHostID = os.Getenv("DEDICATED_VM_HOST_ID")
+	if retOptions.CapacityReservationID != "" && retOptions.DedicatedVMHostID != "" {
+		return nil, fmt.Errorf("options CAPACITY_RESERVATION_ID and DEDICATED_VM_HOST_ID cannot be used together")
+	}
+
+	retOptions.KMSKeyID = os.Getenv("KMS_KEY_ID")
+	retOptions.KMSVaultCompartmentID = os.Getenv("KMS_VAULT_COMPARTMENT_ID")
+	if retOptions.KMSVaultCompartmentID == "" {
+		retOptions.KMSVaultCompartmentID = retOptions.CompartmentID
+	}
+	retOptions.PvEncryptionInTransit, err = fromEnvBool("PV_ENCRYPTION_IN_TRANSIT", true)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.ShieldedInstance, err = fromEnvBool("SHIELDED_INSTANCE", false)
+	if err != nil {
+		return nil, err
+	}
+	retOptions.ConfidentialComputing, err = fromEnvBool("CONFIDENTIAL_COMPUTING", false)
+	if err != nil {
+		return nil, err
+	}
+	if retOptions.ShieldedInstance && retOptions.ConfidentialComputing {
+		return nil, fmt.Errorf("options SHIELDED_INSTANCE and CONFIDENTIAL_COMPUTING cannot be used together")
+	}
+
+	retOptions.LegacyIMDSEndpoints, err = fromEnvBool("LEGACY_IMDS_ENDPOINTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.AgentPlugins, err = agentPluginsFromEnv("AGENT_PLUGINS")
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.RestoreFromBackup = os.Getenv("RESTORE_FROM_BACKUP")
+
+	retOptions.WarmPoolSize, err = fromEnvInt("WARM_POOL_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if retOptions.WarmPoolSize < 0 {
+		return nil, fmt.Errorf("option WARM_POOL_SIZE must be 0 or more, got %d", retOptions.WarmPoolSize)
+	}
+
+	retOptions.DockerData, retOptions.DockerDataSize, err = dockerDataFromEnv("DOCKER_DATA")
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.FSSMountTarget = os.Getenv("FSS_MOUNT_TARGET")
+	retOptions.FSSExportPath, err = pathFromEnv("FSS_EXPORT_PATH", "/devpod")
+	if err != nil {
+		return nil, err
+	}
+	retOptions.FSSMountPath, err = pathFromEnv("FSS_MOUNT_PATH", "/mnt/shared")
+	if err != nil {
+		return nil, err
+	}
+
+	retOptions.BackupBucket = os.Getenv("BACKUP_BUCKET")
+	if retOptions.BackupBucket == "" {
+		retOptions.BackupBucket = "devpod-backups"
+	}
+	retOptions.BackupRegion = os.Getenv("BACKUP_REGION")
+	// KMS keys are regional, so KMS_KEY_ID only applies in its own region
+	retOptions.BackupKMSKeyID = os.Getenv("BACKUP_KMS_KEY_ID")
+	if retOptions.BackupKMSKeyID == "" && (retOptions.BackupRegion == "" || retOptions.BackupRegion == retOptions.Region) {
+		retOptions.BackupKMSKeyID = retOptions.KMSKeyID
+	}
+	retOptions.BackupRetentionDays, err = fromEnvInt("BACKUP_RETENTION_DAYS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if retOptions.BackupRetentionDays < 0 {
+		return nil, fmt.Errorf("option BACKUP_RETENTION_DAYS must be 0 or more, got %d", retOptions.BackupRetentionDays)
+	}
+	retOptions.RestoreFromObject = os.Getenv("RESTORE_FROM_OBJECT")
+
 	return retOptions, nil
 }
 
+// dockerDataFromEnv parses boot, nvme or block:<size in GB>
+func dockerDataFromEnv(name string) (string, int, error) {
+	val := os.Getenv(name)
+	kind, size, _ := strings.Cut(val, ":")
+
+	switch {
+	case val == "":
+		return DockerDataBoot, 0, nil
+	case val == DockerDataBoot, val == DockerDataNVMe:
+		return val, 0, nil
+	case kind == DockerDataBlock:
+		gb, err := strconv.Atoi(size)
+		if err == nil && gb >= 50 && gb <= 32768 {
+			return DockerDataBlock, gb, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("option %s must be %s, %s or %s:<size> with a size between 50 and 32768 GB, got %q",
+		name, DockerDataBoot, DockerDataNVMe, DockerDataBlock, val)
+}
+
+// pathFromEnv parses an absolute path without spaces, which would break the
+// fstab entry it ends up in
+func pathFromEnv(name, defaultValue string) (string, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	if !strings.HasPrefix(val, "/") || strings.ContainsAny(val, " \t\n") {
+		return "", fmt.Errorf("option %s must be an absolute path without spaces, got %q", name, val)
+	}
+
+	return path.Clean(val), nil
+}
+
+func fromEnvDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("option %s must be a duration such as 30s or 5m, got %q", name, val)
+	}
+
+	return d, nil
+}
+
+func fromEnvInt(name string, defaultValue int) (int, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("option %s must be a number, got %q", name, val)
+	}
+
+	return i, nil
+}
+
+func fromEnvBool(name string, defaultValue bool) (bool, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("option %s must be a boolean, got %q", name, val)
+	}
+
+	return b, nil
+}
+
+// agentPluginsFromEnv parses a comma-separated list of name=enabled or
+// name=disabled pairs
+func agentPluginsFromEnv(name string) ([]AgentPlugin, error) {
+	val := os.Getenv(name)
+	if strings.TrimSpace(val) == "" {
+		return nil, nil
+	}
+
+	var plugins []AgentPlugin
+	for _, entry := range strings.Split(val, ",") {
+		pluginName, state, ok := strings.Cut(entry, "=")
+		pluginName = strings.TrimSpace(pluginName)
+		state = strings.ToLower(strings.TrimSpace(state))
+		if !ok || pluginName == "" || (state != "enabled" && state != "disabled") {
+			return nil, fmt.Errorf("option %s must be a list such as \"Compute Instance Monitoring=enabled,Bastion=disabled\", got %q", name, val)
+		}
+
+		plugins = append(plugins, AgentPlugin{Name: pluginName, Enabled: state == "enabled"})
+	}
+
+	return plugins, nil
+}
+
 func fromEnvOrError(name string, fallback ...string) (string, error) {
 	envvars := append([]string{name}, fallback...)
 
@@ -0,0 +1,528 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// backupCommand streams a gzipped tarball of the workspace home to stdout.
+// tar exits with 1 when a file changed while it was read, which a backup of
+// a live workspace has to accept.
+const backupCommand = "sudo tar --warning=no-file-changed -C " + workspaceHome + " -czf - . || [ $? -eq 1 ]"
+
+// restoreCommand unpacks a backup from stdin over the workspace home. Owners
+// are restored by name, so they survive an image with different user IDs.
+const restoreCommand = "sudo tar -C " + workspaceHome + " -xzf -"
+
+// Backup is an archive of a workspace home in Object Storage
+type Backup struct {
+	Object  string
+	Size    int64
+	Created time.Time
+}
+
+// objectUpload is where a multipart upload goes and how it is stored
+type objectUpload struct {
+	Namespace string
+	Bucket    string
+	Object    string
+	KMSKeyID  *string
+	Metadata  map[string]string
+}
+
+// Backup streams a tarball of the workspace home from the running instance
+// into BACKUP_BUCKET, creating the bucket if needed. Nothing is written to
+// local disk, and the upload is aborted if the archive fails part way.
+func (o *Oracle) Backup(ctx context.Context, opts *options.Options, name string) (*Backup, error) {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning {
+		return nil, ErrInstanceNotRunning(*instance.Id, string(instance.LifecycleState))
+	}
+
+	client, namespace, err := o.backupStorage(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.ensureBackupBucket(ctx, opts, client, namespace); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = time.Now().UTC().Format("20060102-150405")
+	}
+	upload := &objectUpload{
+		Namespace: namespace,
+		Bucket:    opts.BackupBucket,
+		Object:    backupObjectName(opts.MachineID, name),
+		KMSKeyID:  optionalString(opts.BackupKMSKeyID),
+		Metadata: map[string]string{
+			"opc-meta-" + labelMachineID: opts.MachineID,
+			"opc-meta-" + labelType:      labelTypeDevPod,
+		},
+	}
+
+	log.Default.Infof("Backing up %s to %s/%s", workspaceHome, upload.Bucket, upload.Object)
+
+	stderr := log.Default.Writer(logrus.InfoLevel, false)
+	defer stderr.Close()
+
+	archive, writer := io.Pipe()
+	defer archive.Close()
+	go func() {
+		writer.CloseWithError(o.RunCommand(ctx, opts, backupCommand, writer, stderr))
+	}()
+
+	size, err := uploadMultipart(ctx, client, upload, archive, backupPartSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{Object: upload.Object, Size: size, Created: time.Now().UTC()}, nil
+}
+
+// ListBackups returns the machine's backups in BACKUP_BUCKET, oldest first
+func (o *Oracle) ListBackups(ctx context.Context, opts *options.Options) ([]Backup, error) {
+	client, namespace, err := o.backupStorage(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := listAll(ctx, func(ctx context.Context, page *string) ([]objectstorage.ObjectSummary, *string, error) {
+		response, err := client.ListObjects(ctx, objectstorage.ListObjectsRequest{
+			NamespaceName: &namespace,
+			BucketName:    &opts.BackupBucket,
+			Prefix:        common.String(backupObjectPrefix + opts.MachineID + "/"),
+			Fields:        common.String("name,size,timeCreated"),
+			Start:         page,
+		})
+		return response.Objects, response.NextStartWith, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Backup, 0, len(objects))
+	for _, object := range objects {
+		backup := Backup{Object: *object.Name}
+		if object.Size != nil {
+			backup.Size = *object.Size
+		}
+		if object.TimeCreated != nil {
+			backup.Created = object.TimeCreated.Time
+		}
+		backups = append(backups, backup)
+	}
+
+	// Objects are listed by name
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Created.Before(backups[j].Created)
+	})
+
+	return backups, nil
+}
+
+// RestoreBackup streams a backup from BACKUP_BUCKET into the workspace home
+// of the running instance. Files in the backup replace those on the
+// instance; other files are left alone.
+func (o *Oracle) RestoreBackup(ctx context.Context, opts *options.Options, backup string) error {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning {
+		return ErrInstanceNotRunning(*instance.Id, string(instance.LifecycleState))
+	}
+
+	client, namespace, err := o.backupStorage(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	object := backupObject(opts.MachineID, backup)
+	response, err := client.GetObject(ctx, objectstorage.GetObjectRequest{
+		NamespaceName: &namespace,
+		BucketName:    &opts.BackupBucket,
+		ObjectName:    &object,
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrBackupObjectNotFound(object, opts.BackupBucket)
+		}
+		return errors.Wrap(err, "get backup")
+	}
+	defer response.Content.Close()
+
+	log.Default.Infof("Restoring %s/%s into %s", opts.BackupBucket, object, workspaceHome)
+
+	writer := log.Default.Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	return o.runCommand(ctx, opts, restoreCommand, response.Content, writer, writer)
+}
+
+// RestoreFromObject restores RESTORE_FROM_OBJECT into a new workspace once
+// the instance is provisioned, so that the home volume is mounted. The
+// object can be in another region when BACKUP_REGION is set. The restore is
+// recorded in the machine state, so a retried create only repeats it if it
+// did not complete.
+func (o *Oracle) RestoreFromObject(ctx context.Context, opts *options.Options) error {
+	if opts.RestoreFromObject == "" {
+		return nil
+	}
+	if state := loadState(opts.MachineFolder); state != nil && state.RestoredObject == opts.RestoreFromObject {
+		log.Default.Debugf("%s was already restored", opts.RestoreFromObject)
+		return nil
+	}
+
+	if err := o.waitForProvisioned(ctx, opts); err != nil {
+		return err
+	}
+
+	if err := o.RestoreBackup(ctx, opts, opts.RestoreFromObject); err != nil {
+		return err
+	}
+
+	state := loadState(opts.MachineFolder)
+	if state == nil {
+		return nil
+	}
+	state.RestoredObject = opts.RestoreFromObject
+	return saveState(opts.MachineFolder, state)
+}
+
+// waitForProvisioned waits until the instance accepts SSH and cloud-init
+// has finished with it
+func (o *Oracle) waitForProvisioned(ctx context.Context, opts *options.Options) error {
+	log.Default.Info("Waiting for the instance to be provisioned")
+
+	if opts.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.WaitTimeout)
+		defer cancel()
+	}
+
+	for {
+		err := o.RunCommand(ctx, opts, "cloud-init status --wait >/dev/null 2>&1 || true", io.Discard, io.Discard)
+		if err == nil {
+			return nil
+		}
+		log.Default.Debugf("Instance is not reachable yet: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return ErrWaitTimeout("reachable over SSH", opts.WaitTimeout)
+		case <-time.After(instancePollInterval):
+		}
+	}
+}
+
+// backupStorage returns the Object Storage client for BACKUP_REGION and the
+// tenancy's namespace
+func (o *Oracle) backupStorage(ctx context.Context, opts *options.Options) (objectStorageAPI, string, error) {
+	client, err := o.objectStorageClient(opts.BackupRegion)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "object storage client")
+	}
+
+	response, err := client.GetNamespace(ctx, objectstorage.GetNamespaceRequest{})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "get object storage namespace")
+	}
+
+	return client, *response.Value, nil
+}
+
+// ensureBackupBucket creates BACKUP_BUCKET if it does not exist, private and
+// encrypted with BACKUP_KMS_KEY_ID if one is set, and applies BACKUP_RETENTION_DAYS
+// to the backups in it
+func (o *Oracle) ensureBackupBucket(ctx context.Context, opts *options.Options, client objectStorageAPI, namespace string) error {
+	_, err := client.GetBucket(ctx, objectstorage.GetBucketRequest{
+		NamespaceName: &namespace,
+		BucketName:    &opts.BackupBucket,
+	})
+	if err != nil {
+		if !IsNotFound(err) {
+			return errors.Wrap(err, "get bucket")
+		}
+
+		log.Default.Infof("Creating bucket %s", opts.BackupBucket)
+
+		_, err = client.CreateBucket(ctx, objectstorage.CreateBucketRequest{
+			NamespaceName: &namespace,
+			CreateBucketDetails: objectstorage.CreateBucketDetails{
+				Name:             &opts.BackupBucket,
+				CompartmentId:    &opts.CompartmentID,
+				PublicAccessType: objectstorage.CreateBucketDetailsPublicAccessTypeNopublicaccess,
+				KmsKeyId:         optionalString(opts.BackupKMSKeyID),
+				FreeformTags: map[string]string{
+					labelType: labelTypeDevPod,
+				},
+			},
+		})
+		// Another workspace may have created it in the meantime
+		if err != nil && !isConflict(err) {
+			return errors.Wrap(err, "create bucket")
+		}
+	}
+
+	if opts.BackupRetentionDays == 0 {
+		return nil
+	}
+
+	err = applyBackupRetention(ctx, client, namespace, opts.BackupBucket, opts.MachineID, opts.BackupRetentionDays)
+	return errors.Wrap(err, "set backup retention")
+}
+
+// applyBackupRetention keeps a lifecycle rule on the bucket that deletes the
+// machine's backups after the given number of days. Each machine has its own
+// rule, so workspaces sharing the bucket can keep backups for different
+// times.
+func applyBackupRetention(ctx context.Context, client objectStorageAPI, namespace, bucket, machineID string, days int) error {
+	name := backupRetentionRuleName(machineID)
+	rule := objectstorage.ObjectLifecycleRule{
+		Name:       &name,
+		Action:     common.String("DELETE"),
+		Target:     common.String("objects"),
+		TimeAmount: common.Int64(int64(days)),
+		TimeUnit:   objectstorage.ObjectLifecycleRuleTimeUnitDays,
+		IsEnabled:  common.Bool(true),
+		ObjectNameFilter: &objectstorage.ObjectNameFilter{
+			InclusionPrefixes: []string{backupObjectPrefix + machineID + "/"},
+		},
+	}
+
+	return updateLifecyclePolicy(ctx, client, namespace, bucket,
+		func(current []objectstorage.ObjectLifecycleRule) ([]objectstorage.ObjectLifecycleRule, bool) {
+			rules := []objectstorage.ObjectLifecycleRule{rule}
+			for _, r := range current {
+				if r.Name == nil || *r.Name != name {
+					rules = append(rules, r)
+					continue
+				}
+				if r.TimeAmount != nil && *r.TimeAmount == int64(days) && r.IsEnabled != nil && *r.IsEnabled {
+					return nil, false
+				}
+			}
+
+			log.Default.Infof("Deleting the backups of this machine in %s after %d days", bucket, days)
+
+			return rules, true
+		})
+}
+
+// RemoveBackupRetention removes the lifecycle rule of the machine from
+// BACKUP_BUCKET once the machine is deleted, so that the policy does not
+// keep growing. The backups left are kept until they are deleted by hand.
+func (o *Oracle) RemoveBackupRetention(ctx context.Context, opts *options.Options) error {
+	if opts.BackupBucket == "" {
+		return nil
+	}
+
+	client, namespace, err := o.backupStorage(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	name := backupRetentionRuleName(opts.MachineID)
+
+	return updateLifecyclePolicy(ctx, client, namespace, opts.BackupBucket,
+		func(current []objectstorage.ObjectLifecycleRule) ([]objectstorage.ObjectLifecycleRule, bool) {
+			var rules []objectstorage.ObjectLifecycleRule
+			for _, r := range current {
+				if r.Name == nil || *r.Name != name {
+					rules = append(rules, r)
+				}
+			}
+			return rules, len(rules) != len(current)
+		})
+}
+
+func backupRetentionRuleName(machineID string) string {
+	return backupLifecycleRuleName + "-" + machineID
+}
+
+// updateLifecyclePolicy replaces the lifecycle rules of the bucket with those
+// returned by update, unless it reports no change. Rules set outside the
+// provider are passed to update like any other. The policy can only be
+// written as a whole, so the write is conditional on the policy that was
+// read and repeated if another machine changed it in the meantime.
+func updateLifecyclePolicy(
+	ctx context.Context, client objectStorageAPI, namespace, bucket string,
+	update func(current []objectstorage.ObjectLifecycleRule) ([]objectstorage.ObjectLifecycleRule, bool),
+) error {
+	for attempt := 1; ; attempt++ {
+		response, err := client.GetObjectLifecyclePolicy(ctx, objectstorage.GetObjectLifecyclePolicyRequest{
+			NamespaceName: &namespace,
+			BucketName:    &bucket,
+		})
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+
+		rules, changed := update(response.Items)
+		if !changed {
+			return nil
+		}
+
+		if len(rules) == 0 {
+			_, err = client.DeleteObjectLifecyclePolicy(ctx, objectstorage.DeleteObjectLifecyclePolicyRequest{
+				NamespaceName: &namespace,
+				BucketName:    &bucket,
+				IfMatch:       response.ETag,
+			})
+		} else {
+			request := objectstorage.PutObjectLifecyclePolicyRequest{
+				NamespaceName:                   &namespace,
+				BucketName:                      &bucket,
+				PutObjectLifecyclePolicyDetails: objectstorage.PutObjectLifecyclePolicyDetails{Items: rules},
+				IfMatch:                         response.ETag,
+			}
+			// Without a policy to match, only create one if there still is none
+			if response.ETag == nil {
+				request.IfNoneMatch = common.String("*")
+			}
+			_, err = client.PutObjectLifecyclePolicy(ctx, request)
+		}
+		if !isPreconditionFailed(err) || attempt == maxLifecyclePolicyAttempts {
+			return err
+		}
+
+		log.Default.Debugf("Lifecycle policy of %s changed while it was updated - retrying", bucket)
+	}
+}
+
+// uploadMultipart uploads the reader in parts of partSize bytes, so that only
+// one part is held in memory, and returns the size of the object. The upload
+// is aborted on failure so that its parts are not kept.
+func uploadMultipart(ctx context.Context, client objectStorageAPI, upload *objectUpload, r io.Reader, partSize int) (int64, error) {
+	created, err := client.CreateMultipartUpload(ctx, objectstorage.CreateMultipartUploadRequest{
+		NamespaceName: &upload.Namespace,
+		BucketName:    &upload.Bucket,
+		CreateMultipartUploadDetails: objectstorage.CreateMultipartUploadDetails{
+			Object:      &upload.Object,
+			ContentType: common.String("application/gzip"),
+			Metadata:    upload.Metadata,
+		},
+		OpcSseKmsKeyId: upload.KMSKeyID,
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "create multipart upload")
+	}
+
+	size, err := uploadParts(ctx, client, upload, created.UploadId, r, partSize)
+	if err != nil {
+		_, abortErr := client.AbortMultipartUpload(ctx, objectstorage.AbortMultipartUploadRequest{
+			NamespaceName: &upload.Namespace,
+			BucketName:    &upload.Bucket,
+			ObjectName:    &upload.Object,
+			UploadId:      created.UploadId,
+		})
+		if abortErr != nil {
+			log.Default.Warnf("Unable to abort upload %s: %v", *created.UploadId, abortErr)
+		}
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func uploadParts(
+	ctx context.Context, client objectStorageAPI, upload *objectUpload, uploadID *string, r io.Reader, partSize int,
+) (int64, error) {
+	var parts []objectstorage.CommitMultipartUploadPartDetails
+	var size int64
+	buffer := make([]byte, partSize)
+
+	for {
+		n, err := io.ReadFull(r, buffer)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, errors.Wrap(err, "read archive")
+		}
+		// An empty last part is only uploaded if the object would have none
+		if n == 0 && len(parts) > 0 {
+			break
+		}
+
+		partNum := len(parts) + 1
+		response, uploadErr := client.UploadPart(ctx, objectstorage.UploadPartRequest{
+			NamespaceName:  &upload.Namespace,
+			BucketName:     &upload.Bucket,
+			ObjectName:     &upload.Object,
+			UploadId:       uploadID,
+			UploadPartNum:  common.Int(partNum),
+			ContentLength:  common.Int64(int64(n)),
+			UploadPartBody: io.NopCloser(bytes.NewReader(buffer[:n])),
+			OpcSseKmsKeyId: upload.KMSKeyID,
+		})
+		if uploadErr != nil {
+			return 0, errors.Wrapf(uploadErr, "upload part %d", partNum)
+		}
+
+		parts = append(parts, objectstorage.CommitMultipartUploadPartDetails{PartNum: common.Int(partNum), Etag: response.ETag})
+		size += int64(n)
+		log.Default.Debugf("Uploaded part %d, %d bytes in total", partNum, size)
+
+		if err != nil {
+			break
+		}
+	}
+
+	_, err := client.CommitMultipartUpload(ctx, objectstorage.CommitMultipartUploadRequest{
+		NamespaceName: &upload.Namespace,
+		BucketName:    &upload.Bucket,
+		ObjectName:    &upload.Object,
+		UploadId:      uploadID,
+		CommitMultipartUploadDetails: objectstorage.CommitMultipartUploadDetails{
+			PartsToCommit: parts,
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "commit multipart upload")
+	}
+
+	return size, nil
+}
+
+func backupObjectName(machineID, name string) string {
+	return backupObjectPrefix + machineID + "/" + strings.TrimSuffix(name, backupObjectSuffix) + backupObjectSuffix
+}
+
+// backupObject returns the object that a backup refers to: either the full
+// object name that backup prints, which may be another machine's, or the
+// name of one of this machine's backups
+func backupObject(machineID, backup string) string {
+	if strings.HasPrefix(backup, backupObjectPrefix) {
+		return backup
+	}
+	return backupObjectName(machineID, backup)
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadMultipart(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  string
+		parts int
+	}{
+		{name: "partial last part", data: "0123456789", parts: 3},
+		{name: "exact parts", data: "01234567", parts: 2},
+		{name: "empty", data: "", parts: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &fakeObjectStorage{}
+			upload := &objectUpload{Namespace: "namespace", Bucket: "bucket", Object: "object"}
+
+			size, err := uploadMultipart(context.Background(), storage, upload, bytes.NewBufferString(tc.data), 4)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tc.data)), size)
+			assert.Equal(t, tc.parts, storage.calls["UploadPart"])
+			assert.Equal(t, tc.data, string(storage.objects["object"]))
+		})
+	}
+}
+
+func TestUploadMultipartAbortsOnReadError(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	upload := &objectUpload{Namespace: "namespace", Bucket: "bucket", Object: "object"}
+	r := io.MultiReader(bytes.NewBufferString("01234567"), iotest.ErrReader(errors.New("ssh: connection lost")))
+
+	_, err := uploadMultipart(context.Background(), storage, upload, r, 4)
+	assert.ErrorContains(t, err, "connection lost")
+
+	assert.Equal(t, 1, storage.calls["AbortMultipartUpload"])
+	assert.Zero(t, storage.calls["CommitMultipartUpload"])
+	assert.NotContains(t, storage.objects, "object")
+}
+
+func TestEnsureBackupBucket(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	opts := &options.Options{
+		BackupBucket:   "devpod-backups",
+		CompartmentID:  "compartment-id",
+		KMSKeyID:       "key-id",
+		BackupKMSKeyID: "backup-key-id",
+	}
+
+	assert.NoError(t, (&Oracle{}).ensureBackupBucket(context.Background(), opts, storage, "namespace"))
+
+	bucket := storage.buckets["devpod-backups"]
+	assert.Equal(t, objectstorage.CreateBucketDetailsPublicAccessTypeNopublicaccess, bucket.PublicAccessType)
+	assert.Equal(t, "backup-key-id", *bucket.KmsKeyId)
+	assert.Equal(t, labelTypeDevPod, bucket.FreeformTags[labelType])
+	assert.Zero(t, storage.calls["PutObjectLifecyclePolicy"])
+
+	assert.NoError(t, (&Oracle{}).ensureBackupBucket(context.Background(), opts, storage, "namespace"))
+	assert.Equal(t, 1, storage.calls["CreateBucket"])
+}
+
+func TestApplyBackupRetention(t *testing.T) {
+	other := objectstorage.ObjectLifecycleRule{
+		Name:       common.String("archive-logs"),
+		Action:     common.String("ARCHIVE"),
+		TimeAmount: common.Int64(30),
+		IsEnabled:  common.Bool(true),
+	}
+	storage := &fakeObjectStorage{lifecycle: []objectstorage.ObjectLifecycleRule{other}}
+
+	assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "machine", 14))
+	if assert.Len(t, storage.lifecycle, 2) {
+		assert.Equal(t, backupLifecycleRuleName+"-machine", *storage.lifecycle[0].Name)
+		assert.Equal(t, int64(14), *storage.lifecycle[0].TimeAmount)
+		assert.Equal(t, []string{"devpod/machine/"}, storage.lifecycle[0].ObjectNameFilter.InclusionPrefixes)
+		assert.Equal(t, other, storage.lifecycle[1])
+	}
+
+	// An unchanged rule is not written again
+	assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "machine", 14))
+	assert.Equal(t, 1, storage.calls["PutObjectLifecyclePolicy"])
+
+	assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "machine", 7))
+	assert.Equal(t, 2, storage.calls["PutObjectLifecyclePolicy"])
+	if assert.Len(t, storage.lifecycle, 2) {
+		assert.Equal(t, int64(7), *storage.lifecycle[0].TimeAmount)
+	}
+
+	// Another machine in the bucket keeps its own retention
+	assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "other-machine", 30))
+	if assert.Len(t, storage.lifecycle, 3) {
+		assert.Equal(t, []string{"devpod/other-machine/"}, storage.lifecycle[0].ObjectNameFilter.InclusionPrefixes)
+		assert.Equal(t, int64(7), *storage.lifecycle[1].TimeAmount)
+	}
+}
+
+func TestApplyBackupRetentionConcurrently(t *testing.T) {
+	storage := &fakeObjectStorage{}
+
+	// Another machine sets its retention between the read and the write
+	storage.beforeLifecycleWrite = func() {
+		storage.beforeLifecycleWrite = nil
+		assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "other-machine", 30))
+	}
+
+	assert.NoError(t, applyBackupRetention(context.Background(), storage, "namespace", "bucket", "machine", 14))
+	assert.Equal(t, 3, storage.calls["PutObjectLifecyclePolicy"])
+	if assert.Len(t, storage.lifecycle, 2) {
+		assert.Equal(t, backupLifecycleRuleName+"-machine", *storage.lifecycle[0].Name)
+		assert.Equal(t, backupLifecycleRuleName+"-other-machine", *storage.lifecycle[1].Name)
+	}
+}
+
+func TestRemoveBackupRetention(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	ctx := context.Background()
+
+	assert.NoError(t, applyBackupRetention(ctx, m.objectStorage, "namespace", m.opts.BackupBucket, "other-machine", 30))
+	assert.NoError(t, applyBackupRetention(ctx, m.objectStorage, "namespace", m.opts.BackupBucket, m.opts.MachineID, 14))
+
+	assert.NoError(t, m.RemoveBackupRetention(ctx, m.opts))
+	if assert.Len(t, m.objectStorage.lifecycle, 1) {
+		assert.Equal(t, backupLifecycleRuleName+"-other-machine", *m.objectStorage.lifecycle[0].Name)
+	}
+
+	// Removing the last rule deletes the policy, and removing it again does nothing
+	other := *m.opts
+	other.MachineID = "other-machine"
+	assert.NoError(t, m.RemoveBackupRetention(ctx, &other))
+	assert.Nil(t, m.objectStorage.lifecycle)
+	assert.Equal(t, 1, m.objectStorage.calls["DeleteObjectLifecyclePolicy"])
+
+	assert.NoError(t, m.RemoveBackupRetention(ctx, &other))
+	assert.Equal(t, 1, m.objectStorage.calls["DeleteObjectLifecyclePolicy"])
+}
+
+func TestBackupObject(t *testing.T) {
+	assert.Equal(t, "devpod/machine/nightly.tar.gz", backupObjectName("machine", "nightly"))
+	assert.Equal(t, "devpod/machine/nightly.tar.gz", backupObjectName("machine", "nightly.tar.gz"))
+	assert.Equal(t, "devpod/machine/nightly.tar.gz", backupObject("machine", "nightly"))
+	assert.Equal(t, "devpod/other/nightly.tar.gz", backupObject("machine", "devpod/other/nightly.tar.gz"))
+}
+
+func TestListBackups(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateStopped)
+	m.objectStorage.objects = map[string][]byte{
+		backupObjectName(m.opts.MachineID, "first"):  []byte("12"),
+		backupObjectName(m.opts.MachineID, "second"): []byte("1234"),
+		backupObjectName("other-machine", "third"):   []byte("1"),
+	}
+	// Names do not sort by age
+	now := time.Now()
+	m.objectStorage.created = map[string]time.Time{
+		backupObjectName(m.opts.MachineID, "first"):  now,
+		backupObjectName(m.opts.MachineID, "second"): now.Add(-time.Hour),
+	}
+
+	backups, err := m.ListBackups(context.Background(), m.opts)
+	assert.NoError(t, err)
+	if assert.Len(t, backups, 2) {
+		assert.Equal(t, backupObjectName(m.opts.MachineID, "second"), backups[0].Object)
+		assert.Equal(t, int64(4), backups[0].Size)
+		assert.Equal(t, backupObjectName(m.opts.MachineID, "first"), backups[1].Object)
+	}
+}
+
+func TestBackupNeedsRunningInstance(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateStopped)
+
+	notRunning := ErrInstanceNotRunning("instance-id", string(core.InstanceLifecycleStateStopped)).Error()
+
+	_, err := m.Backup(context.Background(), m.opts, "nightly")
+	assert.EqualError(t, err, notRunning)
+
+	err = m.RestoreBackup(context.Background(), m.opts, "nightly")
+	assert.EqualError(t, err, notRunning)
+
+	assert.Empty(t, m.objectStorage.calls)
+}
+
+func TestRestoreBackupNotFound(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+
+	err := m.RestoreBackup(context.Background(), m.opts, "missing")
+	assert.EqualError(t, err, ErrBackupObjectNotFound(backupObjectName(m.opts.MachineID, "missing"), m.opts.BackupBucket).Error())
+}
+
+func TestRestoreFromObjectUnset(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+
+	assert.NoError(t, m.RestoreFromObject(context.Background(), m.opts))
+	assert.Empty(t, m.objectStorage.calls)
+}
+
+func TestRestoreFromObjectDone(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.opts.RestoreFromObject = backupObjectName("old-machine", "nightly")
+	assert.NoError(t, saveState(m.opts.MachineFolder, &machineState{
+		InstanceID:     "instance-id",
+		RestoredObject: m.opts.RestoreFromObject,
+	}))
+
+	assert.NoError(t, m.RestoreFromObject(context.Background(), m.opts))
+	assert.Empty(t, m.objectStorage.calls)
+}
+
+func TestRestoredObjectSurvivesRelaunch(t *testing.T) {
+	opts := &options.Options{MachineFolder: t.TempDir()}
+	assert.NoError(t, saveState(opts.MachineFolder, &machineState{RestoredObject: "devpod/machine/nightly.tar.gz"}))
+
+	// Unparking launches a new instance
+	(&Oracle{}).recordInstance(context.Background(), opts, &core.Instance{
+		Id:             common.String("relaunched-id"),
+		LifecycleState: core.InstanceLifecycleStateProvisioning,
+	})
+
+	state := loadState(opts.MachineFolder)
+	assert.Equal(t, "relaunched-id", state.InstanceID)
+	assert.Equal(t, "devpod/machine/nightly.tar.gz", state.RestoredObject)
+}
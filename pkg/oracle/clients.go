@@ -0,0 +1,156 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/filestorage"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+	"github.com/oracle/oci-go-sdk/v65/keymanagement"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
+)
+
+// The OCI SDK exposes concrete clients only. These interfaces list the calls
+// the provider makes so that tests can substitute a fake backend.
+
+type computeAPI interface {
+	AttachVolume(ctx context.Context, request core.AttachVolumeRequest) (core.AttachVolumeResponse, error)
+	CreateImage(ctx context.Context, request core.CreateImageRequest) (core.CreateImageResponse, error)
+	GetComputeCapacityReservation(
+		ctx context.Context, request core.GetComputeCapacityReservationRequest,
+	) (core.GetComputeCapacityReservationResponse, error)
+	GetDedicatedVmHost(ctx context.Context, request core.GetDedicatedVmHostRequest) (core.GetDedicatedVmHostResponse, error)
+	GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error)
+	GetInstance(ctx context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error)
+	InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error)
+	LaunchInstance(ctx context.Context, request core.LaunchInstanceRequest) (core.LaunchInstanceResponse, error)
+	ListDedicatedVmHostInstanceShapes(
+		ctx context.Context, request core.ListDedicatedVmHostInstanceShapesRequest,
+	) (core.ListDedicatedVmHostInstanceShapesResponse, error)
+	ListBootVolumeAttachments(ctx context.Context, request core.ListBootVolumeAttachmentsRequest) (core.ListBootVolumeAttachmentsResponse, error)
+	ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error)
+	ListShapes(ctx context.Context, request core.ListShapesRequest) (core.ListShapesResponse, error)
+	ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error)
+	ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error)
+	ListVolumeAttachments(ctx context.Context, request core.ListVolumeAttachmentsRequest) (core.ListVolumeAttachmentsResponse, error)
+	TerminateInstance(ctx context.Context, request core.TerminateInstanceRequest) (core.TerminateInstanceResponse, error)
+	UpdateInstance(ctx context.Context, request core.UpdateInstanceRequest) (core.UpdateInstanceResponse, error)
+}
+
+type networkAPI interface {
+	AddNetworkSecurityGroupSecurityRules(
+		ctx context.Context, request core.AddNetworkSecurityGroupSecurityRulesRequest,
+	) (core.AddNetworkSecurityGroupSecurityRulesResponse, error)
+	CreateInternetGateway(ctx context.Context, request core.CreateInternetGatewayRequest) (core.CreateInternetGatewayResponse, error)
+	CreateNetworkSecurityGroup(
+		ctx context.Context, request core.CreateNetworkSecurityGroupRequest,
+	) (core.CreateNetworkSecurityGroupResponse, error)
+	CreateRouteTable(ctx context.Context, request core.CreateRouteTableRequest) (core.CreateRouteTableResponse, error)
+	CreateSubnet(ctx context.Context, request core.CreateSubnetRequest) (core.CreateSubnetResponse, error)
+	CreateVcn(ctx context.Context, request core.CreateVcnRequest) (core.CreateVcnResponse, error)
+	DeleteInternetGateway(ctx context.Context, request core.DeleteInternetGatewayRequest) (core.DeleteInternetGatewayResponse, error)
+	DeleteNetworkSecurityGroup(
+		ctx context.Context, request core.DeleteNetworkSecurityGroupRequest,
+	) (core.DeleteNetworkSecurityGroupResponse, error)
+	DeleteRouteTable(ctx context.Context, request core.DeleteRouteTableRequest) (core.DeleteRouteTableResponse, error)
+	DeleteSubnet(ctx context.Context, request core.DeleteSubnetRequest) (core.DeleteSubnetResponse, error)
+	DeleteVcn(ctx context.Context, request core.DeleteVcnRequest) (core.DeleteVcnResponse, error)
+	GetInternetGateway(ctx context.Context, request core.GetInternetGatewayRequest) (core.GetInternetGatewayResponse, error)
+	GetNetworkSecurityGroup(ctx context.Context, request core.GetNetworkSecurityGroupRequest) (core.GetNetworkSecurityGroupResponse, error)
+	GetPrivateIp(ctx context.Context, request core.GetPrivateIpRequest) (core.GetPrivateIpResponse, error)
+	GetRouteTable(ctx context.Context, request core.GetRouteTableRequest) (core.GetRouteTableResponse, error)
+	GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error)
+	GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error)
+	ListInternetGateways(ctx context.Context, request core.ListInternetGatewaysRequest) (core.ListInternetGatewaysResponse, error)
+	ListNetworkSecurityGroups(
+		ctx context.Context, request core.ListNetworkSecurityGroupsRequest,
+	) (core.ListNetworkSecurityGroupsResponse, error)
+	ListNetworkSecurityGroupSecurityRules(
+		ctx context.Context, request core.ListNetworkSecurityGroupSecurityRulesRequest,
+	) (core.ListNetworkSecurityGroupSecurityRulesResponse, error)
+	ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error)
+	ListRouteTables(ctx context.Context, request core.ListRouteTablesRequest) (core.ListRouteTablesResponse, error)
+	ListSubnets(ctx context.Context, request core.ListSubnetsRequest) (core.ListSubnetsResponse, error)
+	ListVcns(ctx context.Context, request core.ListVcnsRequest) (core.ListVcnsResponse, error)
+	UpdateVnic(ctx context.Context, request core.UpdateVnicRequest) (core.UpdateVnicResponse, error)
+}
+
+type identityAPI interface {
+	ListAvailabilityDomains(ctx context.Context, request identity.ListAvailabilityDomainsRequest) (identity.ListAvailabilityDomainsResponse, error)
+}
+
+type blockstorageAPI interface {
+	CreateBootVolume(ctx context.Context, request core.CreateBootVolumeRequest) (core.CreateBootVolumeResponse, error)
+	CreateBootVolumeBackup(ctx context.Context, request core.CreateBootVolumeBackupRequest) (core.CreateBootVolumeBackupResponse, error)
+	CreateVolume(ctx context.Context, request core.CreateVolumeRequest) (core.CreateVolumeResponse, error)
+	CreateVolumeBackup(ctx context.Context, request core.CreateVolumeBackupRequest) (core.CreateVolumeBackupResponse, error)
+	DeleteBootVolume(ctx context.Context, request core.DeleteBootVolumeRequest) (core.DeleteBootVolumeResponse, error)
+	DeleteBootVolumeBackup(ctx context.Context, request core.DeleteBootVolumeBackupRequest) (core.DeleteBootVolumeBackupResponse, error)
+	DeleteVolume(ctx context.Context, request core.DeleteVolumeRequest) (core.DeleteVolumeResponse, error)
+	DeleteVolumeBackup(ctx context.Context, request core.DeleteVolumeBackupRequest) (core.DeleteVolumeBackupResponse, error)
+	GetBootVolume(ctx context.Context, request core.GetBootVolumeRequest) (core.GetBootVolumeResponse, error)
+	GetBootVolumeBackup(ctx context.Context, request core.GetBootVolumeBackupRequest) (core.GetBootVolumeBackupResponse, error)
+	GetVolume(ctx context.Context, request core.GetVolumeRequest) (core.GetVolumeResponse, error)
+	GetVolumeBackup(ctx context.Context, request core.GetVolumeBackupRequest) (core.GetVolumeBackupResponse, error)
+	ListBootVolumeBackups(ctx context.Context, request core.ListBootVolumeBackupsRequest) (core.ListBootVolumeBackupsResponse, error)
+	ListVolumeBackups(ctx context.Context, request core.ListVolumeBackupsRequest) (core.ListVolumeBackupsResponse, error)
+	ListVolumes(ctx context.Context, request core.ListVolumesRequest) (core.ListVolumesResponse, error)
+	UpdateBootVolume(ctx context.Context, request core.UpdateBootVolumeRequest) (core.UpdateBootVolumeResponse, error)
+	UpdateVolume(ctx context.Context, request core.UpdateVolumeRequest) (core.UpdateVolumeResponse, error)
+}
+
+type fileStorageAPI interface {
+	CreateExport(ctx context.Context, request filestorage.CreateExportRequest) (filestorage.CreateExportResponse, error)
+	CreateFileSystem(ctx context.Context, request filestorage.CreateFileSystemRequest) (filestorage.CreateFileSystemResponse, error)
+	CreateMountTarget(ctx context.Context, request filestorage.CreateMountTargetRequest) (filestorage.CreateMountTargetResponse, error)
+	GetFileSystem(ctx context.Context, request filestorage.GetFileSystemRequest) (filestorage.GetFileSystemResponse, error)
+	GetMountTarget(ctx context.Context, request filestorage.GetMountTargetRequest) (filestorage.GetMountTargetResponse, error)
+	ListExports(ctx context.Context, request filestorage.ListExportsRequest) (filestorage.ListExportsResponse, error)
+	ListFileSystems(ctx context.Context, request filestorage.ListFileSystemsRequest) (filestorage.ListFileSystemsResponse, error)
+	ListMountTargets(ctx context.Context, request filestorage.ListMountTargetsRequest) (filestorage.ListMountTargetsResponse, error)
+}
+
+type kmsVaultAPI interface {
+	ListVaults(ctx context.Context, request keymanagement.ListVaultsRequest) (keymanagement.ListVaultsResponse, error)
+}
+
+type kmsManagementAPI interface {
+	GetKey(ctx context.Context, request keymanagement.GetKeyRequest) (keymanagement.GetKeyResponse, error)
+}
+
+type objectStorageAPI interface {
+	AbortMultipartUpload(ctx context.Context, request objectstorage.AbortMultipartUploadRequest) (objectstorage.AbortMultipartUploadResponse, error)
+	CommitMultipartUpload(ctx context.Context, request objectstorage.CommitMultipartUploadRequest) (objectstorage.CommitMultipartUploadResponse, error)
+	CreateBucket(ctx context.Context, request objectstorage.CreateBucketRequest) (objectstorage.CreateBucketResponse, error)
+	CreateMultipartUpload(ctx context.Context, request objectstorage.CreateMultipartUploadRequest) (objectstorage.CreateMultipartUploadResponse, error)
+	DeleteObjectLifecyclePolicy(
+		ctx context.Context, request objectstorage.DeleteObjectLifecyclePolicyRequest,
+	) (objectstorage.DeleteObjectLifecyclePolicyResponse, error)
+	GetBucket(ctx context.Context, request objectstorage.GetBucketRequest) (objectstorage.GetBucketResponse, error)
+	GetNamespace(ctx context.Context, request objectstorage.GetNamespaceRequest) (objectstorage.GetNamespaceResponse, error)
+	GetObject(ctx context.Context, request objectstorage.GetObjectRequest) (objectstorage.GetObjectResponse, error)
+	GetObjectLifecyclePolicy(
+		ctx context.Context, request objectstorage.GetObjectLifecyclePolicyRequest,
+	) (objectstorage.GetObjectLifecyclePolicyResponse, error)
+	ListObjects(ctx context.Context, request objectstorage.ListObjectsRequest) (objectstorage.ListObjectsResponse, error)
+	PutObjectLifecyclePolicy(
+		ctx context.Context, request objectstorage.PutObjectLifecyclePolicyRequest,
+	) (objectstorage.PutObjectLifecyclePolicyResponse, error)
+	UploadPart(ctx context.Context, request objectstorage.UploadPartRequest) (objectstorage.UploadPartResponse, error)
+}
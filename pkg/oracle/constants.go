@@ -1,15 +1,95 @@
 package oracle
 
+import "time"
+
 const (
 	// Labels
 	labelMachineID = "machine-id"
 	labelType      = "type"
+	labelVolume    = "volume"
+	labelSnapshot  = "snapshot"
+	labelPool      = "pool"
+
+	labelProviderVersion = "provider-version"
+	labelBaseImage       = "base-image"
 
 	// Label values
-	labelTypeDevPod = "devpod"
+	labelTypeDevPod   = "devpod"
+	labelVolumeHome   = "home"
+	labelVolumeDocker = "docker"
+
+	// Files in the machine folder
+	stateFile = "state.json"
+
+	// Locks
+	lockDirName        = "devpod-provider-oracle"
+	machineLockFile    = "machine.lock"
+	networkLockTimeout = 5 * time.Minute
+
+	// Network
+	networkVCNName              = "devpod-vcn"
+	networkInternetGatewayName  = "devpod-ig"
+	networkRouteTableName       = "devpod-rt"
+	networkSubnetName           = "devpod-subnet"
+	networkNFSSecurityGroupName = "devpod-nfs"
+
+	// IP protocol numbers for security rules
+	protocolTCP = "6"
+	protocolUDP = "17"
+
+	// Shared file system. The names are those created for
+	// FSS_MOUNT_TARGET=auto. cloud-config.yaml marks the fstab entry for it
+	// with sharedFstabOption, which mount ignores, so it can be found again.
+	sharedFileSystemName  = "devpod-shared"
+	sharedMountTargetName = "devpod-shared"
+	sharedFstabOption     = "x-devpod-shared"
+
+	// Volumes. Consistent device naming gives paravirtualized attachments a
+	// stable path in the guest.
+	bootVolumeDevice   = "/dev/oracleoci/oraclevda"
+	homeVolumeDevice   = "/dev/oracleoci/oraclevdb"
+	dockerVolumeDevice = "/dev/oracleoci/oraclevdc"
+	maxVolumeSizeInGBs = 32768
+
+	// The first local NVMe drive of a DenseIO shape
+	dockerNVMeDevice = "/dev/nvme0n1"
+
+	// Warm pool. A claimed instance finds the workspace's SSH key under this
+	// instance metadata key.
+	poolClaimKeyMetadata = "devpod_authorized_key"
+
+	// Backups go under devpod/<machine ID>/ in the bucket, uploaded in parts
+	// of 64 MiB. With at most 10000 parts, that allows archives of 640 GiB.
+	workspaceHome           = "/home/devpod"
+	backupObjectPrefix      = "devpod/"
+	backupObjectSuffix      = ".tar.gz"
+	backupLifecycleRuleName = "devpod-backup-retention"
+	backupPartSize          = 64 << 20
+
+	// The bucket lifecycle policy is written back whole, and the write is
+	// retried this often when another machine changed it in between
+	maxLifecyclePolicyAttempts = 5
+
+	// Resize. OCI bills a month as 744 hours.
+	hoursPerMonth = 744
+
+	// Pagination guards against a misbehaving API returning pages forever
+	maxListPages = 1000
+
+	// Polling
+	deletePollInterval    = 2 * time.Second
+	maxDeletePollAttempts = 150
+	instancePollInterval  = 5 * time.Second
+	backupPollInterval    = 10 * time.Second
+
+	// SSH
+	sshUser               = "devpod"
+	sshKeyDir             = ".ssh"
+	sshPrivateKeyFile     = "id_rsa"
+	preStopCommandTimeout = 5 * time.Minute
 
 	// Errors
 	errMissingMachineID = "missing machine id"
 	errMissingServer    = "missing server"
 	errMissingVolume    = "missing volume"
-) 
\ No newline at end of file
+)
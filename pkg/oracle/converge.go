@@ -0,0 +1,190 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/lock"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// resourceKey returns the OCID and creation time of a resource
+type resourceKey[T any] func(T) (id *string, created *common.SDKTime)
+
+func vcnKey(v core.Vcn) (id *string, created *common.SDKTime) {
+	return v.Id, v.TimeCreated
+}
+
+func internetGatewayKey(i core.InternetGateway) (id *string, created *common.SDKTime) {
+	return i.Id, i.TimeCreated
+}
+
+func routeTableKey(r core.RouteTable) (id *string, created *common.SDKTime) {
+	return r.Id, r.TimeCreated
+}
+
+func subnetKey(s core.Subnet) (id *string, created *common.SDKTime) {
+	return s.Id, s.TimeCreated
+}
+
+// oldest returns the resource that was created first, or nil if there are
+// none. Ties are broken on the OCID so that every caller picks the same one.
+func oldest[T any](items []T, key resourceKey[T]) *T {
+	var winner *T
+
+	for i := range items {
+		if winner == nil || createdBefore(items[i], *winner, key) {
+			winner = &items[i]
+		}
+	}
+
+	return winner
+}
+
+func createdBefore[T any](a, b T, key resourceKey[T]) bool {
+	aID, aCreated := key(a)
+	bID, bCreated := key(b)
+
+	aTime := time.Time{}
+	if aCreated != nil {
+		aTime = aCreated.Time
+	}
+	bTime := time.Time{}
+	if bCreated != nil {
+		bTime = bCreated.Time
+	}
+
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+
+	return *aID < *bID
+}
+
+// converge settles concurrent creates of the same resource on the oldest
+// one. If the resource this process created lost, it is deleted so that the
+// duplicate does not linger.
+func converge[T any](kind string, created T, found []T, key resourceKey[T], remove func(id *string) error) *T {
+	createdID, _ := key(created)
+
+	candidates := []T{created}
+	for _, f := range found {
+		if id, _ := key(f); *id != *createdID {
+			candidates = append(candidates, f)
+		}
+	}
+
+	winner := oldest(candidates, key)
+	winnerID, _ := key(*winner)
+
+	if *winnerID != *createdID {
+		log.Default.Infof("Another %s was created concurrently - using %s and deleting %s", kind, *winnerID, *createdID)
+		if err := remove(createdID); err != nil && !IsNotFound(err) {
+			log.Default.Warnf("Unable to delete duplicate %s %s: %v", kind, *createdID, err)
+		}
+	}
+
+	return winner
+}
+
+// createWithRetryToken creates a resource with a retry token shared by every
+// process racing to create it, so OCI returns the same resource to all of
+// them. A token is only honoured while the request is identical and the
+// original resource exists, so the create is repeated without one if the
+// token conflicts or replays a resource that has since been deleted.
+func createWithRetryToken[T any](token string, create func(token *string) (T, error), terminal func(T) bool) (T, error) {
+	created, err := create(&token)
+	if err == nil && !terminal(created) {
+		return created, nil
+	}
+	if err != nil && !isConflict(err) {
+		return created, err
+	}
+
+	log.Default.Debug("Retry token cannot be used - creating without it")
+
+	return create(nil)
+}
+
+// networkRetryToken is deterministic for a resource and its parent, so
+// parallel creates on different hosts get the same resource while OCI keeps
+// the token. The network lock and converging on the oldest resource cover
+// the rest, and a token that replays a deleted resource is dropped by
+// createWithRetryToken.
+func networkRetryToken(kind, parentID string) string {
+	return retryToken("network", kind, parentID)
+}
+
+func isConflict(err error) bool {
+	var serviceErr common.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.GetHTTPStatusCode() == 409
+	}
+	return false
+}
+
+// lockNetwork serialises network changes in a compartment between provider
+// processes on this host
+func lockNetwork(ctx context.Context, compartmentID string) (*lock.Lock, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	path := filepath.Join(dir, lockDirName, "network-"+retryToken(compartmentID)[:16]+".lock")
+
+	log.Default.Debugf("Waiting for network lock: %s", path)
+
+	return lock.Acquire(ctx, path, networkLockTimeout)
+}
+
+// LockMachine serialises lifecycle commands on a machine, so that for example
+// a start from the UI cannot run against an instance the CLI is deleting. The
+// returned function releases the lock.
+func LockMachine(ctx context.Context, opts *options.Options) (func(), error) {
+	path := filepath.Join(opts.MachineFolder, machineLockFile)
+
+	l, err := lock.Acquire(ctx, path, 0)
+	if errors.Is(err, lock.ErrLocked) && opts.LockTimeout > 0 {
+		log.Default.Infof("Waiting up to %s for another operation on %s to finish", opts.LockTimeout, opts.MachineID)
+		l, err = lock.Acquire(ctx, path, opts.LockTimeout)
+	}
+
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		return nil, ErrOperationInProgress(opts.MachineID, held.PID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { releaseLock(l) }, nil
+}
+
+func releaseLock(l *lock.Lock) {
+	if err := l.Release(); err != nil {
+		log.Default.Warnf("Unable to release lock: %v", err)
+	}
+}
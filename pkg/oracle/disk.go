@@ -0,0 +1,171 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"strings"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// GrowDisk grows the boot volume, or the home volume if home is set, of the
+// running instance to sizeInGBs and waits for OCI to finish the resize.
+// Volumes can only grow. A volume that already has the size is left alone, so
+// that the command can be run again when growing the filesystem failed.
+// GrowFilesystem then makes the guest use the space.
+func (o *Oracle) GrowDisk(ctx context.Context, opts *options.Options, home bool, sizeInGBs int) error {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning {
+		return ErrInstanceNotRunning(*instance.Id, string(instance.LifecycleState))
+	}
+
+	if home {
+		return o.growHomeVolume(ctx, opts, sizeInGBs)
+	}
+
+	bootVolumeID, err := o.getBootVolumeID(ctx, instance)
+	if err != nil {
+		return errors.Wrap(err, "find boot volume")
+	}
+
+	volume, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{BootVolumeId: &bootVolumeID})
+	if err != nil {
+		return err
+	}
+	if err := checkGrowth("boot", volume.SizeInGBs, sizeInGBs); err != nil {
+		return err
+	}
+	if *volume.SizeInGBs == int64(sizeInGBs) {
+		log.Default.Infof("Boot volume %s is already %d GB", bootVolumeID, sizeInGBs)
+		return nil
+	}
+
+	log.Default.Infof("Growing boot volume %s from %d GB to %d GB", bootVolumeID, *volume.SizeInGBs, sizeInGBs)
+
+	_, err = o.blockstorageClient.UpdateBootVolume(ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId:            &bootVolumeID,
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{SizeInGBs: common.Int64(int64(sizeInGBs))},
+	})
+	if err != nil {
+		return err
+	}
+
+	return o.waitForAvailable(ctx, opts, "boot volume", func(ctx context.Context) (string, error) {
+		response, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{BootVolumeId: &bootVolumeID})
+		return string(response.LifecycleState), err
+	})
+}
+
+func (o *Oracle) growHomeVolume(ctx context.Context, opts *options.Options, sizeInGBs int) error {
+	volume, err := o.homeVolume(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if volume == nil {
+		return MissingVolume()
+	}
+	if err := checkGrowth("home", volume.SizeInGBs, sizeInGBs); err != nil {
+		return err
+	}
+	if *volume.SizeInGBs == int64(sizeInGBs) {
+		log.Default.Infof("Home volume %s is already %d GB", *volume.Id, sizeInGBs)
+		return nil
+	}
+
+	log.Default.Infof("Growing home volume %s from %d GB to %d GB", *volume.Id, *volume.SizeInGBs, sizeInGBs)
+
+	_, err = o.blockstorageClient.UpdateVolume(ctx, core.UpdateVolumeRequest{
+		VolumeId:            volume.Id,
+		UpdateVolumeDetails: core.UpdateVolumeDetails{SizeInGBs: common.Int64(int64(sizeInGBs))},
+	})
+	if err != nil {
+		return err
+	}
+
+	return o.waitForAvailable(ctx, opts, "home volume", func(ctx context.Context) (string, error) {
+		response, err := o.blockstorageClient.GetVolume(ctx, core.GetVolumeRequest{VolumeId: volume.Id})
+		return string(response.LifecycleState), err
+	})
+}
+
+// GrowFilesystem makes the guest pick up the new size of the boot or home
+// volume and grows the partition and filesystem on it
+func (o *Oracle) GrowFilesystem(ctx context.Context, opts *options.Options, home bool) error {
+	log.Default.Info("Growing the filesystem on the instance")
+
+	writer := log.Default.Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	return o.RunCommand(ctx, opts, growFilesystemCommand(home), writer, writer)
+}
+
+// growFilesystemCommand rescans the paravirtualized volume and grows its
+// filesystem. The home volume is formatted whole, without a partition.
+// Oracle Linux keeps root on LVM, which its oci-growfs tool handles; other
+// images have root on a partition with XFS or ext4. growpart exits with 1
+// when the partition already fills the disk.
+func growFilesystemCommand(home bool) string {
+	device := bootVolumeDevice
+	if home {
+		device = homeVolumeDevice
+	}
+
+	lines := []string{
+		"set -e",
+		"dev=$(readlink -f " + device + ")",
+		"sudo dd iflag=direct if=\"$dev\" of=/dev/null count=1 status=none",
+		"echo 1 | sudo tee \"/sys/class/block/$(basename \"$dev\")/device/rescan\" >/dev/null",
+	}
+
+	if home {
+		lines = append(lines, "sudo resize2fs \"$dev\"")
+	} else {
+		lines = append(lines,
+			"if [ -x /usr/libexec/oci-growfs ]; then sudo /usr/libexec/oci-growfs -y; exit 0; fi",
+			"root=$(findmnt -n -o SOURCE /)",
+			"sudo growpart \"$dev\" \"$(cat /sys/class/block/$(basename \"$root\")/partition)\" || [ $? -eq 1 ]",
+			"case $(findmnt -n -o FSTYPE /) in",
+			"  xfs) sudo xfs_growfs / ;;",
+			"  ext*) sudo resize2fs \"$root\" ;;",
+			"  *) echo \"cannot grow the $(findmnt -n -o FSTYPE /) root filesystem\" >&2; exit 1 ;;",
+			"esac",
+		)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// checkGrowth returns an error if the volume would shrink or exceed the OCI
+// limit
+func checkGrowth(kind string, current *int64, sizeInGBs int) error {
+	var size int64
+	if current != nil {
+		size = *current
+	}
+	if int64(sizeInGBs) < size || sizeInGBs > maxVolumeSizeInGBs {
+		return ErrVolumeSize(kind, size, sizeInGBs)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrowDisk(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+
+	assert.NoError(t, m.GrowDisk(context.Background(), m.opts, false, 200))
+	assert.Equal(t, int64(200), *m.blockstorage.bootVolumes[0].SizeInGBs)
+	assert.Equal(t, int64(100), *m.blockstorage.volumes[0].SizeInGBs)
+
+	assert.NoError(t, m.GrowDisk(context.Background(), m.opts, true, 500))
+	assert.Equal(t, int64(500), *m.blockstorage.volumes[0].SizeInGBs)
+
+	// Running it again only leaves the filesystem to grow
+	assert.NoError(t, m.GrowDisk(context.Background(), m.opts, false, 200))
+	assert.NoError(t, m.GrowDisk(context.Background(), m.opts, true, 500))
+	assert.Equal(t, 1, m.blockstorage.calls["UpdateBootVolume"])
+	assert.Equal(t, 1, m.blockstorage.calls["UpdateVolume"])
+}
+
+func TestGrowDiskInvalid(t *testing.T) {
+	tests := []struct {
+		Name     string
+		State    core.InstanceLifecycleStateEnum
+		Home     bool
+		Size     int
+		Modify   func(opts *options.Options, blockstorage *fakeBlockstorage)
+		Expected string
+	}{
+		{
+			Name:     "stopped instance",
+			State:    core.InstanceLifecycleStateStopped,
+			Size:     200,
+			Expected: "instance instance-id is STOPPED - start it first",
+		},
+		{
+			Name:     "shrink boot volume",
+			State:    core.InstanceLifecycleStateRunning,
+			Size:     40,
+			Expected: "cannot grow the boot volume from 50 GB to 40 GB: volumes can only grow, up to 32768 GB",
+		},
+		{
+			Name:     "home volume too large",
+			State:    core.InstanceLifecycleStateRunning,
+			Home:     true,
+			Size:     40000,
+			Expected: "cannot grow the home volume from 100 GB to 40000 GB: volumes can only grow, up to 32768 GB",
+		},
+		{
+			Name:  "no home volume",
+			State: core.InstanceLifecycleStateRunning,
+			Home:  true,
+			Size:  200,
+			Modify: func(_ *options.Options, blockstorage *fakeBlockstorage) {
+				blockstorage.volumes = nil
+			},
+			Expected: errMissingVolume,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			m := newFakeMachine(t, test.State)
+			if test.Modify != nil {
+				test.Modify(m.opts, m.blockstorage)
+			}
+
+			err := m.GrowDisk(context.Background(), m.opts, test.Home, test.Size)
+
+			assert.EqualError(t, err, test.Expected)
+			assert.Zero(t, m.blockstorage.calls["UpdateBootVolume"]+m.blockstorage.calls["UpdateVolume"])
+		})
+	}
+}
+
+func TestGrowFilesystemCommand(t *testing.T) {
+	boot := growFilesystemCommand(false)
+	assert.Contains(t, boot, "readlink -f "+bootVolumeDevice)
+	assert.Contains(t, boot, "/usr/libexec/oci-growfs -y")
+	assert.Contains(t, boot, "sudo growpart")
+	assert.Contains(t, boot, "xfs_growfs")
+
+	home := growFilesystemCommand(true)
+	assert.Contains(t, home, "readlink -f "+homeVolumeDevice)
+	assert.Contains(t, home, "sudo resize2fs \"$dev\"")
+	assert.NotContains(t, home, "growpart")
+}
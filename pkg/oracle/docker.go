@@ -0,0 +1,64 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// dockerDataDevice returns the device that cloud-init mounts for the Docker
+// data-root, or "" to keep Docker data on the boot volume
+func dockerDataDevice(opts *options.Options) string {
+	switch opts.DockerData {
+	case options.DockerDataBlock:
+		return dockerVolumeDevice
+	case options.DockerDataNVMe:
+		return dockerNVMeDevice
+	default:
+		return ""
+	}
+}
+
+// validateDockerData checks that the shape has local NVMe drives when Docker
+// data is to be kept on them
+func (o *Oracle) validateDockerData(ctx context.Context, opts *options.Options) error {
+	if opts.DockerData != options.DockerDataNVMe {
+		return nil
+	}
+
+	shapes, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Shape, *string, error) {
+		response, err := o.computeClient.ListShapes(ctx, core.ListShapesRequest{
+			CompartmentId:      &opts.CompartmentID,
+			AvailabilityDomain: &opts.AvailabilityDomain,
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "list shapes")
+	}
+
+	shape := findShape(shapes, opts.MachineType)
+	if shape == nil || shape.LocalDisks == nil || *shape.LocalDisks == 0 {
+		return ErrPlatformShape(opts.MachineType, "local NVMe drives for DOCKER_DATA=nvme")
+	}
+
+	return nil
+}
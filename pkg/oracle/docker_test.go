@@ -0,0 +1,187 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func dockerDataOptions(t *testing.T, dockerData string) *options.Options {
+	return &options.Options{
+		MachineID:          "test-machine-id",
+		MachineFolder:      t.TempDir(),
+		CompartmentID:      "compartment-id",
+		AvailabilityDomain: "AD-1",
+		MachineType:        "VM.DenseIO.E4.Flex",
+		HomeVolumeSize:     50,
+		DockerData:         dockerData,
+		DockerDataSize:     200,
+	}
+}
+
+func TestAttachVolumesDockerData(t *testing.T) {
+	for _, dockerData := range []string{options.DockerDataBoot, options.DockerDataNVMe, options.DockerDataBlock} {
+		t.Run(dockerData, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{}
+			blockstorage := &fakeBlockstorage{}
+			o := &Oracle{computeClient: compute, blockstorageClient: blockstorage}
+			opts := dockerDataOptions(t, dockerData)
+
+			err := o.AttachVolumes(context.Background(), opts, &core.Instance{
+				Id:                 common.String("instance-id"),
+				CompartmentId:      common.String("compartment-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				LifecycleState:     core.InstanceLifecycleStateRunning,
+			})
+			assert.NoError(err)
+
+			devices := map[string]string{}
+			for _, a := range compute.volumeAttachments {
+				devices[*a.GetVolumeId()] = *a.(core.ParavirtualizedVolumeAttachment).Device
+			}
+
+			docker, err := o.machineVolume(context.Background(), opts, labelVolumeDocker)
+			assert.NoError(err)
+			if dockerData != options.DockerDataBlock {
+				assert.Nil(docker)
+				assert.Len(devices, 1)
+				return
+			}
+
+			if assert.NotNil(docker) {
+				assert.Equal(int64(200), *docker.SizeInGBs)
+				assert.Equal(labelVolumeDocker, docker.FreeformTags[labelVolume])
+				assert.Equal(dockerVolumeDevice, devices[*docker.Id])
+			}
+			assert.Len(devices, 2)
+
+			// The volume goes with the machine, even if DOCKER_DATA changed
+			opts.DockerData = options.DockerDataBoot
+			assert.NoError(o.deleteVolumes(context.Background(), opts))
+			assert.Equal(2, blockstorage.calls["DeleteVolume"])
+			docker, err = o.machineVolume(context.Background(), opts, labelVolumeDocker)
+			assert.NoError(err)
+			assert.Nil(docker)
+		})
+	}
+}
+
+func TestDeleteNoWaitDockerVolume(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.opts.HomeVolumeSize = 0
+	m.opts.DockerData = options.DockerDataBlock
+	m.blockstorage.volumes = []core.Volume{{
+		Id:             common.String("docker-volume-id"),
+		DisplayName:    common.String(volumeName(m.opts.MachineID, labelVolumeDocker)),
+		LifecycleState: core.VolumeLifecycleStateAvailable,
+		FreeformTags:   map[string]string{labelMachineID: m.opts.MachineID},
+	}}
+
+	// delete --no-wait still waits for the instance to release the volume
+	assert.NoError(t, m.DeleteInstance(context.Background(), m.opts, false))
+	assert.Equal(t, core.VolumeLifecycleStateTerminated, m.blockstorage.volumes[0].LifecycleState)
+}
+
+func TestDeleteNoWaitWithoutVolumes(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.blockstorage.volumes = nil
+
+	assert.NoError(t, m.DeleteInstance(context.Background(), m.opts, false))
+	assert.Equal(t, 1, m.compute.calls["TerminateInstance"])
+	assert.Zero(t, m.compute.calls["GetInstance"])
+}
+
+func TestGenerateCloudConfigDockerData(t *testing.T) {
+	assert := assert.New(t)
+	o := &Oracle{}
+
+	devices := map[string]string{
+		options.DockerDataBoot:  "",
+		options.DockerDataBlock: dockerVolumeDevice,
+		options.DockerDataNVMe:  dockerNVMeDevice,
+	}
+	for dockerData, device := range devices {
+		config, err := o.generateCloudConfig("ssh-ed25519 AAAA", &options.Options{DockerData: dockerData}, false, "")
+		assert.NoError(err)
+
+		var parsed map[string]interface{}
+		assert.NoError(yaml.Unmarshal([]byte(config), &parsed))
+		assert.Equal(device != "", strings.Contains(config, "/usr/local/bin/devpod-docker-data"), dockerData)
+		if device != "" {
+			assert.Contains(config, device, dockerData)
+		}
+	}
+}
+
+func TestValidateDockerData(t *testing.T) {
+	shapes := []core.Shape{
+		{Shape: common.String("VM.DenseIO.E4.Flex"), LocalDisks: common.Int(1)},
+		{Shape: common.String("VM.Standard.E4.Flex"), LocalDisks: common.Int(0)},
+		{Shape: common.String("VM.Standard.A1.Flex")},
+	}
+
+	tests := []struct {
+		Name       string
+		DockerData string
+		Shape      string
+		Error      error
+	}{
+		{Name: "boot on any shape", DockerData: options.DockerDataBoot, Shape: "VM.Standard.A1.Flex"},
+		{Name: "block on any shape", DockerData: options.DockerDataBlock, Shape: "VM.Standard.A1.Flex"},
+		{Name: "nvme on a DenseIO shape", DockerData: options.DockerDataNVMe, Shape: "VM.DenseIO.E4.Flex"},
+		{
+			Name:       "nvme without local disks",
+			DockerData: options.DockerDataNVMe,
+			Shape:      "VM.Standard.E4.Flex",
+			Error:      ErrPlatformShape("VM.Standard.E4.Flex", "local NVMe drives for DOCKER_DATA=nvme"),
+		},
+		{
+			Name:       "nvme on an unlisted shape",
+			DockerData: options.DockerDataNVMe,
+			Shape:      "VM.Unknown",
+			Error:      ErrPlatformShape("VM.Unknown", "local NVMe drives for DOCKER_DATA=nvme"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{shapes: shapes}
+			o := &Oracle{computeClient: compute}
+			opts := dockerDataOptions(t, test.DockerData)
+			opts.MachineType = test.Shape
+
+			err := o.validateDockerData(context.Background(), opts)
+			if test.Error == nil {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, test.Error.Error())
+			}
+			assert.Equal(test.DockerData == options.DockerDataNVMe, compute.calls["ListShapes"] > 0)
+		})
+	}
+}
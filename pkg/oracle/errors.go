@@ -4,24 +4,117 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/oracle/oci-go-sdk/v65/common"
 )
 
+var (
+	ErrMultipleInstancesFound = func(name string) error {
+		return fmt.Errorf("multiple live instances with name %s found", name)
+	}
+	ErrNetworkInUse = func(subnetID string, vnics int) error {
+		return fmt.Errorf("subnet %s still has %d non-devpod VNIC(s) attached", subnetID, vnics)
+	}
+
+	ErrMultipleVolumesFound = func(name string) error {
+		return fmt.Errorf("multiple volumes with name %s found", name)
+	}
+	ErrVolumeInOtherAvailabilityDomain = func(volumeID, availabilityDomain string) error {
+		return fmt.Errorf("volume %s is in availability domain %s - launch the instance there or move the volume", volumeID, availabilityDomain)
+	}
+	ErrPlacementNotActive = func(kind, id, state string) error {
+		return fmt.Errorf("%s %s is %s, not ACTIVE", kind, id, state)
+	}
+	ErrPlacementAvailabilityDomain = func(kind, id, availabilityDomain string) error {
+		return fmt.Errorf("%s %s is in availability domain %s - set AVAILABILITY_DOMAIN to match", kind, id, availabilityDomain)
+	}
+	ErrPlacementShape = func(kind, id, shape, supported string) error {
+		return fmt.Errorf("%s %s cannot run shape %s (supported: %s)", kind, id, shape, supported)
+	}
+	ErrCapacityReservationFaultDomain = func(id, shape, faultDomains string) error {
+		return fmt.Errorf("capacity reservation %s only reserves shape %s in fault domains %s, but instances are launched without one",
+			id, shape, faultDomains)
+	}
+	ErrCapacityReservationExhausted = func(id, shape string, reserved int64) error {
+		return fmt.Errorf("capacity reservation %s is exhausted: all %d reserved %s instances are in use", id, reserved, shape)
+	}
+	ErrDiskTooSmall = func(size int, image string, imageSizeInMBs int64) error {
+		return fmt.Errorf("option DISK_SIZE of %d GB is smaller than image %s (%d MB)", size, image, imageSizeInMBs)
+	}
+	ErrKMSKeyNotFound = func(keyID, compartmentID string) error {
+		return fmt.Errorf("KMS key %s was not found in any active vault of compartment %s", keyID, compartmentID)
+	}
+	ErrKMSKeyNotUsable = func(keyID, reason string) error {
+		return fmt.Errorf("KMS key %s cannot encrypt volumes: %s", keyID, reason)
+	}
+	ErrPlatformShape = func(shape, feature string) error {
+		return fmt.Errorf("shape %s does not support %s", shape, feature)
+	}
+	ErrPlatformImage = func(image, reason string) error {
+		return fmt.Errorf("image %s cannot be used: %s", image, reason)
+	}
+	ErrSnapshotExists = func(name string) error {
+		return fmt.Errorf("snapshot %s already exists", name)
+	}
+	ErrSnapshotNotFound = func(name string) error {
+		return fmt.Errorf("snapshot %s not found - run snapshot list to see the snapshots of this workspace", name)
+	}
+	ErrSnapshotNotAvailable = func(name, state string) error {
+		return fmt.Errorf("snapshot %s is %s and cannot be restored yet", name, state)
+	}
+	ErrBackupNotAvailable = func(id, state string) error {
+		return fmt.Errorf("backup %s is %s and cannot be restored yet", id, state)
+	}
+	ErrBackupObjectNotFound = func(object, bucket string) error {
+		return fmt.Errorf("backup %s not found in bucket %s - run backup list to see the backups of this workspace", object, bucket)
+	}
+	ErrInstanceNotRunning = func(id, state string) error {
+		return fmt.Errorf("instance %s is %s - start it first", id, state)
+	}
+	ErrVolumeSize = func(kind string, current int64, size int) error {
+		return fmt.Errorf("cannot grow the %s volume from %d GB to %d GB: volumes can only grow, up to %d GB",
+			kind, current, size, maxVolumeSizeInGBs)
+	}
+	ErrResizeInvalid = func(shape, reason string) error {
+		return fmt.Errorf("cannot resize to %s: %s", shape, reason)
+	}
+	ErrExportNotFound = func(path, mountTargetID string) error {
+		return fmt.Errorf("mount target %s has no export at %s - set FSS_EXPORT_PATH to one of its exports", mountTargetID, path)
+	}
+	ErrExportInUse = func(path, fileSystemID string) error {
+		return fmt.Errorf("export path %s is already used by a file system other than %s - set a different FSS_EXPORT_PATH", path, fileSystemID)
+	}
+	ErrOperationInProgress = func(machineID string, pid int) error {
+		return fmt.Errorf("another operation is in progress on machine %s (pid %d), try again once it has finished", machineID, pid)
+	}
+
+	ErrWaitTimeout = func(state string, timeout time.Duration) error {
+		return fmt.Errorf("%w: it did not become %s within %s and may still get there - check its status", errWaitTimeout, state, timeout)
+	}
+
+	errServerNotFound = errors.New(errMissingServer)
+	errWaitTimeout    = errors.New("timed out waiting for instance")
+)
+
 // IsNotFound returns true if the error is a not found error
 func IsNotFound(err error) bool {
 	if err == nil {
 		return false
 	}
 
+	if errors.Is(err, errServerNotFound) {
+		return true
+	}
+
 	var serviceErr common.ServiceError
 	if errors.As(err, &serviceErr) {
 		return serviceErr.GetHTTPStatusCode() == 404
 	}
 
-	return strings.Contains(err.Error(), "not found") || 
-		   strings.Contains(err.Error(), "NotFound") || 
-		   strings.Contains(err.Error(), "does not exist")
+	return strings.Contains(err.Error(), "not found") ||
+		strings.Contains(err.Error(), "NotFound") ||
+		strings.Contains(err.Error(), "does not exist")
 }
 
 // MissingMachineID returns a missing machine id error
@@ -31,10 +124,10 @@ func MissingMachineID() error {
 
 // MissingServer returns a missing server error
 func MissingServer() error {
-	return fmt.Errorf(errMissingServer)
+	return errServerNotFound
 }
 
 // MissingVolume returns a missing volume error
 func MissingVolume() error {
 	return fmt.Errorf(errMissingVolume)
-} 
\ No newline at end of file
+}
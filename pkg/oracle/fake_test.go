@@ -0,0 +1,1417 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/filestorage"
+	"github.com/oracle/oci-go-sdk/v65/keymanagement"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePageSize is deliberately small so that tests can push resources onto
+// later pages
+const fakePageSize = 2
+
+// fakePage returns the page of items addressed by the opaque page token along
+// with the token for the next page
+func fakePage[T any](items []T, page *string) ([]T, *string) {
+	start := 0
+	if page != nil {
+		start, _ = strconv.Atoi(*page)
+	}
+
+	end := start + fakePageSize
+	if end >= len(items) {
+		return items[start:], nil
+	}
+
+	return items[start:end], common.String(strconv.Itoa(end))
+}
+
+// fakeServiceError is an OCI service error with an HTTP status
+type fakeServiceError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e fakeServiceError) Error() string {
+	return fmt.Sprintf("service error %d: %s", e.status, e.code)
+}
+
+func (e fakeServiceError) GetHTTPStatusCode() int { return e.status }
+
+func (e fakeServiceError) GetMessage() string {
+	if e.message != "" {
+		return e.message
+	}
+	return e.code
+}
+
+func (e fakeServiceError) GetCode() string { return e.code }
+
+func (e fakeServiceError) GetOpcRequestID() string { return "" }
+
+// fakeCompute is an in-memory compute backend. Unimplemented calls panic via
+// the nil embedded interface.
+type fakeCompute struct {
+	computeAPI
+
+	images            []core.Image
+	instances         []core.Instance
+	vnicAttachments   []core.VnicAttachment
+	volumeAttachments []core.VolumeAttachment
+	bootAttachments   []core.BootVolumeAttachment
+	launches          []core.LaunchInstanceDetails
+	actions           []core.InstanceActionActionEnum
+	calls             map[string]int
+
+	reservation   *core.ComputeCapacityReservation
+	dedicatedHost *core.DedicatedVmHost
+	hostShapes    []core.DedicatedVmHostInstanceShapeSummary
+	launchErr     error
+	imageErr      error
+
+	// imageTokens maps the retry tokens of image creates to the image they
+	// created, which a repeated create returns as OCI does
+	imageTokens map[string]string
+
+	shapes []core.Shape
+	// imageShapes limits the shapes listed for an image
+	imageShapes map[string][]string
+
+	// ignoreSoftstop simulates a guest that does not react to ACPI shutdown
+	ignoreSoftstop bool
+
+	// versions counts the updates of each instance, which make up its etag
+	versions map[string]int
+	// beforeUpdate runs at the start of every update, which lets a test
+	// simulate another process changing the instance first
+	beforeUpdate func(instanceID string)
+	updates      []core.UpdateInstanceDetails
+	// rejectLiveResize refuses to resize a running instance without downtime
+	rejectLiveResize bool
+	// updateErr fails every update that is not refused otherwise
+	updateErr error
+}
+
+func (f *fakeCompute) record(name string) {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+}
+
+func (f *fakeCompute) GetInstance(_ context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error) {
+	f.record("GetInstance")
+	for _, i := range f.instances {
+		if *i.Id == *request.InstanceId {
+			return core.GetInstanceResponse{Instance: i, Etag: f.etag(*i.Id)}, nil
+		}
+	}
+	return core.GetInstanceResponse{}, fmt.Errorf("instance %s not found", *request.InstanceId)
+}
+
+func (f *fakeCompute) etag(instanceID string) *string {
+	return common.String(fmt.Sprintf("%s-%d", instanceID, f.versions[instanceID]))
+}
+
+// UpdateInstance honours If-Match like OCI, failing with 412 on a stale etag
+func (f *fakeCompute) UpdateInstance(_ context.Context, request core.UpdateInstanceRequest) (core.UpdateInstanceResponse, error) {
+	f.record("UpdateInstance")
+	if f.beforeUpdate != nil {
+		f.beforeUpdate(*request.InstanceId)
+	}
+	for i := range f.instances {
+		if *f.instances[i].Id != *request.InstanceId {
+			continue
+		}
+		if request.IfMatch != nil && *request.IfMatch != *f.etag(*request.InstanceId) {
+			return core.UpdateInstanceResponse{}, fakeServiceError{status: 412, code: "PreconditionFailed"}
+		}
+		if f.rejectLiveResize && f.instances[i].LifecycleState == core.InstanceLifecycleStateRunning &&
+			request.UpdateOperationConstraint == core.UpdateInstanceDetailsUpdateOperationConstraintAvoidDowntime {
+			return core.UpdateInstanceResponse{}, fakeServiceError{
+				status:  409,
+				code:    "IncorrectState",
+				message: "Instance must be in STOPPED state to update the shape configuration",
+			}
+		}
+		if f.updateErr != nil {
+			return core.UpdateInstanceResponse{}, f.updateErr
+		}
+		f.updates = append(f.updates, request.UpdateInstanceDetails)
+		if request.Shape != nil {
+			// A fixed shape brings its own OCPUs and memory
+			f.instances[i].Shape = request.Shape
+			if shape := findShape(f.shapes, *request.Shape); shape != nil && shape.Ocpus != nil {
+				f.instances[i].ShapeConfig = &core.InstanceShapeConfig{Ocpus: shape.Ocpus, MemoryInGBs: shape.MemoryInGBs}
+			}
+		}
+		if request.ShapeConfig != nil {
+			f.instances[i].ShapeConfig = &core.InstanceShapeConfig{
+				Ocpus:       request.ShapeConfig.Ocpus,
+				MemoryInGBs: request.ShapeConfig.MemoryInGBs,
+			}
+		}
+		if request.DisplayName != nil {
+			f.instances[i].DisplayName = request.DisplayName
+		}
+		if request.FreeformTags != nil {
+			f.instances[i].FreeformTags = request.FreeformTags
+		}
+		if request.Metadata != nil {
+			f.instances[i].Metadata = request.Metadata
+		}
+		if f.versions == nil {
+			f.versions = map[string]int{}
+		}
+		f.versions[*request.InstanceId]++
+		return core.UpdateInstanceResponse{Instance: f.instances[i], Etag: f.etag(*request.InstanceId)}, nil
+	}
+	return core.UpdateInstanceResponse{}, fmt.Errorf("instance %s not found", *request.InstanceId)
+}
+
+func (f *fakeCompute) InstanceAction(_ context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error) {
+	f.record("InstanceAction")
+	f.actions = append(f.actions, request.Action)
+
+	// Actions complete instantly so that waits return on the first poll
+	for i := range f.instances {
+		if *f.instances[i].Id != *request.InstanceId {
+			continue
+		}
+		switch request.Action {
+		case core.InstanceActionActionStart:
+			f.instances[i].LifecycleState = core.InstanceLifecycleStateRunning
+		case core.InstanceActionActionStop:
+			f.instances[i].LifecycleState = core.InstanceLifecycleStateStopped
+		case core.InstanceActionActionSoftstop:
+			if !f.ignoreSoftstop {
+				f.instances[i].LifecycleState = core.InstanceLifecycleStateStopped
+			}
+		}
+	}
+
+	return core.InstanceActionResponse{}, nil
+}
+
+func (f *fakeCompute) TerminateInstance(_ context.Context, request core.TerminateInstanceRequest) (core.TerminateInstanceResponse, error) {
+	f.record("TerminateInstance")
+	for i := range f.instances {
+		if *f.instances[i].Id == *request.InstanceId {
+			f.instances[i].LifecycleState = core.InstanceLifecycleStateTerminated
+		}
+	}
+	return core.TerminateInstanceResponse{}, nil
+}
+
+func (f *fakeCompute) ListVnicAttachments(_ context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error) {
+	f.record("ListVnicAttachments")
+	filtered := []core.VnicAttachment{}
+	for _, a := range f.vnicAttachments {
+		if *a.InstanceId == *request.InstanceId {
+			filtered = append(filtered, a)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return core.ListVnicAttachmentsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeCompute) AttachVolume(_ context.Context, request core.AttachVolumeRequest) (core.AttachVolumeResponse, error) {
+	f.record("AttachVolume")
+	details := request.AttachVolumeDetails.(core.AttachParavirtualizedVolumeDetails)
+	attachment := core.ParavirtualizedVolumeAttachment{
+		Id:             common.String(fmt.Sprintf("attachment-%d", len(f.volumeAttachments))),
+		InstanceId:     details.InstanceId,
+		VolumeId:       details.VolumeId,
+		Device:         details.Device,
+		LifecycleState: core.VolumeAttachmentLifecycleStateAttaching,
+	}
+	f.volumeAttachments = append(f.volumeAttachments, attachment)
+	return core.AttachVolumeResponse{VolumeAttachment: attachment}, nil
+}
+
+func (f *fakeCompute) ListVolumeAttachments(_ context.Context, request core.ListVolumeAttachmentsRequest) (core.ListVolumeAttachmentsResponse, error) {
+	f.record("ListVolumeAttachments")
+	filtered := []core.VolumeAttachment{}
+	for _, a := range f.volumeAttachments {
+		if *a.GetInstanceId() == *request.InstanceId && (request.VolumeId == nil || *a.GetVolumeId() == *request.VolumeId) {
+			filtered = append(filtered, a)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return core.ListVolumeAttachmentsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeCompute) ListBootVolumeAttachments(_ context.Context, request core.ListBootVolumeAttachmentsRequest) (core.ListBootVolumeAttachmentsResponse, error) {
+	f.record("ListBootVolumeAttachments")
+	filtered := []core.BootVolumeAttachment{}
+	for _, a := range f.bootAttachments {
+		if *a.InstanceId == *request.InstanceId {
+			filtered = append(filtered, a)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return core.ListBootVolumeAttachmentsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+// LaunchInstance launches straight into RUNNING so that waits return on the
+// first poll
+func (f *fakeCompute) LaunchInstance(_ context.Context, request core.LaunchInstanceRequest) (core.LaunchInstanceResponse, error) {
+	f.record("LaunchInstance")
+	f.launches = append(f.launches, request.LaunchInstanceDetails)
+	if f.launchErr != nil {
+		return core.LaunchInstanceResponse{}, f.launchErr
+	}
+	instance := core.Instance{
+		Id:                 common.String(fmt.Sprintf("launched-%d", len(f.launches))),
+		AvailabilityDomain: request.AvailabilityDomain,
+		CompartmentId:      request.CompartmentId,
+		DisplayName:        request.DisplayName,
+		Shape:              request.Shape,
+		Metadata:           request.Metadata,
+		FreeformTags:       request.FreeformTags,
+		LifecycleState:     core.InstanceLifecycleStateRunning,
+
+		PreemptibleInstanceConfig: request.PreemptibleInstanceConfig,
+	}
+	f.instances = append(f.instances, instance)
+	return core.LaunchInstanceResponse{Instance: instance}, nil
+}
+
+func (f *fakeCompute) GetComputeCapacityReservation(
+	_ context.Context, _ core.GetComputeCapacityReservationRequest,
+) (core.GetComputeCapacityReservationResponse, error) {
+	f.record("GetComputeCapacityReservation")
+	if f.reservation == nil {
+		return core.GetComputeCapacityReservationResponse{}, fmt.Errorf("capacity reservation not found")
+	}
+	return core.GetComputeCapacityReservationResponse{ComputeCapacityReservation: *f.reservation}, nil
+}
+
+func (f *fakeCompute) GetDedicatedVmHost(_ context.Context, _ core.GetDedicatedVmHostRequest) (core.GetDedicatedVmHostResponse, error) {
+	f.record("GetDedicatedVmHost")
+	if f.dedicatedHost == nil {
+		return core.GetDedicatedVmHostResponse{}, fmt.Errorf("dedicated VM host not found")
+	}
+	return core.GetDedicatedVmHostResponse{DedicatedVmHost: *f.dedicatedHost}, nil
+}
+
+func (f *fakeCompute) ListDedicatedVmHostInstanceShapes(
+	_ context.Context, request core.ListDedicatedVmHostInstanceShapesRequest,
+) (core.ListDedicatedVmHostInstanceShapesResponse, error) {
+	f.record("ListDedicatedVmHostInstanceShapes")
+	items, next := fakePage(f.hostShapes, request.Page)
+	return core.ListDedicatedVmHostInstanceShapesResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeCompute) ListShapes(_ context.Context, request core.ListShapesRequest) (core.ListShapesResponse, error) {
+	f.record("ListShapes")
+	shapes := f.shapes
+	if request.ImageId != nil && f.imageShapes != nil {
+		shapes = []core.Shape{}
+		for _, s := range f.shapes {
+			if contains(f.imageShapes[*request.ImageId], *s.Shape) {
+				shapes = append(shapes, s)
+			}
+		}
+	}
+	items, next := fakePage(shapes, request.Page)
+	return core.ListShapesResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeCompute) CreateImage(_ context.Context, request core.CreateImageRequest) (core.CreateImageResponse, error) {
+	f.record("CreateImage")
+	if f.imageErr != nil {
+		return core.CreateImageResponse{}, f.imageErr
+	}
+	id := fmt.Sprintf("baked-%d", len(f.images))
+	if request.OpcRetryToken != nil {
+		if f.imageTokens == nil {
+			f.imageTokens = map[string]string{}
+		}
+		if replayed, ok := f.imageTokens[*request.OpcRetryToken]; ok {
+			for _, i := range f.images {
+				if *i.Id == replayed {
+					return core.CreateImageResponse{Image: i}, nil
+				}
+			}
+		}
+		f.imageTokens[*request.OpcRetryToken] = id
+	}
+	image := core.Image{
+		Id:             common.String(id),
+		CompartmentId:  request.CompartmentId,
+		DisplayName:    request.DisplayName,
+		FreeformTags:   request.FreeformTags,
+		LifecycleState: core.ImageLifecycleStateAvailable,
+	}
+	f.images = append(f.images, image)
+	return core.CreateImageResponse{Image: image}, nil
+}
+
+func (f *fakeCompute) GetImage(_ context.Context, request core.GetImageRequest) (core.GetImageResponse, error) {
+	f.record("GetImage")
+	for _, i := range f.images {
+		if *i.Id == *request.ImageId {
+			return core.GetImageResponse{Image: i}, nil
+		}
+	}
+	return core.GetImageResponse{}, fmt.Errorf("image %s not found", *request.ImageId)
+}
+
+func (f *fakeCompute) ListImages(_ context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error) {
+	f.record("ListImages")
+	items, next := fakePage(f.images, request.Page)
+
+	// The API filters each page, so a page can be empty but still have a next
+	filtered := []core.Image{}
+	for _, i := range items {
+		if request.DisplayName == nil || *i.DisplayName == *request.DisplayName {
+			filtered = append(filtered, i)
+		}
+	}
+
+	return core.ListImagesResponse{Items: filtered, OpcNextPage: next}, nil
+}
+
+func (f *fakeCompute) ListInstances(_ context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error) {
+	f.record("ListInstances")
+	items, next := fakePage(f.instances, request.Page)
+
+	filtered := []core.Instance{}
+	for _, i := range items {
+		if i.CompartmentId != nil && *i.CompartmentId != *request.CompartmentId {
+			continue
+		}
+		if request.DisplayName == nil || *i.DisplayName == *request.DisplayName {
+			filtered = append(filtered, i)
+		}
+	}
+
+	return core.ListInstancesResponse{Items: filtered, OpcNextPage: next}, nil
+}
+
+// fakeNetwork is an in-memory virtual network backend
+type fakeNetwork struct {
+	networkAPI
+
+	vcns     []core.Vcn
+	igs      []core.InternetGateway
+	rts      []core.RouteTable
+	subnets  []core.Subnet
+	vnics    []core.Vnic
+	calls    map[string]int
+	sequence int
+
+	nsgs       []core.NetworkSecurityGroup
+	nsgRules   map[string][]core.SecurityRule
+	privateIps []core.PrivateIp
+
+	// beforeCreate runs at the start of every create, which lets a test
+	// simulate another process winning the race
+	beforeCreate func(kind string)
+}
+
+func (f *fakeNetwork) record(name string) {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+}
+
+func (f *fakeNetwork) nextID(kind string) *string {
+	f.sequence++
+	return common.String(fmt.Sprintf("ocid1.%s.fake.%d", kind, f.sequence))
+}
+
+func (f *fakeNetwork) create(kind string) (*string, *common.SDKTime) {
+	if f.beforeCreate != nil {
+		f.beforeCreate(kind)
+	}
+	id := f.nextID(kind)
+	return id, &common.SDKTime{Time: time.Unix(int64(1700000000+f.sequence), 0)}
+}
+
+func (f *fakeNetwork) GetVnic(_ context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error) {
+	f.record("GetVnic")
+	for _, v := range f.vnics {
+		if *v.Id == *request.VnicId {
+			return core.GetVnicResponse{Vnic: v}, nil
+		}
+	}
+	return core.GetVnicResponse{}, fmt.Errorf("vnic %s not found", *request.VnicId)
+}
+
+func (f *fakeNetwork) UpdateVnic(_ context.Context, request core.UpdateVnicRequest) (core.UpdateVnicResponse, error) {
+	f.record("UpdateVnic")
+	for i := range f.vnics {
+		if *f.vnics[i].Id == *request.VnicId {
+			f.vnics[i].FreeformTags = request.FreeformTags
+			return core.UpdateVnicResponse{Vnic: f.vnics[i]}, nil
+		}
+	}
+	return core.UpdateVnicResponse{}, fmt.Errorf("vnic %s not found", *request.VnicId)
+}
+
+func (f *fakeNetwork) ListVcns(_ context.Context, request core.ListVcnsRequest) (core.ListVcnsResponse, error) {
+	f.record("ListVcns")
+	items, next := fakePage(f.vcns, request.Page)
+	return core.ListVcnsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) CreateVcn(_ context.Context, request core.CreateVcnRequest) (core.CreateVcnResponse, error) {
+	f.record("CreateVcn")
+	id, created := f.create("vcn")
+	vcn := core.Vcn{
+		Id:             id,
+		TimeCreated:    created,
+		DisplayName:    request.DisplayName,
+		LifecycleState: core.VcnLifecycleStateAvailable,
+		FreeformTags:   request.FreeformTags,
+	}
+	f.vcns = append(f.vcns, vcn)
+	return core.CreateVcnResponse{Vcn: vcn}, nil
+}
+
+func (f *fakeNetwork) ListInternetGateways(_ context.Context, request core.ListInternetGatewaysRequest) (core.ListInternetGatewaysResponse, error) {
+	f.record("ListInternetGateways")
+	items, next := fakePage(f.igs, request.Page)
+	return core.ListInternetGatewaysResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) CreateInternetGateway(_ context.Context, request core.CreateInternetGatewayRequest) (core.CreateInternetGatewayResponse, error) {
+	f.record("CreateInternetGateway")
+	id, created := f.create("internetgateway")
+	ig := core.InternetGateway{
+		Id:             id,
+		TimeCreated:    created,
+		DisplayName:    request.DisplayName,
+		VcnId:          request.VcnId,
+		LifecycleState: core.InternetGatewayLifecycleStateAvailable,
+	}
+	f.igs = append(f.igs, ig)
+	return core.CreateInternetGatewayResponse{InternetGateway: ig}, nil
+}
+
+func (f *fakeNetwork) ListRouteTables(_ context.Context, request core.ListRouteTablesRequest) (core.ListRouteTablesResponse, error) {
+	f.record("ListRouteTables")
+	items, next := fakePage(f.rts, request.Page)
+	return core.ListRouteTablesResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) CreateRouteTable(_ context.Context, request core.CreateRouteTableRequest) (core.CreateRouteTableResponse, error) {
+	f.record("CreateRouteTable")
+	id, created := f.create("routetable")
+	rt := core.RouteTable{
+		Id:             id,
+		TimeCreated:    created,
+		DisplayName:    request.DisplayName,
+		VcnId:          request.VcnId,
+		LifecycleState: core.RouteTableLifecycleStateAvailable,
+	}
+	f.rts = append(f.rts, rt)
+	return core.CreateRouteTableResponse{RouteTable: rt}, nil
+}
+
+func (f *fakeNetwork) ListSubnets(_ context.Context, request core.ListSubnetsRequest) (core.ListSubnetsResponse, error) {
+	f.record("ListSubnets")
+	items, next := fakePage(f.subnets, request.Page)
+	return core.ListSubnetsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) CreateSubnet(_ context.Context, request core.CreateSubnetRequest) (core.CreateSubnetResponse, error) {
+	f.record("CreateSubnet")
+	id, created := f.create("subnet")
+	subnet := core.Subnet{
+		Id:             id,
+		TimeCreated:    created,
+		DisplayName:    request.DisplayName,
+		VcnId:          request.VcnId,
+		LifecycleState: core.SubnetLifecycleStateAvailable,
+	}
+	f.subnets = append(f.subnets, subnet)
+	return core.CreateSubnetResponse{Subnet: subnet}, nil
+}
+
+func (f *fakeNetwork) DeleteVcn(_ context.Context, request core.DeleteVcnRequest) (core.DeleteVcnResponse, error) {
+	f.record("DeleteVcn")
+	for i := range f.vcns {
+		if *f.vcns[i].Id == *request.VcnId {
+			f.vcns[i].LifecycleState = core.VcnLifecycleStateTerminated
+		}
+	}
+	return core.DeleteVcnResponse{}, nil
+}
+
+func (f *fakeNetwork) DeleteInternetGateway(_ context.Context, request core.DeleteInternetGatewayRequest) (core.DeleteInternetGatewayResponse, error) {
+	f.record("DeleteInternetGateway")
+	for i := range f.igs {
+		if *f.igs[i].Id == *request.IgId {
+			f.igs[i].LifecycleState = core.InternetGatewayLifecycleStateTerminated
+		}
+	}
+	return core.DeleteInternetGatewayResponse{}, nil
+}
+
+func (f *fakeNetwork) DeleteRouteTable(_ context.Context, request core.DeleteRouteTableRequest) (core.DeleteRouteTableResponse, error) {
+	f.record("DeleteRouteTable")
+	for i := range f.rts {
+		if *f.rts[i].Id == *request.RtId {
+			f.rts[i].LifecycleState = core.RouteTableLifecycleStateTerminated
+		}
+	}
+	return core.DeleteRouteTableResponse{}, nil
+}
+
+func (f *fakeNetwork) DeleteSubnet(_ context.Context, request core.DeleteSubnetRequest) (core.DeleteSubnetResponse, error) {
+	f.record("DeleteSubnet")
+	for i := range f.subnets {
+		if *f.subnets[i].Id == *request.SubnetId {
+			f.subnets[i].LifecycleState = core.SubnetLifecycleStateTerminated
+		}
+	}
+	return core.DeleteSubnetResponse{}, nil
+}
+
+func (f *fakeNetwork) ListNetworkSecurityGroups(
+	_ context.Context, request core.ListNetworkSecurityGroupsRequest,
+) (core.ListNetworkSecurityGroupsResponse, error) {
+	f.record("ListNetworkSecurityGroups")
+	items, next := fakePage(f.nsgs, request.Page)
+	return core.ListNetworkSecurityGroupsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) CreateNetworkSecurityGroup(
+	_ context.Context, request core.CreateNetworkSecurityGroupRequest,
+) (core.CreateNetworkSecurityGroupResponse, error) {
+	f.record("CreateNetworkSecurityGroup")
+	id, created := f.create("networksecuritygroup")
+	nsg := core.NetworkSecurityGroup{
+		Id:             id,
+		TimeCreated:    created,
+		CompartmentId:  request.CompartmentId,
+		VcnId:          request.VcnId,
+		DisplayName:    request.DisplayName,
+		FreeformTags:   request.FreeformTags,
+		LifecycleState: core.NetworkSecurityGroupLifecycleStateAvailable,
+	}
+	f.nsgs = append(f.nsgs, nsg)
+	return core.CreateNetworkSecurityGroupResponse{NetworkSecurityGroup: nsg}, nil
+}
+
+func (f *fakeNetwork) GetNetworkSecurityGroup(
+	_ context.Context, request core.GetNetworkSecurityGroupRequest,
+) (core.GetNetworkSecurityGroupResponse, error) {
+	f.record("GetNetworkSecurityGroup")
+	for _, n := range f.nsgs {
+		if *n.Id == *request.NetworkSecurityGroupId {
+			return core.GetNetworkSecurityGroupResponse{NetworkSecurityGroup: n}, nil
+		}
+	}
+	return core.GetNetworkSecurityGroupResponse{}, fmt.Errorf("network security group %s not found", *request.NetworkSecurityGroupId)
+}
+
+func (f *fakeNetwork) DeleteNetworkSecurityGroup(
+	_ context.Context, request core.DeleteNetworkSecurityGroupRequest,
+) (core.DeleteNetworkSecurityGroupResponse, error) {
+	f.record("DeleteNetworkSecurityGroup")
+	for i := range f.nsgs {
+		if *f.nsgs[i].Id == *request.NetworkSecurityGroupId {
+			f.nsgs[i].LifecycleState = core.NetworkSecurityGroupLifecycleStateTerminated
+		}
+	}
+	return core.DeleteNetworkSecurityGroupResponse{}, nil
+}
+
+func (f *fakeNetwork) AddNetworkSecurityGroupSecurityRules(
+	_ context.Context, request core.AddNetworkSecurityGroupSecurityRulesRequest,
+) (core.AddNetworkSecurityGroupSecurityRulesResponse, error) {
+	f.record("AddNetworkSecurityGroupSecurityRules")
+	if f.nsgRules == nil {
+		f.nsgRules = map[string][]core.SecurityRule{}
+	}
+	for _, r := range request.SecurityRules {
+		f.nsgRules[*request.NetworkSecurityGroupId] = append(f.nsgRules[*request.NetworkSecurityGroupId], core.SecurityRule{
+			Direction:  core.SecurityRuleDirectionEnum(r.Direction),
+			Protocol:   r.Protocol,
+			Source:     r.Source,
+			SourceType: core.SecurityRuleSourceTypeEnum(r.SourceType),
+			TcpOptions: r.TcpOptions,
+			UdpOptions: r.UdpOptions,
+		})
+	}
+	return core.AddNetworkSecurityGroupSecurityRulesResponse{}, nil
+}
+
+func (f *fakeNetwork) ListNetworkSecurityGroupSecurityRules(
+	_ context.Context, request core.ListNetworkSecurityGroupSecurityRulesRequest,
+) (core.ListNetworkSecurityGroupSecurityRulesResponse, error) {
+	f.record("ListNetworkSecurityGroupSecurityRules")
+	items, next := fakePage(f.nsgRules[*request.NetworkSecurityGroupId], request.Page)
+	return core.ListNetworkSecurityGroupSecurityRulesResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeNetwork) GetPrivateIp(_ context.Context, request core.GetPrivateIpRequest) (core.GetPrivateIpResponse, error) {
+	f.record("GetPrivateIp")
+	for _, ip := range f.privateIps {
+		if *ip.Id == *request.PrivateIpId {
+			return core.GetPrivateIpResponse{PrivateIp: ip}, nil
+		}
+	}
+	return core.GetPrivateIpResponse{}, fmt.Errorf("private ip %s not found", *request.PrivateIpId)
+}
+
+func (f *fakeNetwork) ListPrivateIps(_ context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error) {
+	f.record("ListPrivateIps")
+	filtered := []core.PrivateIp{}
+	for _, ip := range f.privateIps {
+		if request.SubnetId == nil || (ip.SubnetId != nil && *ip.SubnetId == *request.SubnetId) {
+			filtered = append(filtered, ip)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return core.ListPrivateIpsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+// fakeFileStorage is an in-memory file storage backend. A new mount target
+// gets a private IP in network, when set.
+type fakeFileStorage struct {
+	fileStorageAPI
+
+	fileSystems  []filestorage.FileSystem
+	mountTargets []filestorage.MountTarget
+	exports      []filestorage.ExportSummary
+	network      *fakeNetwork
+	calls        map[string]int
+}
+
+func (f *fakeFileStorage) record(name string) {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+}
+
+func (f *fakeFileStorage) CreateFileSystem(
+	_ context.Context, request filestorage.CreateFileSystemRequest,
+) (filestorage.CreateFileSystemResponse, error) {
+	f.record("CreateFileSystem")
+	fileSystem := filestorage.FileSystem{
+		Id:                 common.String(fmt.Sprintf("file-system-%d", len(f.fileSystems))),
+		CompartmentId:      request.CompartmentId,
+		AvailabilityDomain: request.AvailabilityDomain,
+		DisplayName:        request.DisplayName,
+		FreeformTags:       request.FreeformTags,
+		LifecycleState:     filestorage.FileSystemLifecycleStateActive,
+	}
+	f.fileSystems = append(f.fileSystems, fileSystem)
+	return filestorage.CreateFileSystemResponse{FileSystem: fileSystem}, nil
+}
+
+func (f *fakeFileStorage) GetFileSystem(_ context.Context, request filestorage.GetFileSystemRequest) (filestorage.GetFileSystemResponse, error) {
+	f.record("GetFileSystem")
+	for _, fs := range f.fileSystems {
+		if *fs.Id == *request.FileSystemId {
+			return filestorage.GetFileSystemResponse{FileSystem: fs}, nil
+		}
+	}
+	return filestorage.GetFileSystemResponse{}, fmt.Errorf("file system %s not found", *request.FileSystemId)
+}
+
+func (f *fakeFileStorage) ListFileSystems(
+	_ context.Context, request filestorage.ListFileSystemsRequest,
+) (filestorage.ListFileSystemsResponse, error) {
+	f.record("ListFileSystems")
+	filtered := []filestorage.FileSystemSummary{}
+	for _, fs := range f.fileSystems {
+		if request.DisplayName == nil || *fs.DisplayName == *request.DisplayName {
+			filtered = append(filtered, filestorage.FileSystemSummary{
+				Id:             fs.Id,
+				DisplayName:    fs.DisplayName,
+				FreeformTags:   fs.FreeformTags,
+				LifecycleState: filestorage.FileSystemSummaryLifecycleStateEnum(fs.LifecycleState),
+			})
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return filestorage.ListFileSystemsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeFileStorage) CreateMountTarget(
+	_ context.Context, request filestorage.CreateMountTargetRequest,
+) (filestorage.CreateMountTargetResponse, error) {
+	f.record("CreateMountTarget")
+	n := len(f.mountTargets)
+	mountTarget := filestorage.MountTarget{
+		Id:                 common.String(fmt.Sprintf("mount-target-%d", n)),
+		CompartmentId:      request.CompartmentId,
+		AvailabilityDomain: request.AvailabilityDomain,
+		SubnetId:           request.SubnetId,
+		DisplayName:        request.DisplayName,
+		NsgIds:             request.NsgIds,
+		FreeformTags:       request.FreeformTags,
+		ExportSetId:        common.String(fmt.Sprintf("export-set-%d", n)),
+		PrivateIpIds:       []string{fmt.Sprintf("mount-target-ip-%d", n)},
+		LifecycleState:     filestorage.MountTargetLifecycleStateActive,
+	}
+	if f.network != nil {
+		f.network.privateIps = append(f.network.privateIps, core.PrivateIp{
+			Id:        &mountTarget.PrivateIpIds[0],
+			SubnetId:  request.SubnetId,
+			IpAddress: common.String(fmt.Sprintf("10.0.0.%d", 100+n)),
+		})
+	}
+	f.mountTargets = append(f.mountTargets, mountTarget)
+	return filestorage.CreateMountTargetResponse{MountTarget: mountTarget}, nil
+}
+
+func (f *fakeFileStorage) GetMountTarget(_ context.Context, request filestorage.GetMountTargetRequest) (filestorage.GetMountTargetResponse, error) {
+	f.record("GetMountTarget")
+	for _, m := range f.mountTargets {
+		if *m.Id == *request.MountTargetId {
+			return filestorage.GetMountTargetResponse{MountTarget: m}, nil
+		}
+	}
+	return filestorage.GetMountTargetResponse{}, fmt.Errorf("mount target %s not found", *request.MountTargetId)
+}
+
+func (f *fakeFileStorage) ListMountTargets(
+	_ context.Context, request filestorage.ListMountTargetsRequest,
+) (filestorage.ListMountTargetsResponse, error) {
+	f.record("ListMountTargets")
+	filtered := []filestorage.MountTargetSummary{}
+	for _, m := range f.mountTargets {
+		if request.DisplayName == nil || *m.DisplayName == *request.DisplayName {
+			filtered = append(filtered, filestorage.MountTargetSummary{
+				Id:             m.Id,
+				DisplayName:    m.DisplayName,
+				SubnetId:       m.SubnetId,
+				FreeformTags:   m.FreeformTags,
+				LifecycleState: filestorage.MountTargetSummaryLifecycleStateEnum(m.LifecycleState),
+			})
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return filestorage.ListMountTargetsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeFileStorage) CreateExport(_ context.Context, request filestorage.CreateExportRequest) (filestorage.CreateExportResponse, error) {
+	f.record("CreateExport")
+	for _, e := range f.exports {
+		if *e.ExportSetId == *request.ExportSetId && *e.Path == *request.Path {
+			return filestorage.CreateExportResponse{}, fakeServiceError{status: 409, code: "Conflict"}
+		}
+	}
+	export := filestorage.ExportSummary{
+		Id:             common.String(fmt.Sprintf("export-%d", len(f.exports))),
+		ExportSetId:    request.ExportSetId,
+		FileSystemId:   request.FileSystemId,
+		Path:           request.Path,
+		LifecycleState: filestorage.ExportSummaryLifecycleStateActive,
+	}
+	f.exports = append(f.exports, export)
+	return filestorage.CreateExportResponse{Export: filestorage.Export{Id: export.Id, Path: export.Path}}, nil
+}
+
+func (f *fakeFileStorage) ListExports(_ context.Context, request filestorage.ListExportsRequest) (filestorage.ListExportsResponse, error) {
+	f.record("ListExports")
+	filtered := []filestorage.ExportSummary{}
+	for _, e := range f.exports {
+		if request.ExportSetId == nil || *e.ExportSetId == *request.ExportSetId {
+			filtered = append(filtered, e)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return filestorage.ListExportsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+// fakeBlockstorage is an in-memory block volume backend
+type fakeBlockstorage struct {
+	blockstorageAPI
+
+	volumes       []core.Volume
+	bootVolumes   []core.BootVolume
+	bootBackups   []core.BootVolumeBackup
+	volumeBackups []core.VolumeBackup
+	calls         map[string]int
+
+	// backupTokens maps the retry tokens of backup creates to the backup
+	// they created, which a repeated create returns as OCI does
+	backupTokens map[string]string
+}
+
+// replayBackup returns the ID of the backup created with the retry token
+// before, and remembers the token for the backup created next otherwise
+func (f *fakeBlockstorage) replayBackup(token *string, nextID string) (string, bool) {
+	if token == nil {
+		return "", false
+	}
+	if f.backupTokens == nil {
+		f.backupTokens = map[string]string{}
+	}
+	if id, ok := f.backupTokens[*token]; ok {
+		return id, true
+	}
+	f.backupTokens[*token] = nextID
+	return "", false
+}
+
+func (f *fakeBlockstorage) record(name string) {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+}
+
+func (f *fakeBlockstorage) CreateVolume(_ context.Context, request core.CreateVolumeRequest) (core.CreateVolumeResponse, error) {
+	f.record("CreateVolume")
+	// A volume restored from a backup takes the size of the backup
+	size := request.SizeInGBs
+	if size == nil {
+		size = common.Int64(50)
+	}
+	volume := core.Volume{
+		Id:                 common.String(fmt.Sprintf("volume-%d", len(f.volumes))),
+		CompartmentId:      request.CompartmentId,
+		AvailabilityDomain: request.AvailabilityDomain,
+		DisplayName:        request.DisplayName,
+		SizeInGBs:          size,
+		FreeformTags:       request.FreeformTags,
+		SourceDetails:      request.SourceDetails,
+		LifecycleState:     core.VolumeLifecycleStateAvailable,
+	}
+	f.volumes = append(f.volumes, volume)
+	return core.CreateVolumeResponse{Volume: volume}, nil
+}
+
+func (f *fakeBlockstorage) GetBootVolume(_ context.Context, request core.GetBootVolumeRequest) (core.GetBootVolumeResponse, error) {
+	f.record("GetBootVolume")
+	for _, v := range f.bootVolumes {
+		if *v.Id == *request.BootVolumeId {
+			return core.GetBootVolumeResponse{BootVolume: v}, nil
+		}
+	}
+	return core.GetBootVolumeResponse{}, fmt.Errorf("boot volume %s not found", *request.BootVolumeId)
+}
+
+func (f *fakeBlockstorage) DeleteBootVolume(_ context.Context, request core.DeleteBootVolumeRequest) (core.DeleteBootVolumeResponse, error) {
+	f.record("DeleteBootVolume")
+	for i := range f.bootVolumes {
+		if *f.bootVolumes[i].Id == *request.BootVolumeId {
+			f.bootVolumes[i].LifecycleState = core.BootVolumeLifecycleStateTerminated
+		}
+	}
+	return core.DeleteBootVolumeResponse{}, nil
+}
+
+func (f *fakeBlockstorage) DeleteVolume(_ context.Context, request core.DeleteVolumeRequest) (core.DeleteVolumeResponse, error) {
+	f.record("DeleteVolume")
+	for i := range f.volumes {
+		if *f.volumes[i].Id == *request.VolumeId {
+			f.volumes[i].LifecycleState = core.VolumeLifecycleStateTerminated
+		}
+	}
+	return core.DeleteVolumeResponse{}, nil
+}
+
+func (f *fakeBlockstorage) GetVolume(_ context.Context, request core.GetVolumeRequest) (core.GetVolumeResponse, error) {
+	f.record("GetVolume")
+	for _, v := range f.volumes {
+		if *v.Id == *request.VolumeId {
+			return core.GetVolumeResponse{Volume: v}, nil
+		}
+	}
+	return core.GetVolumeResponse{}, fmt.Errorf("volume %s not found", *request.VolumeId)
+}
+
+func (f *fakeBlockstorage) UpdateVolume(_ context.Context, request core.UpdateVolumeRequest) (core.UpdateVolumeResponse, error) {
+	f.record("UpdateVolume")
+	for i := range f.volumes {
+		if *f.volumes[i].Id == *request.VolumeId {
+			f.volumes[i].SizeInGBs = request.SizeInGBs
+			return core.UpdateVolumeResponse{Volume: f.volumes[i]}, nil
+		}
+	}
+	return core.UpdateVolumeResponse{}, fmt.Errorf("volume %s not found", *request.VolumeId)
+}
+
+func (f *fakeBlockstorage) UpdateBootVolume(_ context.Context, request core.UpdateBootVolumeRequest) (core.UpdateBootVolumeResponse, error) {
+	f.record("UpdateBootVolume")
+	for i := range f.bootVolumes {
+		if *f.bootVolumes[i].Id == *request.BootVolumeId {
+			f.bootVolumes[i].SizeInGBs = request.SizeInGBs
+			return core.UpdateBootVolumeResponse{BootVolume: f.bootVolumes[i]}, nil
+		}
+	}
+	return core.UpdateBootVolumeResponse{}, fmt.Errorf("boot volume %s not found", *request.BootVolumeId)
+}
+
+func (f *fakeBlockstorage) ListVolumes(_ context.Context, request core.ListVolumesRequest) (core.ListVolumesResponse, error) {
+	f.record("ListVolumes")
+	filtered := []core.Volume{}
+	for _, v := range f.volumes {
+		if request.DisplayName == nil || *v.DisplayName == *request.DisplayName {
+			filtered = append(filtered, v)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return core.ListVolumesResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeBlockstorage) CreateBootVolume(_ context.Context, request core.CreateBootVolumeRequest) (core.CreateBootVolumeResponse, error) {
+	f.record("CreateBootVolume")
+	volume := core.BootVolume{
+		Id:                 common.String(fmt.Sprintf("boot-volume-%d", len(f.bootVolumes))),
+		CompartmentId:      request.CompartmentId,
+		AvailabilityDomain: request.AvailabilityDomain,
+		DisplayName:        request.DisplayName,
+		FreeformTags:       request.FreeformTags,
+		SourceDetails:      request.SourceDetails,
+		LifecycleState:     core.BootVolumeLifecycleStateAvailable,
+	}
+	f.bootVolumes = append(f.bootVolumes, volume)
+	return core.CreateBootVolumeResponse{BootVolume: volume}, nil
+}
+
+func (f *fakeBlockstorage) CreateBootVolumeBackup(
+	_ context.Context, request core.CreateBootVolumeBackupRequest,
+) (core.CreateBootVolumeBackupResponse, error) {
+	f.record("CreateBootVolumeBackup")
+	id := fmt.Sprintf("boot-backup-%d", len(f.bootBackups))
+	if replayed, ok := f.replayBackup(request.OpcRetryToken, id); ok {
+		for _, b := range f.bootBackups {
+			if *b.Id == replayed {
+				return core.CreateBootVolumeBackupResponse{BootVolumeBackup: b}, nil
+			}
+		}
+	}
+	backup := core.BootVolumeBackup{
+		Id:             common.String(id),
+		BootVolumeId:   request.BootVolumeId,
+		DisplayName:    request.DisplayName,
+		FreeformTags:   request.FreeformTags,
+		TimeCreated:    &common.SDKTime{Time: time.Now()},
+		LifecycleState: core.BootVolumeBackupLifecycleStateAvailable,
+	}
+	f.bootBackups = append(f.bootBackups, backup)
+	return core.CreateBootVolumeBackupResponse{BootVolumeBackup: backup}, nil
+}
+
+func (f *fakeBlockstorage) CreateVolumeBackup(_ context.Context, request core.CreateVolumeBackupRequest) (core.CreateVolumeBackupResponse, error) {
+	f.record("CreateVolumeBackup")
+	id := fmt.Sprintf("volume-backup-%d", len(f.volumeBackups))
+	if replayed, ok := f.replayBackup(request.OpcRetryToken, id); ok {
+		for _, b := range f.volumeBackups {
+			if *b.Id == replayed {
+				return core.CreateVolumeBackupResponse{VolumeBackup: b}, nil
+			}
+		}
+	}
+	backup := core.VolumeBackup{
+		Id:             common.String(id),
+		VolumeId:       request.VolumeId,
+		DisplayName:    request.DisplayName,
+		FreeformTags:   request.FreeformTags,
+		TimeCreated:    &common.SDKTime{Time: time.Now()},
+		LifecycleState: core.VolumeBackupLifecycleStateAvailable,
+	}
+	f.volumeBackups = append(f.volumeBackups, backup)
+	return core.CreateVolumeBackupResponse{VolumeBackup: backup}, nil
+}
+
+func (f *fakeBlockstorage) GetBootVolumeBackup(
+	_ context.Context, request core.GetBootVolumeBackupRequest,
+) (core.GetBootVolumeBackupResponse, error) {
+	f.record("GetBootVolumeBackup")
+	for _, b := range f.bootBackups {
+		if *b.Id == *request.BootVolumeBackupId {
+			return core.GetBootVolumeBackupResponse{BootVolumeBackup: b}, nil
+		}
+	}
+	return core.GetBootVolumeBackupResponse{}, fmt.Errorf("boot volume backup %s not found", *request.BootVolumeBackupId)
+}
+
+func (f *fakeBlockstorage) GetVolumeBackup(_ context.Context, request core.GetVolumeBackupRequest) (core.GetVolumeBackupResponse, error) {
+	f.record("GetVolumeBackup")
+	for _, b := range f.volumeBackups {
+		if *b.Id == *request.VolumeBackupId {
+			return core.GetVolumeBackupResponse{VolumeBackup: b}, nil
+		}
+	}
+	return core.GetVolumeBackupResponse{}, fmt.Errorf("volume backup %s not found", *request.VolumeBackupId)
+}
+
+func (f *fakeBlockstorage) ListBootVolumeBackups(
+	_ context.Context, request core.ListBootVolumeBackupsRequest,
+) (core.ListBootVolumeBackupsResponse, error) {
+	f.record("ListBootVolumeBackups")
+	items, next := fakePage(f.bootBackups, request.Page)
+	return core.ListBootVolumeBackupsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeBlockstorage) ListVolumeBackups(_ context.Context, request core.ListVolumeBackupsRequest) (core.ListVolumeBackupsResponse, error) {
+	f.record("ListVolumeBackups")
+	items, next := fakePage(f.volumeBackups, request.Page)
+	return core.ListVolumeBackupsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeBlockstorage) DeleteBootVolumeBackup(
+	_ context.Context, request core.DeleteBootVolumeBackupRequest,
+) (core.DeleteBootVolumeBackupResponse, error) {
+	f.record("DeleteBootVolumeBackup")
+	for i := range f.bootBackups {
+		if *f.bootBackups[i].Id == *request.BootVolumeBackupId {
+			f.bootBackups[i].LifecycleState = core.BootVolumeBackupLifecycleStateTerminated
+		}
+	}
+	return core.DeleteBootVolumeBackupResponse{}, nil
+}
+
+func (f *fakeBlockstorage) DeleteVolumeBackup(_ context.Context, request core.DeleteVolumeBackupRequest) (core.DeleteVolumeBackupResponse, error) {
+	f.record("DeleteVolumeBackup")
+	for i := range f.volumeBackups {
+		if *f.volumeBackups[i].Id == *request.VolumeBackupId {
+			f.volumeBackups[i].LifecycleState = core.VolumeBackupLifecycleStateTerminated
+		}
+	}
+	return core.DeleteVolumeBackupResponse{}, nil
+}
+
+type fakeKMS struct {
+	vaults []keymanagement.VaultSummary
+	// keys are served per vault management endpoint
+	keys map[string][]keymanagement.Key
+}
+
+func (f *fakeKMS) ListVaults(_ context.Context, request keymanagement.ListVaultsRequest) (keymanagement.ListVaultsResponse, error) {
+	filtered := []keymanagement.VaultSummary{}
+	for _, v := range f.vaults {
+		if *v.CompartmentId == *request.CompartmentId {
+			filtered = append(filtered, v)
+		}
+	}
+	items, next := fakePage(filtered, request.Page)
+	return keymanagement.ListVaultsResponse{Items: items, OpcNextPage: next}, nil
+}
+
+func (f *fakeKMS) managementClient(endpoint string) (kmsManagementAPI, error) {
+	return &fakeKMSManagement{keys: f.keys[endpoint]}, nil
+}
+
+type fakeKMSManagement struct {
+	keys []keymanagement.Key
+}
+
+func (f *fakeKMSManagement) GetKey(_ context.Context, request keymanagement.GetKeyRequest) (keymanagement.GetKeyResponse, error) {
+	for _, k := range f.keys {
+		if *k.Id == *request.KeyId {
+			return keymanagement.GetKeyResponse{Key: k}, nil
+		}
+	}
+	return keymanagement.GetKeyResponse{}, fmt.Errorf("key %s not found", *request.KeyId)
+}
+
+// fakeObjectStorage is an in-memory Object Storage backend with a single
+// namespace
+type fakeObjectStorage struct {
+	objectStorageAPI
+
+	buckets   map[string]objectstorage.CreateBucketDetails
+	objects   map[string][]byte
+	created   map[string]time.Time
+	parts     map[string]map[int][]byte
+	lifecycle []objectstorage.ObjectLifecycleRule
+	calls     map[string]int
+
+	// lifecycleVersion counts the writes of the lifecycle policy, which make
+	// up its etag
+	lifecycleVersion int
+	// beforeLifecycleWrite runs at the start of every lifecycle policy write,
+	// which lets a test simulate another machine changing it first
+	beforeLifecycleWrite func()
+}
+
+func (f *fakeObjectStorage) record(name string) {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+}
+
+func (f *fakeObjectStorage) GetNamespace(context.Context, objectstorage.GetNamespaceRequest) (objectstorage.GetNamespaceResponse, error) {
+	f.record("GetNamespace")
+	return objectstorage.GetNamespaceResponse{Value: common.String("namespace")}, nil
+}
+
+func (f *fakeObjectStorage) GetBucket(_ context.Context, request objectstorage.GetBucketRequest) (objectstorage.GetBucketResponse, error) {
+	f.record("GetBucket")
+	if _, ok := f.buckets[*request.BucketName]; !ok {
+		return objectstorage.GetBucketResponse{}, fakeServiceError{status: 404, code: "BucketNotFound"}
+	}
+	return objectstorage.GetBucketResponse{Bucket: objectstorage.Bucket{Name: request.BucketName}}, nil
+}
+
+func (f *fakeObjectStorage) CreateBucket(
+	_ context.Context, request objectstorage.CreateBucketRequest,
+) (objectstorage.CreateBucketResponse, error) {
+	f.record("CreateBucket")
+	if f.buckets == nil {
+		f.buckets = map[string]objectstorage.CreateBucketDetails{}
+	}
+	f.buckets[*request.Name] = request.CreateBucketDetails
+	return objectstorage.CreateBucketResponse{Bucket: objectstorage.Bucket{Name: request.Name}}, nil
+}
+
+func (f *fakeObjectStorage) lifecycleETag() *string {
+	return common.String(fmt.Sprintf("lifecycle-%d", f.lifecycleVersion))
+}
+
+func (f *fakeObjectStorage) GetObjectLifecyclePolicy(
+	_ context.Context, _ objectstorage.GetObjectLifecyclePolicyRequest,
+) (objectstorage.GetObjectLifecyclePolicyResponse, error) {
+	f.record("GetObjectLifecyclePolicy")
+	if f.lifecycle == nil {
+		return objectstorage.GetObjectLifecyclePolicyResponse{}, fakeServiceError{status: 404, code: "LifecyclePolicyNotFound"}
+	}
+	return objectstorage.GetObjectLifecyclePolicyResponse{
+		ObjectLifecyclePolicy: objectstorage.ObjectLifecyclePolicy{Items: f.lifecycle},
+		ETag:                  f.lifecycleETag(),
+	}, nil
+}
+
+// writeLifecycle honours If-Match and If-None-Match like OCI, failing with
+// 412 if the policy changed since it was read
+func (f *fakeObjectStorage) writeLifecycle(ifMatch, ifNoneMatch *string, rules []objectstorage.ObjectLifecycleRule) error {
+	if f.beforeLifecycleWrite != nil {
+		f.beforeLifecycleWrite()
+	}
+	if (ifMatch != nil && (f.lifecycle == nil || *ifMatch != *f.lifecycleETag())) || (ifNoneMatch != nil && f.lifecycle != nil) {
+		return fakeServiceError{status: 412, code: "IfMatchFailed"}
+	}
+	f.lifecycle = rules
+	f.lifecycleVersion++
+	return nil
+}
+
+func (f *fakeObjectStorage) PutObjectLifecyclePolicy(
+	_ context.Context, request objectstorage.PutObjectLifecyclePolicyRequest,
+) (objectstorage.PutObjectLifecyclePolicyResponse, error) {
+	f.record("PutObjectLifecyclePolicy")
+	err := f.writeLifecycle(request.IfMatch, request.IfNoneMatch, request.Items)
+	return objectstorage.PutObjectLifecyclePolicyResponse{}, err
+}
+
+func (f *fakeObjectStorage) DeleteObjectLifecyclePolicy(
+	_ context.Context, request objectstorage.DeleteObjectLifecyclePolicyRequest,
+) (objectstorage.DeleteObjectLifecyclePolicyResponse, error) {
+	f.record("DeleteObjectLifecyclePolicy")
+	err := f.writeLifecycle(request.IfMatch, nil, nil)
+	return objectstorage.DeleteObjectLifecyclePolicyResponse{}, err
+}
+
+func (f *fakeObjectStorage) CreateMultipartUpload(
+	_ context.Context, request objectstorage.CreateMultipartUploadRequest,
+) (objectstorage.CreateMultipartUploadResponse, error) {
+	f.record("CreateMultipartUpload")
+	if f.parts == nil {
+		f.parts = map[string]map[int][]byte{}
+	}
+	f.parts[*request.Object] = map[int][]byte{}
+	return objectstorage.CreateMultipartUploadResponse{
+		MultipartUpload: objectstorage.MultipartUpload{Object: request.Object, UploadId: request.Object},
+	}, nil
+}
+
+func (f *fakeObjectStorage) UploadPart(
+	_ context.Context, request objectstorage.UploadPartRequest,
+) (objectstorage.UploadPartResponse, error) {
+	f.record("UploadPart")
+	data, err := io.ReadAll(request.UploadPartBody)
+	if err != nil {
+		return objectstorage.UploadPartResponse{}, err
+	}
+	f.parts[*request.UploadId][*request.UploadPartNum] = data
+	return objectstorage.UploadPartResponse{ETag: common.String(fmt.Sprintf("etag-%d", *request.UploadPartNum))}, nil
+}
+
+func (f *fakeObjectStorage) CommitMultipartUpload(
+	_ context.Context, request objectstorage.CommitMultipartUploadRequest,
+) (objectstorage.CommitMultipartUploadResponse, error) {
+	f.record("CommitMultipartUpload")
+	var object []byte
+	for _, p := range request.PartsToCommit {
+		object = append(object, f.parts[*request.UploadId][*p.PartNum]...)
+	}
+	if f.objects == nil {
+		f.objects = map[string][]byte{}
+	}
+	f.objects[*request.ObjectName] = object
+	if f.created == nil {
+		f.created = map[string]time.Time{}
+	}
+	f.created[*request.ObjectName] = time.Now()
+	delete(f.parts, *request.UploadId)
+	return objectstorage.CommitMultipartUploadResponse{}, nil
+}
+
+func (f *fakeObjectStorage) AbortMultipartUpload(
+	_ context.Context, request objectstorage.AbortMultipartUploadRequest,
+) (objectstorage.AbortMultipartUploadResponse, error) {
+	f.record("AbortMultipartUpload")
+	delete(f.parts, *request.UploadId)
+	return objectstorage.AbortMultipartUploadResponse{}, nil
+}
+
+func (f *fakeObjectStorage) GetObject(_ context.Context, request objectstorage.GetObjectRequest) (objectstorage.GetObjectResponse, error) {
+	f.record("GetObject")
+	object, ok := f.objects[*request.ObjectName]
+	if !ok {
+		return objectstorage.GetObjectResponse{}, fakeServiceError{status: 404, code: "ObjectNotFound"}
+	}
+	return objectstorage.GetObjectResponse{Content: io.NopCloser(bytes.NewReader(object))}, nil
+}
+
+func (f *fakeObjectStorage) ListObjects(
+	_ context.Context, request objectstorage.ListObjectsRequest,
+) (objectstorage.ListObjectsResponse, error) {
+	f.record("ListObjects")
+	var names []string
+	for name := range f.objects {
+		if request.Prefix == nil || strings.HasPrefix(name, *request.Prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	summaries := []objectstorage.ObjectSummary{}
+	for _, name := range names {
+		summaries = append(summaries, objectstorage.ObjectSummary{
+			Name:        common.String(name),
+			Size:        common.Int64(int64(len(f.objects[name]))),
+			TimeCreated: &common.SDKTime{Time: f.created[name]},
+		})
+	}
+	items, next := fakePage(summaries, request.Start)
+	return objectstorage.ListObjectsResponse{ListObjects: objectstorage.ListObjects{Objects: items, NextStartWith: next}}, nil
+}
+
+// fakeMachine is a workspace machine on the fakes: an instance in state with
+// its VNIC, a 50 GB boot volume and a 100 GB home volume
+type fakeMachine struct {
+	*Oracle
+
+	compute       *fakeCompute
+	network       *fakeNetwork
+	blockstorage  *fakeBlockstorage
+	objectStorage *fakeObjectStorage
+	opts          *options.Options
+}
+
+func newFakeMachine(t *testing.T, state core.InstanceLifecycleStateEnum) *fakeMachine {
+	machineID := "test-machine-id"
+	m := &fakeMachine{
+		compute: &fakeCompute{
+			instances: []core.Instance{{
+				Id:                 common.String("instance-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				CompartmentId:      common.String("compartment-id"),
+				DisplayName:        common.String(instanceName(machineID)),
+				Shape:              common.String("VM.Standard.E4.Flex"),
+				ShapeConfig:        &core.InstanceShapeConfig{Ocpus: common.Float32(2), MemoryInGBs: common.Float32(16)},
+				Metadata:           map[string]string{"user_data": "data"},
+				LifecycleState:     state,
+				FreeformTags:       map[string]string{labelMachineID: machineID},
+			}},
+			vnicAttachments: []core.VnicAttachment{{
+				InstanceId:     common.String("instance-id"),
+				VnicId:         common.String("vnic-id"),
+				LifecycleState: core.VnicAttachmentLifecycleStateAttached,
+			}},
+			bootAttachments: []core.BootVolumeAttachment{{
+				InstanceId:     common.String("instance-id"),
+				BootVolumeId:   common.String("boot-volume-id"),
+				LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+			}},
+		},
+		network: &fakeNetwork{
+			vnics: []core.Vnic{{
+				Id:             common.String("vnic-id"),
+				SubnetId:       common.String("subnet-id"),
+				PublicIp:       common.String("192.0.2.10"),
+				LifecycleState: core.VnicLifecycleStateAvailable,
+				FreeformTags:   map[string]string{labelMachineID: machineID},
+			}},
+		},
+		blockstorage: &fakeBlockstorage{
+			bootVolumes: []core.BootVolume{{
+				Id:             common.String("boot-volume-id"),
+				SizeInGBs:      common.Int64(50),
+				LifecycleState: core.BootVolumeLifecycleStateAvailable,
+			}},
+			volumes: []core.Volume{{
+				Id:                 common.String("home-volume-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				DisplayName:        common.String(homeVolumeName(machineID)),
+				SizeInGBs:          common.Int64(100),
+				LifecycleState:     core.VolumeLifecycleStateAvailable,
+				FreeformTags:       map[string]string{labelMachineID: machineID},
+			}},
+		},
+		objectStorage: &fakeObjectStorage{},
+		opts: &options.Options{
+			MachineID:          machineID,
+			MachineFolder:      t.TempDir(),
+			CompartmentID:      "compartment-id",
+			AvailabilityDomain: "AD-1",
+			HomeVolumeSize:     100,
+			StopMode:           options.StopModeStop,
+			BackupBucket:       "devpod-backups",
+		},
+	}
+	m.Oracle = &Oracle{
+		computeClient:       m.compute,
+		networkClient:       m.network,
+		blockstorageClient:  m.blockstorage,
+		objectStorageClient: func(string) (objectStorageAPI, error) { return m.objectStorage, nil },
+	}
+
+	return m
+}
+
+// park stops the running machine in terminate mode, keeping only its boot
+// volume
+func (m *fakeMachine) park(t *testing.T) {
+	m.opts.StopMode = options.StopModeTerminate
+
+	assert.NoError(t, m.StopInstance(context.Background(), m.opts))
+}
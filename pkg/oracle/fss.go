@@ -0,0 +1,556 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/filestorage"
+	"github.com/pkg/errors"
+)
+
+// nfsPorts are the ports a mount target serves NFS on: the portmapper on 111
+// and the NFS and mount daemons on 2048-2050
+var nfsPorts = []struct {
+	protocol string
+	min, max int
+}{
+	{protocolTCP, 111, 111},
+	{protocolTCP, 2048, 2050},
+	{protocolUDP, 111, 111},
+	{protocolUDP, 2048, 2048},
+}
+
+func networkSecurityGroupKey(n core.NetworkSecurityGroup) (id *string, created *common.SDKTime) {
+	return n.Id, n.TimeCreated
+}
+
+func fileSystemKey(f filestorage.FileSystemSummary) (id *string, created *common.SDKTime) {
+	return f.Id, f.TimeCreated
+}
+
+func mountTargetKey(m filestorage.MountTargetSummary) (id *string, created *common.SDKTime) {
+	return m.Id, m.TimeCreated
+}
+
+// sharedFileSystemSource returns the NFS source, <address>:<export path>, that
+// instances mount the shared file system from, or "" if none is configured
+func (o *Oracle) sharedFileSystemSource(ctx context.Context, opts *options.Options, vcn *core.Vcn, subnet *core.Subnet) (string, error) {
+	var mountTarget *filestorage.MountTarget
+	var err error
+	switch opts.FSSMountTarget {
+	case "":
+		return "", nil
+	case options.FSSMountTargetAuto:
+		mountTarget, err = o.ensureSharedFileSystem(ctx, opts, vcn, subnet)
+	default:
+		mountTarget, err = o.existingMountTarget(ctx, opts)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "shared file system")
+	}
+
+	if len(mountTarget.PrivateIpIds) == 0 {
+		return "", fmt.Errorf("mount target %s has no private IP", *mountTarget.Id)
+	}
+
+	response, err := o.networkClient.GetPrivateIp(ctx, core.GetPrivateIpRequest{PrivateIpId: &mountTarget.PrivateIpIds[0]})
+	if err != nil {
+		return "", errors.Wrap(err, "get mount target address")
+	}
+
+	return fmt.Sprintf("%s:%s", *response.IpAddress, opts.FSSExportPath), nil
+}
+
+// existingMountTarget returns the configured mount target once it is known
+// to export FSS_EXPORT_PATH
+func (o *Oracle) existingMountTarget(ctx context.Context, opts *options.Options) (*filestorage.MountTarget, error) {
+	response, err := o.fileStorageClient.GetMountTarget(ctx, filestorage.GetMountTargetRequest{MountTargetId: &opts.FSSMountTarget})
+	if err != nil {
+		return nil, errors.Wrap(err, "get mount target")
+	}
+	if response.LifecycleState != filestorage.MountTargetLifecycleStateActive {
+		return nil, ErrPlacementNotActive("mount target", opts.FSSMountTarget, string(response.LifecycleState))
+	}
+
+	exports, err := o.listExports(ctx, response.ExportSetId)
+	if err != nil {
+		return nil, err
+	}
+	if findExport(exports, opts.FSSExportPath) == nil {
+		return nil, ErrExportNotFound(opts.FSSExportPath, opts.FSSMountTarget)
+	}
+
+	return &response.MountTarget, nil
+}
+
+// ensureSharedFileSystem returns the devpod mount target in the devpod
+// subnet, creating whatever is missing of the file system, the mount target,
+// the security group that admits NFS from the VCN and the export at
+// FSS_EXPORT_PATH. Like the network, these are shared by every workspace in
+// the compartment and are not deleted with any of them.
+func (o *Oracle) ensureSharedFileSystem(
+	ctx context.Context, opts *options.Options, vcn *core.Vcn, subnet *core.Subnet,
+) (*filestorage.MountTarget, error) {
+	l, err := lockNetwork(ctx, opts.CompartmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLock(l)
+
+	availabilityDomain := opts.AvailabilityDomain
+	if subnet.AvailabilityDomain != nil {
+		availabilityDomain = *subnet.AvailabilityDomain
+	}
+
+	nsg, err := o.ensureNFSSecurityGroup(ctx, opts.CompartmentID, vcn)
+	if err != nil {
+		return nil, errors.Wrap(err, "nfs security group")
+	}
+
+	fileSystemID, err := o.ensureFileSystem(ctx, opts, availabilityDomain)
+	if err != nil {
+		return nil, errors.Wrap(err, "file system")
+	}
+
+	mountTarget, err := o.ensureMountTarget(ctx, opts, availabilityDomain, subnet.Id, nsg.Id)
+	if err != nil {
+		return nil, errors.Wrap(err, "mount target")
+	}
+
+	if err := o.ensureExport(ctx, opts, mountTarget.ExportSetId, fileSystemID); err != nil {
+		return nil, errors.Wrap(err, "export")
+	}
+
+	return mountTarget, nil
+}
+
+// ensureNFSSecurityGroup returns the devpod security group that admits NFS
+// from the VCN, creating it if needed. The rules are added after the group is
+// created, so they are checked every time in case that was interrupted.
+func (o *Oracle) ensureNFSSecurityGroup(ctx context.Context, compartmentID string, vcn *core.Vcn) (*core.NetworkSecurityGroup, error) {
+	nsg, err := o.findNFSSecurityGroup(ctx, compartmentID, vcn.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if nsg == nil {
+		created, err := createWithRetryToken(networkRetryToken(networkNFSSecurityGroupName, *vcn.Id),
+			func(token *string) (core.NetworkSecurityGroup, error) {
+				response, err := o.networkClient.CreateNetworkSecurityGroup(ctx, core.CreateNetworkSecurityGroupRequest{
+					CreateNetworkSecurityGroupDetails: core.CreateNetworkSecurityGroupDetails{
+						CompartmentId: &compartmentID,
+						VcnId:         vcn.Id,
+						DisplayName:   common.String(networkNFSSecurityGroupName),
+						FreeformTags: map[string]string{
+							labelType: labelTypeDevPod,
+						},
+					},
+					OpcRetryToken: token,
+				})
+				return response.NetworkSecurityGroup, err
+			},
+			func(n core.NetworkSecurityGroup) bool { return isTerminal(string(n.LifecycleState)) },
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := o.listNFSSecurityGroups(ctx, compartmentID, vcn.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		nsg = converge(networkNFSSecurityGroupName, created, found, networkSecurityGroupKey, func(id *string) error {
+			_, err := o.networkClient.DeleteNetworkSecurityGroup(ctx, core.DeleteNetworkSecurityGroupRequest{NetworkSecurityGroupId: id})
+			return err
+		})
+	}
+
+	rules, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.SecurityRule, *string, error) {
+		response, err := o.networkClient.ListNetworkSecurityGroupSecurityRules(ctx, core.ListNetworkSecurityGroupSecurityRulesRequest{
+			NetworkSecurityGroupId: nsg.Id,
+			Page:                   page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		return nsg, nil
+	}
+
+	log.Default.Infof("Adding NFS rules to security group %s", *nsg.Id)
+
+	_, err = o.networkClient.AddNetworkSecurityGroupSecurityRules(ctx, core.AddNetworkSecurityGroupSecurityRulesRequest{
+		NetworkSecurityGroupId: nsg.Id,
+		AddNetworkSecurityGroupSecurityRulesDetails: core.AddNetworkSecurityGroupSecurityRulesDetails{
+			SecurityRules: nfsSecurityRules(*vcn.CidrBlock),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nsg, nil
+}
+
+// nfsSecurityRules admit NFS from the source CIDR. They are stateful, so the
+// replies need no egress rules.
+func nfsSecurityRules(source string) []core.AddSecurityRuleDetails {
+	rules := make([]core.AddSecurityRuleDetails, 0, len(nfsPorts))
+	for _, p := range nfsPorts {
+		rule := core.AddSecurityRuleDetails{
+			Direction:   core.AddSecurityRuleDetailsDirectionIngress,
+			Protocol:    common.String(p.protocol),
+			Source:      common.String(source),
+			SourceType:  core.AddSecurityRuleDetailsSourceTypeCidrBlock,
+			Description: common.String("NFS from the devpod VCN"),
+		}
+
+		ports := &core.PortRange{Min: common.Int(p.min), Max: common.Int(p.max)}
+		if p.protocol == protocolTCP {
+			rule.TcpOptions = &core.TcpOptions{DestinationPortRange: ports}
+		} else {
+			rule.UdpOptions = &core.UdpOptions{DestinationPortRange: ports}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// ensureFileSystem returns the ID of the devpod file system, creating it if
+// needed. Concurrent creates from other hosts settle on the oldest one.
+func (o *Oracle) ensureFileSystem(ctx context.Context, opts *options.Options, availabilityDomain string) (*string, error) {
+	fileSystems, err := o.listSharedFileSystems(ctx, opts.CompartmentID, availabilityDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	var id *string
+	if fileSystem := oldest(fileSystems, fileSystemKey); fileSystem != nil {
+		id = fileSystem.Id
+	} else {
+		log.Default.Infof("Creating shared file system %s", sharedFileSystemName)
+
+		created, err := createWithRetryToken(networkRetryToken(sharedFileSystemName, availabilityDomain),
+			func(token *string) (filestorage.FileSystem, error) {
+				response, err := o.fileStorageClient.CreateFileSystem(ctx, filestorage.CreateFileSystemRequest{
+					CreateFileSystemDetails: filestorage.CreateFileSystemDetails{
+						CompartmentId:      &opts.CompartmentID,
+						AvailabilityDomain: &availabilityDomain,
+						DisplayName:        common.String(sharedFileSystemName),
+						FreeformTags: map[string]string{
+							labelType: labelTypeDevPod,
+						},
+					},
+					OpcRetryToken: token,
+				})
+				return response.FileSystem, err
+			},
+			func(f filestorage.FileSystem) bool { return isDeleted(string(f.LifecycleState)) },
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		id = created.Id
+		fileSystems, err = o.listSharedFileSystems(ctx, opts.CompartmentID, availabilityDomain)
+		if err != nil {
+			return nil, err
+		}
+		if fileSystem := oldest(fileSystems, fileSystemKey); fileSystem != nil {
+			id = fileSystem.Id
+		}
+	}
+
+	err = waitForLifecycleState(ctx, opts, "file system", "ACTIVE", func(ctx context.Context) (string, error) {
+		response, err := o.fileStorageClient.GetFileSystem(ctx, filestorage.GetFileSystemRequest{FileSystemId: id})
+		return string(response.LifecycleState), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// ensureMountTarget returns the devpod mount target in the subnet once it is
+// ACTIVE, creating it if needed. A new mount target takes a few minutes.
+func (o *Oracle) ensureMountTarget(
+	ctx context.Context, opts *options.Options, availabilityDomain string, subnetID, nsgID *string,
+) (*filestorage.MountTarget, error) {
+	mountTarget, err := o.findSharedMountTarget(ctx, opts.CompartmentID, availabilityDomain, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var id *string
+	if mountTarget != nil {
+		id = mountTarget.Id
+	} else {
+		log.Default.Infof("Creating shared mount target %s in subnet %s", sharedMountTargetName, *subnetID)
+
+		created, err := createWithRetryToken(networkRetryToken(sharedMountTargetName, *subnetID),
+			func(token *string) (filestorage.MountTarget, error) {
+				response, err := o.fileStorageClient.CreateMountTarget(ctx, filestorage.CreateMountTargetRequest{
+					CreateMountTargetDetails: filestorage.CreateMountTargetDetails{
+						CompartmentId:      &opts.CompartmentID,
+						AvailabilityDomain: &availabilityDomain,
+						SubnetId:           subnetID,
+						DisplayName:        common.String(sharedMountTargetName),
+						NsgIds:             []string{*nsgID},
+						FreeformTags: map[string]string{
+							labelType: labelTypeDevPod,
+						},
+					},
+					OpcRetryToken: token,
+				})
+				return response.MountTarget, err
+			},
+			func(m filestorage.MountTarget) bool { return isDeleted(string(m.LifecycleState)) },
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		id = created.Id
+		mountTarget, err = o.findSharedMountTarget(ctx, opts.CompartmentID, availabilityDomain, subnetID)
+		if err != nil {
+			return nil, err
+		}
+		if mountTarget != nil {
+			id = mountTarget.Id
+		}
+	}
+
+	var current filestorage.MountTarget
+	err = waitForLifecycleState(ctx, opts, "mount target", "ACTIVE", func(ctx context.Context) (string, error) {
+		response, err := o.fileStorageClient.GetMountTarget(ctx, filestorage.GetMountTargetRequest{MountTargetId: id})
+		current = response.MountTarget
+		return string(response.LifecycleState), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &current, nil
+}
+
+// ensureExport exports the file system at FSS_EXPORT_PATH on the mount
+// target, unless it already is
+func (o *Oracle) ensureExport(ctx context.Context, opts *options.Options, exportSetID, fileSystemID *string) error {
+	exports, err := o.listExports(ctx, exportSetID)
+	if err != nil {
+		return err
+	}
+
+	export := findExport(exports, opts.FSSExportPath)
+	if export == nil {
+		log.Default.Infof("Exporting shared file system at %s", opts.FSSExportPath)
+
+		_, err = o.fileStorageClient.CreateExport(ctx, filestorage.CreateExportRequest{
+			CreateExportDetails: filestorage.CreateExportDetails{
+				ExportSetId:  exportSetID,
+				FileSystemId: fileSystemID,
+				Path:         &opts.FSSExportPath,
+			},
+			OpcRetryToken: common.String(retryToken("export", *exportSetID, opts.FSSExportPath)),
+		})
+		if err == nil || !isConflict(err) {
+			return err
+		}
+
+		// Another host exported the path first, possibly for something else
+		exports, err = o.listExports(ctx, exportSetID)
+		if err != nil {
+			return err
+		}
+		export = findExport(exports, opts.FSSExportPath)
+	}
+
+	if export == nil || *export.FileSystemId != *fileSystemID {
+		return ErrExportInUse(opts.FSSExportPath, *fileSystemID)
+	}
+
+	return nil
+}
+
+// sharedMountTargetInSubnet returns the devpod mount target in the subnet, or
+// nil if there is none
+func (o *Oracle) sharedMountTargetInSubnet(
+	ctx context.Context, compartmentID string, subnet *core.Subnet,
+) (*filestorage.MountTargetSummary, error) {
+	if subnet.AvailabilityDomain == nil {
+		return nil, nil
+	}
+
+	return o.findSharedMountTarget(ctx, compartmentID, *subnet.AvailabilityDomain, subnet.Id)
+}
+
+// deleteNFSSecurityGroup removes the devpod NFS security group from the VCN,
+// which cannot be deleted while the group exists
+func (o *Oracle) deleteNFSSecurityGroup(ctx context.Context, compartmentID string, vcnID *string) error {
+	nsg, err := o.findNFSSecurityGroup(ctx, compartmentID, vcnID)
+	if err != nil || nsg == nil {
+		return err
+	}
+
+	log.Default.Infof("Deleting network security group: %s", *nsg.Id)
+
+	_, err = o.networkClient.DeleteNetworkSecurityGroup(ctx, core.DeleteNetworkSecurityGroupRequest{NetworkSecurityGroupId: nsg.Id})
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	return waitForDeletion(ctx, func() (bool, error) {
+		res, err := o.networkClient.GetNetworkSecurityGroup(ctx, core.GetNetworkSecurityGroupRequest{NetworkSecurityGroupId: nsg.Id})
+		return res.LifecycleState == core.NetworkSecurityGroupLifecycleStateTerminated, err
+	})
+}
+
+func (o *Oracle) findNFSSecurityGroup(ctx context.Context, compartmentID string, vcnID *string) (*core.NetworkSecurityGroup, error) {
+	nsgs, err := o.listNFSSecurityGroups(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+	return oldest(nsgs, networkSecurityGroupKey), nil
+}
+
+func (o *Oracle) findSharedMountTarget(
+	ctx context.Context, compartmentID, availabilityDomain string, subnetID *string,
+) (*filestorage.MountTargetSummary, error) {
+	mountTargets, err := listAll(ctx, func(ctx context.Context, page *string) ([]filestorage.MountTargetSummary, *string, error) {
+		response, err := o.fileStorageClient.ListMountTargets(ctx, filestorage.ListMountTargetsRequest{
+			CompartmentId:      &compartmentID,
+			AvailabilityDomain: &availabilityDomain,
+			DisplayName:        common.String(sharedMountTargetName),
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var live []filestorage.MountTargetSummary
+	for _, m := range mountTargets {
+		if m.FreeformTags[labelType] == labelTypeDevPod && *m.SubnetId == *subnetID && !isDeleted(string(m.LifecycleState)) {
+			live = append(live, m)
+		}
+	}
+
+	return oldest(live, mountTargetKey), nil
+}
+
+// listNFSSecurityGroups returns every live devpod NFS security group in the VCN
+func (o *Oracle) listNFSSecurityGroups(ctx context.Context, compartmentID string, vcnID *string) ([]core.NetworkSecurityGroup, error) {
+	nsgs, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.NetworkSecurityGroup, *string, error) {
+		response, err := o.networkClient.ListNetworkSecurityGroups(ctx, core.ListNetworkSecurityGroupsRequest{
+			CompartmentId: &compartmentID,
+			VcnId:         vcnID,
+			DisplayName:   common.String(networkNFSSecurityGroupName),
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var live []core.NetworkSecurityGroup
+	for _, n := range nsgs {
+		if n.FreeformTags[labelType] == labelTypeDevPod && !isTerminal(string(n.LifecycleState)) {
+			live = append(live, n)
+		}
+	}
+
+	return live, nil
+}
+
+// listSharedFileSystems returns every live devpod file system in the
+// availability domain
+func (o *Oracle) listSharedFileSystems(
+	ctx context.Context, compartmentID, availabilityDomain string,
+) ([]filestorage.FileSystemSummary, error) {
+	fileSystems, err := listAll(ctx, func(ctx context.Context, page *string) ([]filestorage.FileSystemSummary, *string, error) {
+		response, err := o.fileStorageClient.ListFileSystems(ctx, filestorage.ListFileSystemsRequest{
+			CompartmentId:      &compartmentID,
+			AvailabilityDomain: &availabilityDomain,
+			DisplayName:        common.String(sharedFileSystemName),
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var live []filestorage.FileSystemSummary
+	for _, f := range fileSystems {
+		if f.FreeformTags[labelType] == labelTypeDevPod && !isDeleted(string(f.LifecycleState)) {
+			live = append(live, f)
+		}
+	}
+
+	return live, nil
+}
+
+// listExports returns the live exports of a mount target's export set
+func (o *Oracle) listExports(ctx context.Context, exportSetID *string) ([]filestorage.ExportSummary, error) {
+	exports, err := listAll(ctx, func(ctx context.Context, page *string) ([]filestorage.ExportSummary, *string, error) {
+		response, err := o.fileStorageClient.ListExports(ctx, filestorage.ListExportsRequest{
+			ExportSetId: exportSetID,
+			Page:        page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var live []filestorage.ExportSummary
+	for _, e := range exports {
+		if !isDeleted(string(e.LifecycleState)) {
+			live = append(live, e)
+		}
+	}
+
+	return live, nil
+}
+
+func findExport(exports []filestorage.ExportSummary, path string) *filestorage.ExportSummary {
+	for i := range exports {
+		if *exports[i].Path == path {
+			return &exports[i]
+		}
+	}
+	return nil
+}
+
+// isDeleted reports whether a file storage lifecycle state means the
+// resource is going away and must not be reused
+func isDeleted(state string) bool {
+	return state == "DELETING" || state == "DELETED"
+}
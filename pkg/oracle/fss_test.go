@@ -0,0 +1,235 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/filestorage"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func sharedFileSystemOptions(mountTarget string) *options.Options {
+	return &options.Options{
+		CompartmentID:      "compartment-id",
+		AvailabilityDomain: "AD-1",
+		FSSMountTarget:     mountTarget,
+		FSSExportPath:      "/devpod",
+		FSSMountPath:       "/mnt/shared",
+	}
+}
+
+func TestSharedFileSystemSourceAuto(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	vcn := &core.Vcn{Id: common.String("vcn-id"), CidrBlock: common.String("10.0.0.0/16")}
+	subnet := &core.Subnet{Id: common.String("subnet-id"), AvailabilityDomain: common.String("AD-1")}
+	network := &fakeNetwork{}
+	fileStorage := &fakeFileStorage{network: network}
+	o := &Oracle{networkClient: network, fileStorageClient: fileStorage}
+	opts := sharedFileSystemOptions(options.FSSMountTargetAuto)
+
+	// The second workspace reuses everything the first one created
+	for i := 0; i < 2; i++ {
+		source, err := o.sharedFileSystemSource(context.Background(), opts, vcn, subnet)
+		assert.NoError(err)
+		assert.Equal("10.0.0.100:/devpod", source)
+	}
+
+	assert.Equal(1, network.calls["CreateNetworkSecurityGroup"])
+	assert.Equal(1, network.calls["AddNetworkSecurityGroupSecurityRules"])
+	assert.Equal(1, fileStorage.calls["CreateFileSystem"])
+	assert.Equal(1, fileStorage.calls["CreateMountTarget"])
+	assert.Equal(1, fileStorage.calls["CreateExport"])
+
+	if assert.Len(network.nsgs, 1) && assert.Len(fileStorage.mountTargets, 1) {
+		assert.Equal([]string{*network.nsgs[0].Id}, fileStorage.mountTargets[0].NsgIds)
+		assert.Equal("subnet-id", *fileStorage.mountTargets[0].SubnetId)
+
+		rules := network.nsgRules[*network.nsgs[0].Id]
+		assert.Len(rules, len(nfsPorts))
+		for _, r := range rules {
+			assert.Equal(core.SecurityRuleDirectionIngress, r.Direction)
+			assert.Equal("10.0.0.0/16", *r.Source)
+		}
+	}
+	if assert.Len(fileStorage.exports, 1) {
+		assert.Equal(*fileStorage.fileSystems[0].Id, *fileStorage.exports[0].FileSystemId)
+	}
+}
+
+func TestSharedFileSystemSourceExisting(t *testing.T) {
+	mountTarget := func(state filestorage.MountTargetLifecycleStateEnum) filestorage.MountTarget {
+		return filestorage.MountTarget{
+			Id:             common.String("mount-target-id"),
+			ExportSetId:    common.String("export-set-id"),
+			PrivateIpIds:   []string{"private-ip-id"},
+			LifecycleState: state,
+		}
+	}
+	export := filestorage.ExportSummary{
+		ExportSetId:    common.String("export-set-id"),
+		FileSystemId:   common.String("file-system-id"),
+		Path:           common.String("/devpod"),
+		LifecycleState: filestorage.ExportSummaryLifecycleStateActive,
+	}
+
+	tests := []struct {
+		Name         string
+		MountTarget  string
+		MountTargets []filestorage.MountTarget
+		Exports      []filestorage.ExportSummary
+		Source       string
+		Error        error
+	}{
+		{
+			Name: "not configured",
+		},
+		{
+			Name:         "exported",
+			MountTarget:  "mount-target-id",
+			MountTargets: []filestorage.MountTarget{mountTarget(filestorage.MountTargetLifecycleStateActive)},
+			Exports:      []filestorage.ExportSummary{export},
+			Source:       "10.0.5.5:/devpod",
+		},
+		{
+			Name:         "not exported",
+			MountTarget:  "mount-target-id",
+			MountTargets: []filestorage.MountTarget{mountTarget(filestorage.MountTargetLifecycleStateActive)},
+			Error:        ErrExportNotFound("/devpod", "mount-target-id"),
+		},
+		{
+			Name:         "not active",
+			MountTarget:  "mount-target-id",
+			MountTargets: []filestorage.MountTarget{mountTarget(filestorage.MountTargetLifecycleStateCreating)},
+			Exports:      []filestorage.ExportSummary{export},
+			Error:        ErrPlacementNotActive("mount target", "mount-target-id", "CREATING"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			network := &fakeNetwork{privateIps: []core.PrivateIp{
+				{Id: common.String("private-ip-id"), IpAddress: common.String("10.0.5.5")},
+			}}
+			fileStorage := &fakeFileStorage{mountTargets: test.MountTargets, exports: test.Exports}
+			o := &Oracle{networkClient: network, fileStorageClient: fileStorage}
+
+			source, err := o.sharedFileSystemSource(context.Background(), sharedFileSystemOptions(test.MountTarget), nil, nil)
+			if test.Error == nil {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, "shared file system: "+test.Error.Error())
+			}
+			assert.Equal(test.Source, source)
+			assert.Zero(fileStorage.calls["CreateExport"])
+		})
+	}
+}
+
+func TestEnsureExportInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	fileStorage := &fakeFileStorage{exports: []filestorage.ExportSummary{{
+		ExportSetId:    common.String("export-set-id"),
+		FileSystemId:   common.String("other-file-system-id"),
+		Path:           common.String("/devpod"),
+		LifecycleState: filestorage.ExportSummaryLifecycleStateActive,
+	}}}
+	o := &Oracle{fileStorageClient: fileStorage}
+
+	err := o.ensureExport(context.Background(), sharedFileSystemOptions(options.FSSMountTargetAuto),
+		common.String("export-set-id"), common.String("file-system-id"))
+	assert.EqualError(err, ErrExportInUse("/devpod", "file-system-id").Error())
+	assert.Zero(fileStorage.calls["CreateExport"])
+}
+
+func TestDestroyNetworkKeepsSharedMountTarget(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	for _, shared := range []bool{false, true} {
+		assert := assert.New(t)
+
+		network := &fakeNetwork{
+			vcns: []core.Vcn{{
+				Id:             common.String("vcn-id"),
+				DisplayName:    common.String(networkVCNName),
+				LifecycleState: core.VcnLifecycleStateAvailable,
+			}},
+			subnets: []core.Subnet{{
+				Id:                 common.String("subnet-id"),
+				DisplayName:        common.String(networkSubnetName),
+				VcnId:              common.String("vcn-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				LifecycleState:     core.SubnetLifecycleStateAvailable,
+			}},
+			vnics: []core.Vnic{{Id: common.String("mount-target-vnic"), LifecycleState: core.VnicLifecycleStateAvailable}},
+			privateIps: []core.PrivateIp{{
+				Id:       common.String("private-ip-id"),
+				SubnetId: common.String("subnet-id"),
+				VnicId:   common.String("mount-target-vnic"),
+			}},
+		}
+		fileStorage := &fakeFileStorage{}
+		if shared {
+			fileStorage.mountTargets = []filestorage.MountTarget{{
+				Id:             common.String("mount-target-id"),
+				SubnetId:       common.String("subnet-id"),
+				DisplayName:    common.String(sharedMountTargetName),
+				FreeformTags:   map[string]string{labelType: labelTypeDevPod},
+				LifecycleState: filestorage.MountTargetLifecycleStateActive,
+			}}
+		}
+		o := &Oracle{networkClient: network, fileStorageClient: fileStorage}
+
+		err := o.DestroyNetwork(context.Background(), "compartment-id")
+		if shared {
+			assert.NoError(err)
+		} else {
+			assert.EqualError(err, ErrNetworkInUse("subnet-id", 1).Error())
+		}
+		assert.Zero(network.calls["DeleteSubnet"])
+	}
+}
+
+func TestGenerateCloudConfigSharedFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	o := &Oracle{}
+
+	for _, source := range []string{"", "10.0.0.100:/devpod"} {
+		config, err := o.generateCloudConfig("ssh-ed25519 AAAA", sharedFileSystemOptions(options.FSSMountTargetAuto), false, source)
+		assert.NoError(err)
+
+		var parsed map[string]interface{}
+		assert.NoError(yaml.Unmarshal([]byte(config), &parsed))
+		if source == "" {
+			assert.NotContains(config, "devpod-mount-shared")
+		} else {
+			assert.Contains(config, source+" /mnt/shared nfs ")
+			assert.Contains(config, sharedFstabOption)
+			assert.Contains(config, "chgrp devpod /mnt/shared")
+			assert.NotContains(config, "a+rwx")
+		}
+	}
+}
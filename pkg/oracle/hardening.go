@@ -0,0 +1,54 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// instanceOptions turns off the legacy IMDSv1 endpoints unless they are
+// asked for. Workspaces run untrusted code, and IMDSv2 requires a header that
+// a request forged through a workspace service cannot set.
+func instanceOptions(opts *options.Options) *core.InstanceOptions {
+	return &core.InstanceOptions{
+		AreLegacyImdsEndpointsDisabled: common.Bool(!opts.LegacyIMDSEndpoints),
+	}
+}
+
+// agentConfig sets the desired state of the Oracle Cloud Agent plugins named
+// in the options. Plugins that are not named keep their default state.
+func agentConfig(opts *options.Options) *core.LaunchInstanceAgentConfigDetails {
+	if len(opts.AgentPlugins) == 0 {
+		return nil
+	}
+
+	config := &core.LaunchInstanceAgentConfigDetails{}
+	for _, plugin := range opts.AgentPlugins {
+		state := core.InstanceAgentPluginConfigDetailsDesiredStateDisabled
+		if plugin.Enabled {
+			state = core.InstanceAgentPluginConfigDetailsDesiredStateEnabled
+		}
+
+		config.PluginsConfig = append(config.PluginsConfig, core.InstanceAgentPluginConfigDetails{
+			Name:         common.String(plugin.Name),
+			DesiredState: state,
+		})
+	}
+
+	return config
+}
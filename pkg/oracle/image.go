@@ -0,0 +1,175 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bakeCleanupCommand resets the instance so that an image taken from it boots
+// like a fresh one: cloud-init runs again with the new instance's metadata,
+// and host keys, the machine ID and this machine's SSH key are not shared
+// with every instance launched from the image. If a step fails, the host keys
+// and the SSH key are put back so that the workspace stays reachable.
+var bakeCleanupCommand = "(" + strings.Join([]string{
+	"sudo install -m 0600 ~/.ssh/authorized_keys " + bakeAuthorizedKeys,
+	"sudo cloud-init clean --logs --seed",
+	"sudo rm -f /etc/ssh/ssh_host_*",
+	"sudo truncate -s 0 /etc/machine-id",
+	"sudo sed -i '\\#" + homeVolumeDevice + " #d;\\#" + dockerVolumeDevice + " #d;\\#" + sharedFstabOption + "#d' /etc/fstab",
+	"rm -f ~/.ssh/authorized_keys ~/.bash_history",
+	"sync",
+}, " && ") + ") || { sudo ssh-keygen -A; sudo install -o " + sshUser + " -g " + sshUser + " -m 0600 " +
+	bakeAuthorizedKeys + " ~/.ssh/authorized_keys; exit 1; }"
+
+// bakeAuthorizedKeys keeps the SSH key of the machine during the cleanup. It
+// is on a tmpfs, so it does not end up in the image.
+const bakeAuthorizedKeys = "/run/devpod-bake-authorized-keys"
+
+// BakeImage creates a custom image from the machine's running instance, so
+// that later workspaces can set it as DISK_IMAGE and skip provisioning. The
+// instance is shut down while the image is taken and started again after,
+// when cloud-init regenerates its host keys and SSH key.
+func (o *Oracle) BakeImage(ctx context.Context, opts *options.Options, name string) (*core.Image, error) {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning {
+		return nil, ErrInstanceNotRunning(*instance.Id, string(instance.LifecycleState))
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", instanceName(opts.MachineID), time.Now().UTC().Format("20060102-150405"))
+	}
+
+	baseImage := o.baseImage(ctx, opts, instance)
+
+	log.Default.Info("Cleaning cloud-init state on the instance")
+
+	writer := log.Default.Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	if err := o.RunCommand(ctx, opts, bakeCleanupCommand, writer, writer); err != nil {
+		return nil, errors.Wrap(err, "clean instance")
+	}
+
+	image, err := o.createImage(ctx, opts, instance, name, baseImage)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.NoWait {
+		return image, nil
+	}
+
+	err = o.waitForAvailable(ctx, opts, "image", func(ctx context.Context) (string, error) {
+		response, err := o.computeClient.GetImage(ctx, core.GetImageRequest{ImageId: image.Id})
+		return string(response.LifecycleState), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	image.LifecycleState = core.ImageLifecycleStateAvailable
+
+	// OCI starts the instance again once the image is taken
+	if err := o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateRunning, opts.WaitTimeout); err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// createImage creates the image from the cleaned instance. If that fails, the
+// instance is rebooted, as it is unreachable until cloud-init has regenerated
+// its host keys and SSH key.
+func (o *Oracle) createImage(
+	ctx context.Context, opts *options.Options, instance *core.Instance, name, baseImage string,
+) (*core.Image, error) {
+	log.Default.Infof("Creating image %s from instance %s", name, *instance.Id)
+
+	// The retry token replays an image deleted since it was baked under the
+	// same name, which has to be created again
+	image, err := createWithRetryToken(retryToken("image", opts.MachineID, name),
+		func(token *string) (core.Image, error) {
+			response, err := o.computeClient.CreateImage(ctx, core.CreateImageRequest{
+				CreateImageDetails: core.CreateImageDetails{
+					CompartmentId: &opts.CompartmentID,
+					InstanceId:    instance.Id,
+					DisplayName:   &name,
+					FreeformTags: map[string]string{
+						labelType:            labelTypeDevPod,
+						labelProviderVersion: ProviderVersion,
+						labelBaseImage:       baseImage,
+					},
+				},
+				OpcRetryToken: token,
+			})
+			return response.Image, err
+		},
+		func(i core.Image) bool { return i.LifecycleState == core.ImageLifecycleStateDeleted },
+	)
+	if err != nil {
+		log.Default.Warnf("Rebooting instance %s to restore its host keys and SSH key", *instance.Id)
+
+		_, rebootErr := o.computeClient.InstanceAction(ctx, core.InstanceActionRequest{
+			InstanceId: instance.Id,
+			Action:     core.InstanceActionActionSoftreset,
+		})
+		if rebootErr != nil {
+			log.Default.Errorf("Unable to reboot instance %s: %v", *instance.Id, rebootErr)
+		}
+
+		return nil, errors.Wrap(err, "create image")
+	}
+
+	return &image, nil
+}
+
+// baseImage returns the name of the platform image the instance descends
+// from, following the tag of an image that was itself baked
+func (o *Oracle) baseImage(ctx context.Context, opts *options.Options, instance *core.Instance) string {
+	source, ok := instance.SourceDetails.(core.InstanceSourceViaImageDetails)
+	if !ok || source.ImageId == nil {
+		return opts.DiskImage
+	}
+
+	response, err := o.computeClient.GetImage(ctx, core.GetImageRequest{ImageId: source.ImageId})
+	if err != nil {
+		log.Default.Debugf("Unable to get image %s: %v", *source.ImageId, err)
+		return opts.DiskImage
+	}
+
+	if base := response.FreeformTags[labelBaseImage]; base != "" {
+		return base
+	}
+	return *response.DisplayName
+}
+
+// isBakedImage returns true for images created by bake-image, which are
+// already provisioned
+func isBakedImage(image *core.Image) bool {
+	return image.FreeformTags[labelType] == labelTypeDevPod && image.FreeformTags[labelBaseImage] != ""
+}
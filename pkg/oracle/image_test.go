@@ -0,0 +1,148 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseImage(t *testing.T) {
+	images := []core.Image{
+		{Id: common.String("platform-id"), DisplayName: common.String("Canonical-Ubuntu-22.04")},
+		{
+			Id:           common.String("baked-id"),
+			DisplayName:  common.String("devpod-go-toolchain"),
+			FreeformTags: map[string]string{labelType: labelTypeDevPod, labelBaseImage: "Canonical-Ubuntu-22.04"},
+		},
+	}
+
+	tests := []struct {
+		Name     string
+		Source   core.InstanceSourceDetails
+		Expected string
+	}{
+		{
+			Name:     "platform image",
+			Source:   core.InstanceSourceViaImageDetails{ImageId: common.String("platform-id")},
+			Expected: "Canonical-Ubuntu-22.04",
+		},
+		{
+			Name:     "baked image",
+			Source:   core.InstanceSourceViaImageDetails{ImageId: common.String("baked-id")},
+			Expected: "Canonical-Ubuntu-22.04",
+		},
+		{
+			Name:     "boot volume",
+			Source:   core.InstanceSourceViaBootVolumeDetails{BootVolumeId: common.String("boot-volume-id")},
+			Expected: "Oracle-Linux-9",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			o := &Oracle{computeClient: &fakeCompute{images: images}}
+			opts := &options.Options{DiskImage: "Oracle-Linux-9"}
+
+			base := o.baseImage(context.Background(), opts, &core.Instance{SourceDetails: test.Source})
+
+			assert.Equal(t, test.Expected, base)
+		})
+	}
+}
+
+func TestBakeImageNeedsRunningInstance(t *testing.T) {
+	machineID := "test-machine-id"
+	o := &Oracle{computeClient: &fakeCompute{instances: []core.Instance{{
+		Id:             common.String("instance-id"),
+		DisplayName:    common.String(instanceName(machineID)),
+		LifecycleState: core.InstanceLifecycleStateStopped,
+		FreeformTags:   map[string]string{labelMachineID: machineID},
+	}}}}
+
+	_, err := o.BakeImage(context.Background(), &options.Options{MachineID: machineID, MachineFolder: t.TempDir()}, "")
+
+	assert.EqualError(t, err, "instance instance-id is STOPPED - start it first")
+}
+
+func TestCreateImageFailureReboots(t *testing.T) {
+	assert := assert.New(t)
+
+	instance := core.Instance{Id: common.String("instance-id"), LifecycleState: core.InstanceLifecycleStateRunning}
+	compute := &fakeCompute{instances: []core.Instance{instance}, imageErr: fmt.Errorf("out of image quota")}
+	o := &Oracle{computeClient: compute}
+
+	_, err := o.createImage(context.Background(), &options.Options{MachineID: "test-machine-id"}, &instance, "image", "base")
+
+	assert.EqualError(err, "create image: out of image quota")
+	assert.Equal([]core.InstanceActionActionEnum{core.InstanceActionActionSoftreset}, compute.actions)
+}
+
+func TestCreateImageNameReused(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	instance := m.compute.instances[0]
+
+	_, err := m.createImage(ctx, m.opts, &instance, "golden", "base")
+	assert.NoError(err)
+	m.compute.images[0].LifecycleState = core.ImageLifecycleStateDeleted
+
+	// The retry token replays the deleted image, which must not be reused
+	image, err := m.createImage(ctx, m.opts, &instance, "golden", "base")
+	assert.NoError(err)
+	assert.Equal("baked-1", *image.Id)
+	assert.Equal(core.ImageLifecycleStateAvailable, image.LifecycleState)
+	assert.Equal(3, m.compute.calls["CreateImage"])
+	assert.Len(m.compute.images, 2)
+}
+
+func TestBakedImageSkipsProvisioning(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	for _, baked := range []bool{false, true} {
+		image := core.Image{Id: common.String("image-id"), DisplayName: common.String("image")}
+		if baked {
+			image.FreeformTags = map[string]string{labelType: labelTypeDevPod, labelBaseImage: "Canonical-Ubuntu-22.04"}
+		}
+		o := &Oracle{computeClient: &fakeCompute{images: []core.Image{image}}, networkClient: &fakeNetwork{}}
+		opts := &options.Options{
+			MachineID:          "test-machine-id",
+			CompartmentID:      "compartment-id",
+			AvailabilityDomain: "AD-1",
+			DiskImage:          "image",
+			DiskSize:           50,
+		}
+
+		publicKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMYMPf45N2zLPaI4SOxE4QJH/f4jhaLt7bSk75RVoIOA"
+
+		request, err := o.BuildInstanceOptions(context.Background(), opts, publicKey)
+		assert.NoError(t, err)
+
+		userData, err := base64.StdEncoding.DecodeString(request.Metadata["user_data"])
+		assert.NoError(t, err)
+		assert.Equal(t, !baked, strings.Contains(string(userData), "package_upgrade: true"))
+	}
+}
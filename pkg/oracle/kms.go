@@ -0,0 +1,88 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/keymanagement"
+	"github.com/pkg/errors"
+)
+
+// validateKMSKey checks that the key for volume encryption exists in a vault
+// of the vault compartment, is enabled and is an AES key, which is the only kind
+// block volumes can be encrypted with
+func (o *Oracle) validateKMSKey(ctx context.Context, opts *options.Options) error {
+	if opts.KMSKeyID == "" {
+		return nil
+	}
+
+	key, err := o.findKMSKey(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if key.LifecycleState != keymanagement.KeyLifecycleStateEnabled {
+		return ErrKMSKeyNotUsable(opts.KMSKeyID, "it is "+string(key.LifecycleState))
+	}
+	if key.KeyShape == nil || key.KeyShape.Algorithm != keymanagement.KeyShapeAlgorithmAes {
+		return ErrKMSKeyNotUsable(opts.KMSKeyID, "volumes can only be encrypted with AES keys")
+	}
+
+	log.Default.Debugf("Volumes will be encrypted with key %s", *key.DisplayName)
+
+	return nil
+}
+
+// findKMSKey looks the key up in each active vault of the vault compartment,
+// as keys are only served by the management endpoint of their vault
+func (o *Oracle) findKMSKey(ctx context.Context, opts *options.Options) (*keymanagement.Key, error) {
+	vaults, err := listAll(ctx, func(ctx context.Context, page *string) ([]keymanagement.VaultSummary, *string, error) {
+		response, err := o.kmsVaultClient.ListVaults(ctx, keymanagement.ListVaultsRequest{
+			CompartmentId: &opts.KMSVaultCompartmentID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list vaults")
+	}
+
+	for _, vault := range vaults {
+		if vault.LifecycleState != keymanagement.VaultSummaryLifecycleStateActive {
+			continue
+		}
+
+		client, err := o.kmsManagementClient(*vault.ManagementEndpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := client.GetKey(ctx, keymanagement.GetKeyRequest{KeyId: &opts.KMSKeyID})
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "get key from vault %s", *vault.DisplayName)
+		}
+
+		return &response.Key, nil
+	}
+
+	return nil, ErrKMSKeyNotFound(opts.KMSKeyID, opts.KMSVaultCompartmentID)
+}
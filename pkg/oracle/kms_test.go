@@ -0,0 +1,139 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/keymanagement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKMSKey(t *testing.T) {
+	vaults := []keymanagement.VaultSummary{
+		{
+			CompartmentId:      common.String("compartment-id"),
+			DisplayName:        common.String("deleted"),
+			ManagementEndpoint: common.String("https://deleted"),
+			LifecycleState:     keymanagement.VaultSummaryLifecycleStateDeleted,
+		},
+		{
+			CompartmentId:      common.String("compartment-id"),
+			DisplayName:        common.String("other"),
+			ManagementEndpoint: common.String("https://other"),
+			LifecycleState:     keymanagement.VaultSummaryLifecycleStateActive,
+		},
+		{
+			CompartmentId:      common.String("compartment-id"),
+			DisplayName:        common.String("vault"),
+			ManagementEndpoint: common.String("https://vault"),
+			LifecycleState:     keymanagement.VaultSummaryLifecycleStateActive,
+		},
+		{
+			CompartmentId:      common.String("vault-compartment-id"),
+			DisplayName:        common.String("shared"),
+			ManagementEndpoint: common.String("https://shared"),
+			LifecycleState:     keymanagement.VaultSummaryLifecycleStateActive,
+		},
+	}
+	key := func(state keymanagement.KeyLifecycleStateEnum, algorithm keymanagement.KeyShapeAlgorithmEnum) []keymanagement.Key {
+		return []keymanagement.Key{{
+			Id:             common.String("key-id"),
+			DisplayName:    common.String("key"),
+			LifecycleState: state,
+			KeyShape:       &keymanagement.KeyShape{Algorithm: algorithm},
+		}}
+	}
+
+	tests := []struct {
+		Name                  string
+		KeyID                 string
+		KMSVaultCompartmentID string
+		Keys                  []keymanagement.Key
+		SharedKeys            []keymanagement.Key
+		Error                 string
+	}{
+		{
+			Name: "no key",
+		},
+		{
+			Name:  "enabled AES key",
+			KeyID: "key-id",
+			Keys:  key(keymanagement.KeyLifecycleStateEnabled, keymanagement.KeyShapeAlgorithmAes),
+		},
+		{
+			Name:  "disabled key",
+			KeyID: "key-id",
+			Keys:  key(keymanagement.KeyLifecycleStateDisabled, keymanagement.KeyShapeAlgorithmAes),
+			Error: "KMS key key-id cannot encrypt volumes: it is DISABLED",
+		},
+		{
+			Name:  "RSA key",
+			KeyID: "key-id",
+			Keys:  key(keymanagement.KeyLifecycleStateEnabled, keymanagement.KeyShapeAlgorithmRsa),
+			Error: "KMS key key-id cannot encrypt volumes: volumes can only be encrypted with AES keys",
+		},
+		{
+			Name:  "missing key",
+			KeyID: "missing-key-id",
+			Keys:  key(keymanagement.KeyLifecycleStateEnabled, keymanagement.KeyShapeAlgorithmAes),
+			Error: "KMS key missing-key-id was not found in any active vault of compartment compartment-id",
+		},
+		{
+			Name:                  "key in vault compartment",
+			KeyID:                 "key-id",
+			KMSVaultCompartmentID: "vault-compartment-id",
+			SharedKeys:            key(keymanagement.KeyLifecycleStateEnabled, keymanagement.KeyShapeAlgorithmAes),
+		},
+		{
+			Name:       "key outside vault compartment",
+			KeyID:      "key-id",
+			SharedKeys: key(keymanagement.KeyLifecycleStateEnabled, keymanagement.KeyShapeAlgorithmAes),
+			Error:      "KMS key key-id was not found in any active vault of compartment compartment-id",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			kms := &fakeKMS{vaults: vaults, keys: map[string][]keymanagement.Key{
+				"https://vault":  test.Keys,
+				"https://shared": test.SharedKeys,
+			}}
+			o := &Oracle{kmsVaultClient: kms, kmsManagementClient: kms.managementClient}
+
+			vaultCompartmentID := test.KMSVaultCompartmentID
+			if vaultCompartmentID == "" {
+				vaultCompartmentID = "compartment-id"
+			}
+			err := o.validateKMSKey(context.Background(), &options.Options{
+				CompartmentID:         "compartment-id",
+				KMSKeyID:              test.KeyID,
+				KMSVaultCompartmentID: vaultCompartmentID,
+			})
+
+			if test.Error == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, test.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// createOrGetNetwork returns the shared devpod VCN and subnet, creating any
+// part of the stack that is missing. Parallel creates are expected - a team
+// opening several workspaces at once - so creation is serialised on this
+// host by a file lock and converges across hosts on the oldest resource.
+func (o *Oracle) createOrGetNetwork(ctx context.Context, compartmentID, availabilityDomain string) (*core.Vcn, *core.Subnet, error) {
+	l, err := lockNetwork(ctx, compartmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer releaseLock(l)
+
+	vcn, err := o.ensureVcn(ctx, compartmentID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "vcn")
+	}
+
+	ig, err := o.ensureInternetGateway(ctx, compartmentID, vcn.Id)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "internet gateway")
+	}
+
+	rt, err := o.ensureRouteTable(ctx, compartmentID, vcn.Id, ig.Id)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "route table")
+	}
+
+	subnet, err := o.ensureSubnet(ctx, compartmentID, availabilityDomain, vcn.Id, rt.Id)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "subnet")
+	}
+
+	return vcn, subnet, nil
+}
+
+func (o *Oracle) ensureVcn(ctx context.Context, compartmentID string) (*core.Vcn, error) {
+	vcn, err := o.findVcn(ctx, compartmentID)
+	if err != nil || vcn != nil {
+		return vcn, err
+	}
+
+	created, err := createWithRetryToken(networkRetryToken(networkVCNName, compartmentID),
+		func(token *string) (core.Vcn, error) {
+			response, err := o.networkClient.CreateVcn(ctx, core.CreateVcnRequest{
+				CreateVcnDetails: core.CreateVcnDetails{
+					CompartmentId: &compartmentID,
+					DisplayName:   common.String(networkVCNName),
+					CidrBlock:     common.String("10.0.0.0/16"),
+					DnsLabel:      common.String("devpodvcn"),
+					FreeformTags: map[string]string{
+						labelType: labelTypeDevPod,
+					},
+				},
+				OpcRetryToken: token,
+			})
+			return response.Vcn, err
+		},
+		func(v core.Vcn) bool { return isTerminal(string(v.LifecycleState)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := o.listVcns(ctx, compartmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return converge(networkVCNName, created, found, vcnKey, func(id *string) error {
+		_, err := o.networkClient.DeleteVcn(ctx, core.DeleteVcnRequest{VcnId: id})
+		return err
+	}), nil
+}
+
+func (o *Oracle) ensureInternetGateway(ctx context.Context, compartmentID string, vcnID *string) (*core.InternetGateway, error) {
+	ig, err := o.findInternetGateway(ctx, compartmentID, vcnID)
+	if err != nil || ig != nil {
+		return ig, err
+	}
+
+	created, err := createWithRetryToken(networkRetryToken(networkInternetGatewayName, *vcnID),
+		func(token *string) (core.InternetGateway, error) {
+			response, err := o.networkClient.CreateInternetGateway(ctx, core.CreateInternetGatewayRequest{
+				CreateInternetGatewayDetails: core.CreateInternetGatewayDetails{
+					CompartmentId: &compartmentID,
+					DisplayName:   common.String(networkInternetGatewayName),
+					VcnId:         vcnID,
+					IsEnabled:     common.Bool(true),
+					FreeformTags: map[string]string{
+						labelType: labelTypeDevPod,
+					},
+				},
+				OpcRetryToken: token,
+			})
+			return response.InternetGateway, err
+		},
+		func(i core.InternetGateway) bool { return isTerminal(string(i.LifecycleState)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := o.listInternetGateways(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return converge(networkInternetGatewayName, created, found, internetGatewayKey, func(id *string) error {
+		_, err := o.networkClient.DeleteInternetGateway(ctx, core.DeleteInternetGatewayRequest{IgId: id})
+		return err
+	}), nil
+}
+
+func (o *Oracle) ensureRouteTable(ctx context.Context, compartmentID string, vcnID, igID *string) (*core.RouteTable, error) {
+	rt, err := o.findRouteTable(ctx, compartmentID, vcnID)
+	if err != nil || rt != nil {
+		return rt, err
+	}
+
+	created, err := createWithRetryToken(networkRetryToken(networkRouteTableName, *vcnID),
+		func(token *string) (core.RouteTable, error) {
+			response, err := o.networkClient.CreateRouteTable(ctx, core.CreateRouteTableRequest{
+				CreateRouteTableDetails: core.CreateRouteTableDetails{
+					CompartmentId: &compartmentID,
+					DisplayName:   common.String(networkRouteTableName),
+					VcnId:         vcnID,
+					RouteRules: []core.RouteRule{
+						{
+							NetworkEntityId: igID,
+							Destination:     common.String("0.0.0.0/0"),
+							DestinationType: core.RouteRuleDestinationTypeCidrBlock,
+						},
+					},
+					FreeformTags: map[string]string{
+						labelType: labelTypeDevPod,
+					},
+				},
+				OpcRetryToken: token,
+			})
+			return response.RouteTable, err
+		},
+		func(r core.RouteTable) bool { return isTerminal(string(r.LifecycleState)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := o.listRouteTables(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return converge(networkRouteTableName, created, found, routeTableKey, func(id *string) error {
+		_, err := o.networkClient.DeleteRouteTable(ctx, core.DeleteRouteTableRequest{RtId: id})
+		return err
+	}), nil
+}
+
+func (o *Oracle) ensureSubnet(ctx context.Context, compartmentID, availabilityDomain string, vcnID, rtID *string) (*core.Subnet, error) {
+	subnet, err := o.findSubnet(ctx, compartmentID, vcnID)
+	if err != nil || subnet != nil {
+		return subnet, err
+	}
+
+	created, err := createWithRetryToken(networkRetryToken(networkSubnetName, *vcnID),
+		func(token *string) (core.Subnet, error) {
+			response, err := o.networkClient.CreateSubnet(ctx, core.CreateSubnetRequest{
+				CreateSubnetDetails: core.CreateSubnetDetails{
+					CompartmentId:      &compartmentID,
+					DisplayName:        common.String(networkSubnetName),
+					VcnId:              vcnID,
+					CidrBlock:          common.String("10.0.0.0/24"),
+					RouteTableId:       rtID,
+					DnsLabel:           common.String("devpodsubnet"),
+					AvailabilityDomain: &availabilityDomain,
+					FreeformTags: map[string]string{
+						labelType: labelTypeDevPod,
+					},
+				},
+				OpcRetryToken: token,
+			})
+			return response.Subnet, err
+		},
+		func(s core.Subnet) bool { return isTerminal(string(s.LifecycleState)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := o.listSubnets(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return converge(networkSubnetName, created, found, subnetKey, func(id *string) error {
+		_, err := o.networkClient.DeleteSubnet(ctx, core.DeleteSubnetRequest{SubnetId: id})
+		return err
+	}), nil
+}
+
+// DestroyNetwork removes the shared devpod network stack from the compartment.
+// Nothing is removed while devpod VNICs are still attached to the subnet, so
+// it is safe to call after every workspace deletion.
+func (o *Oracle) DestroyNetwork(ctx context.Context, compartmentID string) error {
+	l, err := lockNetwork(ctx, compartmentID)
+	if err != nil {
+		return err
+	}
+	defer releaseLock(l)
+
+	vcn, err := o.findVcn(ctx, compartmentID)
+	if err != nil {
+		return err
+	}
+	if vcn == nil {
+		log.Default.Debug("No devpod network found")
+		return nil
+	}
+
+	subnet, err := o.findSubnet(ctx, compartmentID, vcn.Id)
+	if err != nil {
+		return err
+	}
+
+	if subnet != nil {
+		devpodVnics, otherVnics, err := o.countSubnetVnics(ctx, subnet.Id)
+		if err != nil {
+			return errors.Wrap(err, "list subnet vnics")
+		}
+		if devpodVnics > 0 {
+			log.Default.Infof("Network still in use by %d devpod VNIC(s) - skipping cleanup", devpodVnics)
+			return nil
+		}
+		if otherVnics > 0 {
+			return o.subnetInUse(ctx, compartmentID, subnet, otherVnics)
+		}
+
+		log.Default.Infof("Deleting subnet: %s", *subnet.Id)
+		if _, err := o.networkClient.DeleteSubnet(ctx, core.DeleteSubnetRequest{SubnetId: subnet.Id}); err != nil && !IsNotFound(err) {
+			return errors.Wrap(err, "delete subnet")
+		}
+		if err := waitForDeletion(ctx, func() (bool, error) {
+			res, err := o.networkClient.GetSubnet(ctx, core.GetSubnetRequest{SubnetId: subnet.Id})
+			return res.LifecycleState == core.SubnetLifecycleStateTerminated, err
+		}); err != nil {
+			return errors.Wrap(err, "wait for subnet deletion")
+		}
+	}
+
+	// The route table references the internet gateway, so it must go first
+	rt, err := o.findRouteTable(ctx, compartmentID, vcn.Id)
+	if err != nil {
+		return err
+	}
+	if rt != nil {
+		log.Default.Infof("Deleting route table: %s", *rt.Id)
+		if _, err := o.networkClient.DeleteRouteTable(ctx, core.DeleteRouteTableRequest{RtId: rt.Id}); err != nil && !IsNotFound(err) {
+			return errors.Wrap(err, "delete route table")
+		}
+		if err := waitForDeletion(ctx, func() (bool, error) {
+			res, err := o.networkClient.GetRouteTable(ctx, core.GetRouteTableRequest{RtId: rt.Id})
+			return res.LifecycleState == core.RouteTableLifecycleStateTerminated, err
+		}); err != nil {
+			return errors.Wrap(err, "wait for route table deletion")
+		}
+	}
+
+	ig, err := o.findInternetGateway(ctx, compartmentID, vcn.Id)
+	if err != nil {
+		return err
+	}
+	if ig != nil {
+		log.Default.Infof("Deleting internet gateway: %s", *ig.Id)
+		if _, err := o.networkClient.DeleteInternetGateway(ctx, core.DeleteInternetGatewayRequest{IgId: ig.Id}); err != nil && !IsNotFound(err) {
+			return errors.Wrap(err, "delete internet gateway")
+		}
+		if err := waitForDeletion(ctx, func() (bool, error) {
+			res, err := o.networkClient.GetInternetGateway(ctx, core.GetInternetGatewayRequest{IgId: ig.Id})
+			return res.LifecycleState == core.InternetGatewayLifecycleStateTerminated, err
+		}); err != nil {
+			return errors.Wrap(err, "wait for internet gateway deletion")
+		}
+	}
+
+	if err := o.deleteNFSSecurityGroup(ctx, compartmentID, vcn.Id); err != nil {
+		return errors.Wrap(err, "delete nfs security group")
+	}
+
+	log.Default.Infof("Deleting VCN: %s", *vcn.Id)
+	if _, err := o.networkClient.DeleteVcn(ctx, core.DeleteVcnRequest{VcnId: vcn.Id}); err != nil && !IsNotFound(err) {
+		return errors.Wrap(err, "delete vcn")
+	}
+
+	log.Default.Info("Network successfully deleted")
+
+	return nil
+}
+
+// subnetInUse explains why a subnet that still has VNICs devpod did not tag
+// cannot be deleted. The mount target of the shared file system is one of
+// them, but it is meant to outlive the workspaces, so cleanup is skipped
+// rather than failed.
+func (o *Oracle) subnetInUse(ctx context.Context, compartmentID string, subnet *core.Subnet, otherVnics int) error {
+	mountTarget, err := o.sharedMountTargetInSubnet(ctx, compartmentID, subnet)
+	if err != nil {
+		return errors.Wrap(err, "find shared mount target")
+	}
+	if mountTarget != nil {
+		log.Default.Infof("Network still in use by shared file system mount target %s - skipping cleanup", *mountTarget.Id)
+		return nil
+	}
+
+	return ErrNetworkInUse(*subnet.Id, otherVnics)
+}
+
+// countSubnetVnics returns the number of devpod-tagged and other VNICs that
+// still hold a private IP in the subnet
+func (o *Oracle) countSubnetVnics(ctx context.Context, subnetID *string) (devpod, other int, err error) {
+	privateIps, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.PrivateIp, *string, error) {
+		response, err := o.networkClient.ListPrivateIps(ctx, core.ListPrivateIpsRequest{
+			SubnetId: subnetID,
+			Page:     page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	seen := map[string]bool{}
+	for _, ip := range privateIps {
+		if ip.VnicId == nil || seen[*ip.VnicId] {
+			continue
+		}
+		seen[*ip.VnicId] = true
+
+		vnic, err := o.networkClient.GetVnic(ctx, core.GetVnicRequest{VnicId: ip.VnicId})
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return 0, 0, err
+		}
+
+		switch {
+		case vnic.LifecycleState == core.VnicLifecycleStateTerminated:
+			continue
+		case vnic.FreeformTags[labelType] == labelTypeDevPod:
+			devpod++
+		default:
+			other++
+		}
+	}
+
+	return devpod, other, nil
+}
+
+func (o *Oracle) findVcn(ctx context.Context, compartmentID string) (*core.Vcn, error) {
+	vcns, err := o.listVcns(ctx, compartmentID)
+	if err != nil {
+		return nil, err
+	}
+	return oldest(vcns, vcnKey), nil
+}
+
+func (o *Oracle) findInternetGateway(ctx context.Context, compartmentID string, vcnID *string) (*core.InternetGateway, error) {
+	igs, err := o.listInternetGateways(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+	return oldest(igs, internetGatewayKey), nil
+}
+
+func (o *Oracle) findRouteTable(ctx context.Context, compartmentID string, vcnID *string) (*core.RouteTable, error) {
+	rts, err := o.listRouteTables(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+	return oldest(rts, routeTableKey), nil
+}
+
+func (o *Oracle) findSubnet(ctx context.Context, compartmentID string, vcnID *string) (*core.Subnet, error) {
+	subnets, err := o.listSubnets(ctx, compartmentID, vcnID)
+	if err != nil {
+		return nil, err
+	}
+	return oldest(subnets, subnetKey), nil
+}
+
+// listVcns returns every live devpod VCN in the compartment
+func (o *Oracle) listVcns(ctx context.Context, compartmentID string) ([]core.Vcn, error) {
+	vcns, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Vcn, *string, error) {
+		response, err := o.networkClient.ListVcns(ctx, core.ListVcnsRequest{
+			CompartmentId: &compartmentID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []core.Vcn
+	for _, v := range vcns {
+		if *v.DisplayName == networkVCNName && !isTerminal(string(v.LifecycleState)) {
+			matches = append(matches, v)
+		}
+	}
+
+	return matches, nil
+}
+
+// listInternetGateways returns every live devpod internet gateway in the VCN
+func (o *Oracle) listInternetGateways(ctx context.Context, compartmentID string, vcnID *string) ([]core.InternetGateway, error) {
+	igs, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.InternetGateway, *string, error) {
+		response, err := o.networkClient.ListInternetGateways(ctx, core.ListInternetGatewaysRequest{
+			CompartmentId: &compartmentID,
+			VcnId:         vcnID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []core.InternetGateway
+	for _, i := range igs {
+		if *i.DisplayName == networkInternetGatewayName && !isTerminal(string(i.LifecycleState)) {
+			matches = append(matches, i)
+		}
+	}
+
+	return matches, nil
+}
+
+// listRouteTables returns every live devpod route table in the VCN
+func (o *Oracle) listRouteTables(ctx context.Context, compartmentID string, vcnID *string) ([]core.RouteTable, error) {
+	rts, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.RouteTable, *string, error) {
+		response, err := o.networkClient.ListRouteTables(ctx, core.ListRouteTablesRequest{
+			CompartmentId: &compartmentID,
+			VcnId:         vcnID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []core.RouteTable
+	for _, r := range rts {
+		if *r.DisplayName == networkRouteTableName && !isTerminal(string(r.LifecycleState)) {
+			matches = append(matches, r)
+		}
+	}
+
+	return matches, nil
+}
+
+// listSubnets returns every live devpod subnet in the VCN
+func (o *Oracle) listSubnets(ctx context.Context, compartmentID string, vcnID *string) ([]core.Subnet, error) {
+	subnets, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Subnet, *string, error) {
+		response, err := o.networkClient.ListSubnets(ctx, core.ListSubnetsRequest{
+			CompartmentId: &compartmentID,
+			VcnId:         vcnID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []core.Subnet
+	for _, s := range subnets {
+		if *s.DisplayName == networkSubnetName && !isTerminal(string(s.LifecycleState)) {
+			matches = append(matches, s)
+		}
+	}
+
+	return matches, nil
+}
+
+// isTerminal reports whether a network resource lifecycle state means the
+// resource is going away and must not be reused
+func isTerminal(state string) bool {
+	return state == "TERMINATING" || state == "TERMINATED"
+}
+
+// waitForDeletion polls until the resource reports itself terminated or is no
+// longer found
+func waitForDeletion(ctx context.Context, terminated func() (bool, error)) error {
+	for attempt := 1; attempt <= maxDeletePollAttempts; attempt++ {
+		done, err := terminated()
+		if err != nil {
+			if IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		log.Default.Debugf("Waiting for deletion, attempt %d of %d", attempt, maxDeletePollAttempts)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(deletePollInterval):
+		}
+	}
+
+	return fmt.Errorf("exceeded attempts waiting for deletion: %d", maxDeletePollAttempts)
+}
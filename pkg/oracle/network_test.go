@@ -0,0 +1,111 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOrGetNetworkConverges(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	competitorID := common.String("ocid1.vcn.fake.competitor")
+
+	network := &fakeNetwork{}
+	network.beforeCreate = func(kind string) {
+		// Another process creates its VCN between our list and our create
+		if kind == "vcn" && len(network.vcns) == 0 {
+			network.vcns = append(network.vcns, core.Vcn{
+				Id:             competitorID,
+				DisplayName:    common.String(networkVCNName),
+				LifecycleState: core.VcnLifecycleStateAvailable,
+				TimeCreated:    &common.SDKTime{Time: time.Unix(0, 0)},
+			})
+		}
+	}
+	o := &Oracle{networkClient: network}
+
+	vcn, subnet, err := o.createOrGetNetwork(context.Background(), "compartment-id", "AD-1")
+
+	assert.NoError(err)
+	assert.Equal(*competitorID, *vcn.Id)
+	assert.Equal(*competitorID, *subnet.VcnId)
+	assert.Equal(1, network.calls["DeleteVcn"])
+	assert.Equal(core.VcnLifecycleStateTerminated, network.vcns[1].LifecycleState)
+
+	// A second create finds the converged network and creates nothing
+	network.calls = nil
+
+	vcn, _, err = o.createOrGetNetwork(context.Background(), "compartment-id", "AD-1")
+
+	assert.NoError(err)
+	assert.Equal(*competitorID, *vcn.Id)
+	for _, call := range []string{"CreateVcn", "CreateInternetGateway", "CreateRouteTable", "CreateSubnet"} {
+		assert.Zero(network.calls[call], call)
+	}
+}
+
+func TestOldest(t *testing.T) {
+	at := func(seconds int64) *common.SDKTime {
+		return &common.SDKTime{Time: time.Unix(seconds, 0)}
+	}
+
+	tests := []struct {
+		name     string
+		vcns     []core.Vcn
+		expected string
+	}{
+		{
+			name:     "none",
+			expected: "",
+		},
+		{
+			name: "earliest wins",
+			vcns: []core.Vcn{
+				{Id: common.String("a"), TimeCreated: at(2)},
+				{Id: common.String("b"), TimeCreated: at(1)},
+			},
+			expected: "b",
+		},
+		{
+			name: "tie broken on id",
+			vcns: []core.Vcn{
+				{Id: common.String("b"), TimeCreated: at(1)},
+				{Id: common.String("a"), TimeCreated: at(1)},
+			},
+			expected: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winner := oldest(tt.vcns, vcnKey)
+			if tt.expected == "" {
+				assert.Nil(t, winner)
+				return
+			}
+			assert.Equal(t, tt.expected, *winner.Id)
+		})
+	}
+}
@@ -19,10 +19,11 @@ package oracle
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"embed"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -30,14 +31,16 @@ import (
 	cryptoSsh "golang.org/x/crypto/ssh"
 
 	"github.com/google/uuid"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
 	"github.com/loft-sh/devpod/pkg/client"
-	"github.com/loft-sh/devpod/pkg/ssh"
 	"github.com/loft-sh/log"
 	"github.com/oracle/oci-go-sdk/v65/common"
 	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/filestorage"
 	"github.com/oracle/oci-go-sdk/v65/identity"
+	"github.com/oracle/oci-go-sdk/v65/keymanagement"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v3"
 )
 
 //go:embed cloud-config.yaml
@@ -48,9 +51,20 @@ type cloudInit struct {
 }
 
 type Oracle struct {
-	computeClient    *core.ComputeClient
-	networkClient    *core.VirtualNetworkClient
-	identityClient   *identity.IdentityClient
+	computeClient      computeAPI
+	networkClient      networkAPI
+	identityClient     identityAPI
+	blockstorageClient blockstorageAPI
+	fileStorageClient  fileStorageAPI
+	kmsVaultClient     kmsVaultAPI
+
+	// kmsManagementClient returns a client for the management endpoint of a
+	// vault, which differs per vault
+	kmsManagementClient func(endpoint string) (kmsManagementAPI, error)
+
+	// objectStorageClient returns a client for Object Storage in a region,
+	// or in the region of the OCI config if it is empty
+	objectStorageClient func(region string) (objectStorageAPI, error)
 }
 
 func NewOracle(configProvider common.ConfigurationProvider) (*Oracle, error) {
@@ -69,10 +83,42 @@ func NewOracle(configProvider common.ConfigurationProvider) (*Oracle, error) {
 		return nil, err
 	}
 
+	blockstorageClient, err := core.NewBlockstorageClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	fileStorageClient, err := filestorage.NewFileStorageClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	kmsVaultClient, err := keymanagement.NewKmsVaultClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Oracle{
-		computeClient:    &computeClient,
-		networkClient:    &networkClient,
-		identityClient:   &identityClient,
+		computeClient:      &computeClient,
+		networkClient:      &networkClient,
+		identityClient:     &identityClient,
+		blockstorageClient: &blockstorageClient,
+		fileStorageClient:  &fileStorageClient,
+		kmsVaultClient:     &kmsVaultClient,
+		kmsManagementClient: func(endpoint string) (kmsManagementAPI, error) {
+			client, err := keymanagement.NewKmsManagementClientWithConfigurationProvider(configProvider, endpoint)
+			return &client, err
+		},
+		objectStorageClient: func(region string) (objectStorageAPI, error) {
+			client, err := objectstorage.NewObjectStorageClientWithConfigurationProvider(configProvider)
+			if err != nil {
+				return nil, err
+			}
+			if region != "" {
+				client.SetRegion(region)
+			}
+			return &client, nil
+		},
 	}, nil
 }
 
@@ -88,65 +134,76 @@ func (o *Oracle) upsertPublicKey(ctx context.Context, publicKey, machineID strin
 	}
 	name := fmt.Sprintf("%s-%s", machineID, uuid.NewString()[:8])
 
-	log.Default.Infof("Creating instance with SSH key: %s", name)
-
-	// Create cloud-init data
-	cloudInitData, err := o.generateCloudConfig(publicKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate cloud config")
-	}
-
-	// Encode cloud-init data
-	encodedCloudInitData := base64.StdEncoding.EncodeToString([]byte(cloudInitData))
+	log.Default.Infof("Creating instance with SSH key: %s (%s)", name, fingerprint)
 
 	// Create instance source details
 	sourceDetails := &core.InstanceSourceViaImageDetails{
-		ImageId: nil, // Will be set later
-		LaunchOptions: &core.LaunchOptions{
-			BootVolumeType:                 core.InstanceSourceBootVolumeTypeParavirtualized,
-			NetworkType:                    core.InstanceLaunchOptionsNetworkTypeParavirtualized,
-			IsConsistentVolumeNamingEnabled: common.Bool(true),
-		},
+		ImageId:  nil, // Will be set later
 		KmsKeyId: nil,
 	}
 
 	return sourceDetails, nil
 }
 
-func (o *Oracle) BuildInstanceOptions(
-	ctx context.Context,
-	machineID string,
-	diskImage string,
-	diskSizeGB string,
-	machineType string,
-	region string,
-	availabilityDomain string,
-	compartmentID string,
-	publicKey string,
-) (*core.LaunchInstanceRequest, error) {
+func (o *Oracle) BuildInstanceOptions(ctx context.Context, opts *options.Options, publicKey string) (*core.LaunchInstanceRequest, error) {
 	// Get source details
-	sourceDetails, err := o.upsertPublicKey(ctx, publicKey, machineID)
+	sourceDetails, err := o.upsertPublicKey(ctx, publicKey, opts.MachineID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Find image
-	image, err := o.findImage(ctx, compartmentID, diskImage)
+	return o.buildLaunchRequest(ctx, opts, sourceDetails, func(provisioned bool, sharedSource string) (string, error) {
+		return o.generateCloudConfig(publicKey, opts, provisioned, sharedSource)
+	})
+}
+
+// buildLaunchRequest builds the launch request for the machine. userData
+// renders the cloud-config, which depends on whether the boot volume was
+// already provisioned and on the NFS source of the shared file system.
+func (o *Oracle) buildLaunchRequest(
+	ctx context.Context, opts *options.Options, sourceDetails *core.InstanceSourceViaImageDetails,
+	userData func(provisioned bool, sharedSource string) (string, error),
+) (*core.LaunchInstanceRequest, error) {
+	machineID := opts.MachineID
+	compartmentID := opts.CompartmentID
+	availabilityDomain := opts.AvailabilityDomain
+
+	// Launch from a backup or from the image
+	var err error
+	var source core.InstanceSourceDetails = sourceDetails
+	var image *core.Image
+	if opts.RestoreFromBackup != "" {
+		source, err = o.restoredBootVolumeSource(ctx, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "restore from backup")
+		}
+	} else {
+		image, err = o.imageSource(ctx, opts, sourceDetails)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	platformConfig, err := o.platformConfig(ctx, opts, opts.MachineType, image)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to find image")
+		return nil, err
 	}
-	sourceDetails.ImageId = image.Id
 
 	// Create or get VCN and subnet
-	vcn, subnet, err := o.createOrGetNetwork(ctx, compartmentID, availabilityDomain, machineID)
+	vcn, subnet, err := o.createOrGetNetwork(ctx, compartmentID, availabilityDomain)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create or get network")
 	}
 
-	// Parse disk size
-	diskSize, err := strconv.Atoi(diskSizeGB)
+	sharedSource, err := o.sharedFileSystemSource(ctx, opts, vcn, subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create cloud-init data
+	cloudInitData, err := userData(image == nil || isBakedImage(image), sharedSource)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse disk size")
+		return nil, errors.Wrap(err, "failed to generate cloud config")
 	}
 
 	// Create instance request
@@ -154,209 +211,212 @@ func (o *Oracle) BuildInstanceOptions(
 		LaunchInstanceDetails: core.LaunchInstanceDetails{
 			AvailabilityDomain: &availabilityDomain,
 			CompartmentId:      &compartmentID,
-			Shape:              &machineType,
-			DisplayName:        common.String(fmt.Sprintf("devpod-%s", machineID)),
-			SourceDetails:      sourceDetails,
+			Shape:              &opts.MachineType,
+			DisplayName:        common.String(instanceName(machineID)),
+			SourceDetails:      source,
+			LaunchOptions: &core.LaunchOptions{
+				BootVolumeType:                  core.LaunchOptionsBootVolumeTypeParavirtualized,
+				NetworkType:                     core.LaunchOptionsNetworkTypeParavirtualized,
+				IsConsistentVolumeNamingEnabled: common.Bool(true),
+				IsPvEncryptionInTransitEnabled:  common.Bool(opts.PvEncryptionInTransit),
+			},
+			IsPvEncryptionInTransitEnabled: common.Bool(opts.PvEncryptionInTransit),
 			CreateVnicDetails: &core.CreateVnicDetails{
 				SubnetId:       subnet.Id,
 				AssignPublicIp: common.Bool(true),
+				FreeformTags: map[string]string{
+					labelMachineID: machineID,
+					labelType:      labelTypeDevPod,
+				},
 			},
 			Metadata: map[string]string{
-				"user_data": base64.StdEncoding.EncodeToString([]byte(o.generateCloudConfig(publicKey))),
+				"user_data": base64.StdEncoding.EncodeToString([]byte(cloudInitData)),
 			},
 			FreeformTags: map[string]string{
 				labelMachineID: machineID,
 				labelType:      labelTypeDevPod,
 			},
+			PlatformConfig:            platformConfig,
+			InstanceOptions:           instanceOptions(opts),
+			AgentConfig:               agentConfig(opts),
+			PreemptibleInstanceConfig: preemptibleConfig(opts),
+			CapacityReservationId:     optionalString(opts.CapacityReservationID),
+			DedicatedVmHostId:         optionalString(opts.DedicatedVMHostID),
 		},
 	}
 
 	return request, nil
 }
 
-func (o *Oracle) findImage(ctx context.Context, compartmentID, diskImage string) (*core.Image, error) {
-	request := core.ListImagesRequest{
-		CompartmentId: &compartmentID,
-		DisplayName:   common.String(diskImage),
+// ResumeInstance brings an existing instance for the machine to running so
+// that a retried create does not launch a duplicate. The previous attempt
+// may have failed before the volumes were attached, so they are attached
+// again before the instance is started. It returns false if there is no live
+// instance and one needs to be launched.
+func (o *Oracle) ResumeInstance(ctx context.Context, opts *options.Options) (bool, error) {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		if IsNotFound(err) && parkedState(opts) != nil {
+			return true, o.StartInstance(ctx, opts)
+		}
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
 
-	response, err := o.computeClient.ListImages(ctx, request)
-	if err != nil {
-		return nil, err
+	log.Default.Infof("Found existing instance %s in state %s", *instance.Id, instance.LifecycleState)
+
+	if instance.LifecycleState == core.InstanceLifecycleStateStopping {
+		if err := o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateStopped, opts.WaitTimeout); err != nil {
+			return true, err
+		}
+		instance.LifecycleState = core.InstanceLifecycleStateStopped
 	}
 
-	if len(response.Items) == 0 {
-		return nil, fmt.Errorf("image %s not found", diskImage)
+	if err := o.AttachVolumes(ctx, opts, instance); err != nil {
+		return true, errors.Wrap(err, "attach volumes")
+	}
+
+	switch instance.LifecycleState {
+	case core.InstanceLifecycleStateRunning:
+		return true, nil
+	case core.InstanceLifecycleStateProvisioning, core.InstanceLifecycleStateStarting:
+		return true, o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateRunning, opts.WaitTimeout)
 	}
 
-	return &response.Items[0], nil
+	return true, o.StartInstance(ctx, opts)
 }
 
-func (o *Oracle) createOrGetNetwork(ctx context.Context, compartmentID, availabilityDomain, machineID string) (*core.Vcn, *core.Subnet, error) {
-	// Check if VCN exists
-	listVcnRequest := core.ListVcnsRequest{
-		CompartmentId: &compartmentID,
-	}
-	vcnResponse, err := o.networkClient.ListVcns(ctx, listVcnRequest)
+// LaunchInstance launches a new instance from the request built by
+// BuildInstanceOptions. The request carries a retry token so that OCI
+// deduplicates a launch that is retried after a lost response.
+func (o *Oracle) LaunchInstance(ctx context.Context, opts *options.Options, request *core.LaunchInstanceRequest) (*core.Instance, error) {
+	log.Default.Info("Launching a new instance")
+
+	token, err := launchRetryToken(opts)
 	if err != nil {
-		return nil, nil, err
+		return nil, errors.Wrap(err, "generate retry token")
 	}
+	request.OpcRetryToken = &token
 
-	var vcn *core.Vcn
-	for _, v := range vcnResponse.Items {
-		if *v.DisplayName == "devpod-vcn" {
-			vcn = &v
-			break
-		}
+	response, err := o.computeClient.LaunchInstance(ctx, *request)
+	if err != nil {
+		return nil, o.explainLaunchError(ctx, opts, *request.Shape, err)
 	}
 
-	// Create VCN if it doesn't exist
-	if vcn == nil {
-		createVcnRequest := core.CreateVcnRequest{
-			CreateVcnDetails: core.CreateVcnDetails{
-				CompartmentId: &compartmentID,
-				DisplayName:   common.String("devpod-vcn"),
-				CidrBlock:     common.String("10.0.0.0/16"),
-				DnsLabel:      common.String("devpodvcn"),
-				FreeformTags: map[string]string{
-					labelType: labelTypeDevPod,
-				},
-			},
-		}
-		vcnResponse, err := o.networkClient.CreateVcn(ctx, createVcnRequest)
-		if err != nil {
-			return nil, nil, err
-		}
-		vcn = &vcnResponse.Vcn
-	}
+	o.recordInstance(ctx, opts, &response.Instance)
 
-	// Check if internet gateway exists
-	listIgRequest := core.ListInternetGatewaysRequest{
-		CompartmentId: &compartmentID,
-		VcnId:         vcn.Id,
-	}
-	igResponse, err := o.networkClient.ListInternetGateways(ctx, listIgRequest)
+	return &response.Instance, nil
+}
+
+// Init checks that the credentials work, that the placement options fit the
+// configured availability domain and shape, that the shape has the local
+// drives for Docker data if they are wanted and that the KMS key is usable
+func (o *Oracle) Init(ctx context.Context, opts *options.Options) error {
+	_, err := o.identityClient.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{
+		CompartmentId: &opts.CompartmentID,
+	})
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	var ig *core.InternetGateway
-	for _, i := range igResponse.Items {
-		if *i.DisplayName == "devpod-ig" {
-			ig = &i
-			break
-		}
+	if err := o.validateCapacityReservation(ctx, opts); err != nil {
+		return err
 	}
 
-	// Create internet gateway if it doesn't exist
-	if ig == nil {
-		createIgRequest := core.CreateInternetGatewayRequest{
-			CreateInternetGatewayDetails: core.CreateInternetGatewayDetails{
-				CompartmentId: &compartmentID,
-				DisplayName:   common.String("devpod-ig"),
-				VcnId:         vcn.Id,
-				IsEnabled:     common.Bool(true),
-				FreeformTags: map[string]string{
-					labelType: labelTypeDevPod,
-				},
-			},
-		}
-		igResponse, err := o.networkClient.CreateInternetGateway(ctx, createIgRequest)
-		if err != nil {
-			return nil, nil, err
-		}
-		ig = &igResponse.InternetGateway
+	if err := o.validateDedicatedVMHost(ctx, opts); err != nil {
+		return err
 	}
 
-	// Check if route table exists
-	listRtRequest := core.ListRouteTablesRequest{
-		CompartmentId: &compartmentID,
-		VcnId:         vcn.Id,
+	if err := o.validateDockerData(ctx, opts); err != nil {
+		return err
 	}
-	rtResponse, err := o.networkClient.ListRouteTables(ctx, listRtRequest)
+
+	return o.validateKMSKey(ctx, opts)
+}
+
+// imageSource completes the source details with the image and the size,
+// performance and encryption of the boot volume
+func (o *Oracle) imageSource(
+	ctx context.Context, opts *options.Options, sourceDetails *core.InstanceSourceViaImageDetails,
+) (*core.Image, error) {
+	image, err := o.findImage(ctx, opts.CompartmentID, opts.DiskImage)
 	if err != nil {
-		return nil, nil, err
+		return nil, errors.Wrap(err, "failed to find image")
 	}
+	sourceDetails.ImageId = image.Id
+	sourceDetails.BootVolumeSizeInGBs = common.Int64(int64(opts.DiskSize))
+	sourceDetails.BootVolumeVpusPerGB = common.Int64(int64(opts.BootVolumeVPUsPerGB))
+	sourceDetails.KmsKeyId = optionalString(opts.KMSKeyID)
 
-	var rt *core.RouteTable
-	for _, r := range rtResponse.Items {
-		if *r.DisplayName == "devpod-rt" {
-			rt = &r
-			break
-		}
+	// The boot volume cannot be smaller than the image
+	if image.SizeInMBs != nil && *image.SizeInMBs > int64(opts.DiskSize)*1024 {
+		return nil, ErrDiskTooSmall(opts.DiskSize, *image.DisplayName, *image.SizeInMBs)
 	}
 
-	// Create route table if it doesn't exist
-	if rt == nil {
-		createRtRequest := core.CreateRouteTableRequest{
-			CreateRouteTableDetails: core.CreateRouteTableDetails{
-				CompartmentId: &compartmentID,
-				DisplayName:   common.String("devpod-rt"),
-				VcnId:         vcn.Id,
-				RouteRules: []core.RouteRule{
-					{
-						NetworkEntityId: ig.Id,
-						Destination:     common.String("0.0.0.0/0"),
-						DestinationType: core.RouteRuleDestinationTypeCidrBlock,
-					},
-				},
-				FreeformTags: map[string]string{
-					labelType: labelTypeDevPod,
-				},
-			},
-		}
-		rtResponse, err := o.networkClient.CreateRouteTable(ctx, createRtRequest)
-		if err != nil {
-			return nil, nil, err
-		}
-		rt = &rtResponse.RouteTable
-	}
+	return image, nil
+}
 
-	// Check if subnet exists
-	listSubnetRequest := core.ListSubnetsRequest{
-		CompartmentId: &compartmentID,
-		VcnId:         vcn.Id,
-	}
-	subnetResponse, err := o.networkClient.ListSubnets(ctx, listSubnetRequest)
+func (o *Oracle) findImage(ctx context.Context, compartmentID, diskImage string) (*core.Image, error) {
+	images, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Image, *string, error) {
+		response, err := o.computeClient.ListImages(ctx, core.ListImagesRequest{
+			CompartmentId: &compartmentID,
+			DisplayName:   common.String(diskImage),
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	var subnet *core.Subnet
-	for _, s := range subnetResponse.Items {
-		if *s.DisplayName == "devpod-subnet" {
-			subnet = &s
-			break
-		}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image %s not found", diskImage)
 	}
 
-	// Create subnet if it doesn't exist
-	if subnet == nil {
-		createSubnetRequest := core.CreateSubnetRequest{
-			CreateSubnetDetails: core.CreateSubnetDetails{
-				CompartmentId:      &compartmentID,
-				DisplayName:        common.String("devpod-subnet"),
-				VcnId:              vcn.Id,
-				CidrBlock:          common.String("10.0.0.0/24"),
-				RouteTableId:       rt.Id,
-				DnsLabel:           common.String("devpodsubnet"),
-				AvailabilityDomain: &availabilityDomain,
-				FreeformTags: map[string]string{
-					labelType: labelTypeDevPod,
-				},
-			},
-		}
-		subnetResponse, err := o.networkClient.CreateSubnet(ctx, createSubnetRequest)
-		if err != nil {
-			return nil, nil, err
-		}
-		subnet = &subnetResponse.Subnet
+	return &images[0], nil
+}
+
+// cloudConfigData fills in the cloud-config template
+type cloudConfigData struct {
+	PublicKey    string
+	AgentB64     string
+	HomeDevice   string
+	DockerDevice string
+	Provisioned  bool
+
+	// SharedSource is the NFS source of the shared file system, mounted at
+	// SharedPath
+	SharedSource string
+	SharedPath   string
+
+	// Pool is set for an instance launched into the warm pool. It has no SSH
+	// key until a workspace claims it and leaves one in the ClaimKey metadata.
+	Pool     bool
+	ClaimKey string
+}
+
+// generateCloudConfig renders the cloud-config for a new instance. The package
+// upgrade is skipped when the boot volume was already provisioned, as it is
+// for images baked from a workspace and for restored backups.
+func (o *Oracle) generateCloudConfig(publicKey string, opts *options.Options, provisioned bool, sharedSource string) (string, error) {
+	data := cloudConfigData{
+		PublicKey:    publicKey,
+		AgentB64:     "", // Will be filled by DevPod
+		DockerDevice: dockerDataDevice(opts),
+		Provisioned:  provisioned,
+		SharedSource: sharedSource,
+		SharedPath:   opts.FSSMountPath,
+	}
+	if opts.HomeVolumeSize > 0 {
+		data.HomeDevice = homeVolumeDevice
 	}
 
-	return vcn, subnet, nil
+	return renderCloudConfig(data)
 }
 
-func (o *Oracle) generateCloudConfig(publicKey string) (string, error) {
+func renderCloudConfig(data cloudConfigData) (string, error) {
 	// Read cloud-config template
 	cloudConfigBytes, err := cloudConfig.ReadFile("cloud-config.yaml")
 	if err != nil {
@@ -369,15 +429,6 @@ func (o *Oracle) generateCloudConfig(publicKey string) (string, error) {
 		return "", err
 	}
 
-	// Create template data
-	data := struct {
-		PublicKey string
-		AgentB64  string
-	}{
-		PublicKey: publicKey,
-		AgentB64:  "", // Will be filled by DevPod
-	}
-
 	// Execute template
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, data)
@@ -388,38 +439,245 @@ func (o *Oracle) generateCloudConfig(publicKey string) (string, error) {
 	return buf.String(), nil
 }
 
-func (o *Oracle) GetInstance(ctx context.Context, machineID string) (*core.Instance, error) {
-	if machineID == "" {
+// GetInstance finds the live instance for the machine in the configured
+// compartment. The instance recorded in the machine state is tried first so
+// that most calls skip the search.
+func (o *Oracle) GetInstance(ctx context.Context, opts *options.Options) (*core.Instance, error) {
+	if opts.MachineID == "" {
 		return nil, MissingMachineID()
 	}
 
-	// List instances with the machine ID tag
-	request := core.ListInstancesRequest{
-		DisplayName: common.String(fmt.Sprintf("devpod-%s", machineID)),
+	if state := loadState(opts.MachineFolder); state != nil && state.InstanceID != "" {
+		instance, err := o.getCachedInstance(ctx, state.InstanceID, opts.MachineID)
+		if err != nil {
+			return nil, err
+		}
+		if instance != nil && isLiveInstance(instance.LifecycleState) {
+			// The launch is recorded while provisioning, before the VNIC and
+			// boot volume exist, so fill them in once the instance is up
+			if state.BootVolumeID == "" || state.SubnetID == "" {
+				o.recordInstance(ctx, opts, instance)
+			}
+			return instance, nil
+		}
+		if instance != nil && o.parkPreempted(opts, state, instance) {
+			return nil, MissingServer()
+		}
+
+		log.Default.Debugf("Cached instance %s is stale - searching", state.InstanceID)
+		forgetInstance(opts.MachineFolder, state)
 	}
 
-	response, err := o.computeClient.ListInstances(ctx, request)
+	name := instanceName(opts.MachineID)
+
+	// List instances with the machine ID tag
+	instances, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Instance, *string, error) {
+		response, err := o.computeClient.ListInstances(ctx, core.ListInstancesRequest{
+			CompartmentId: &opts.CompartmentID,
+			DisplayName:   common.String(name),
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Find the instance with the matching machine ID
-	for _, instance := range response.Items {
-		if instance.FreeformTags[labelMachineID] == machineID {
-			return &instance, nil
+	// Find the live instances with the matching machine ID
+	var matches []core.Instance
+	for _, instance := range instances {
+		if instance.FreeformTags[labelMachineID] == opts.MachineID && isLiveInstance(instance.LifecycleState) {
+			matches = append(matches, instance)
 		}
 	}
 
-	return nil, MissingServer()
+	switch len(matches) {
+	case 0:
+		return nil, MissingServer()
+	case 1:
+		o.recordInstance(ctx, opts, &matches[0])
+		return &matches[0], nil
+	default:
+		return nil, ErrMultipleInstancesFound(name)
+	}
 }
 
-func (o *Oracle) DeleteInstance(ctx context.Context, machineID string) error {
-	instance, err := o.GetInstance(ctx, machineID)
+// getCachedInstance returns the cached instance if it still exists and
+// belongs to the machine, otherwise nil
+func (o *Oracle) getCachedInstance(ctx context.Context, instanceID, machineID string) (*core.Instance, error) {
+	response, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+		InstanceId: &instanceID,
+	})
 	if err != nil {
 		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	instance := response.Instance
+	if instance.FreeformTags[labelMachineID] != machineID {
+		return nil, nil
+	}
+
+	return &instance, nil
+}
+
+// waitForInstanceState polls the instance until it reaches the target state,
+// logging each state it passes through. A zero timeout waits indefinitely.
+func (o *Oracle) waitForInstanceState(
+	ctx context.Context,
+	instanceID *string,
+	target core.InstanceLifecycleStateEnum,
+	timeout time.Duration,
+) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log.Default.Infof("Waiting for instance to be %s", target)
+
+	started := time.Now()
+	var last core.InstanceLifecycleStateEnum
+
+	for {
+		response, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+			InstanceId: instanceID,
+		})
+		if err != nil {
+			// Terminated instances eventually disappear from the API
+			if target == core.InstanceLifecycleStateTerminated && IsNotFound(err) {
+				return nil
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrWaitTimeout(string(target), timeout)
+			}
+			return err
+		}
+
+		state := response.LifecycleState
+		if state == target {
+			log.Default.Infof("Instance is %s after %s", target, time.Since(started).Round(time.Second))
 			return nil
 		}
-		return err
+		if target != core.InstanceLifecycleStateTerminated && !isLiveInstance(state) {
+			return fmt.Errorf("instance %s is %s", *instanceID, state)
+		}
+
+		if state != last {
+			log.Default.Infof("Instance is %s", state)
+			last = state
+		} else {
+			log.Default.Debugf("Instance is still %s after %s", state, time.Since(started).Round(time.Second))
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrWaitTimeout(string(target), timeout)
+			}
+			return ctx.Err()
+		case <-time.After(instancePollInterval):
+		}
+	}
+}
+
+// waitForAvailable polls a volume or backup until it is AVAILABLE, failing if
+// it reaches any state other than one it passes through on the way
+func (o *Oracle) waitForAvailable(
+	ctx context.Context, opts *options.Options, kind string, state func(ctx context.Context) (string, error),
+) error {
+	return waitForLifecycleState(ctx, opts, kind, "AVAILABLE", state)
+}
+
+// waitForLifecycleState polls a resource until it reaches the wanted state,
+// which is AVAILABLE for storage and ACTIVE for most other resources
+func waitForLifecycleState(
+	ctx context.Context, opts *options.Options, kind, wanted string, state func(ctx context.Context) (string, error),
+) error {
+	if opts.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.WaitTimeout)
+		defer cancel()
+	}
+
+	for {
+		current, err := state(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch current {
+		case wanted:
+			return nil
+		case "CREATING", "REQUEST_RECEIVED", "PROVISIONING", "RESTORING":
+			log.Default.Debugf("The %s is %s", kind, current)
+		default:
+			return fmt.Errorf("the %s is %s", kind, current)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrWaitTimeout(wanted, opts.WaitTimeout)
+		case <-time.After(backupPollInterval):
+		}
+	}
+}
+
+// launchRetryToken derives the launch retry token from the machine ID and a
+// nonce kept in the machine state. OCI honours retry tokens for 24 hours, so
+// the nonce stops a machine that is deleted and re-created with the same ID
+// from being handed the old, terminated instance.
+func launchRetryToken(opts *options.Options) (string, error) {
+	state := loadState(opts.MachineFolder)
+	if state == nil {
+		state = &machineState{}
+	}
+
+	if state.LaunchNonce == "" {
+		state.LaunchNonce = uuid.NewString()
+		if err := saveState(opts.MachineFolder, state); err != nil {
+			return "", err
+		}
+	}
+
+	return retryToken("launch", opts.MachineID, state.LaunchNonce), nil
+}
+
+// retryToken builds an OCI retry token from its parts. Tokens are limited to
+// 64 characters, which a hex SHA-256 digest fits exactly.
+func retryToken(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(sum[:])
+}
+
+func isLiveInstance(state core.InstanceLifecycleStateEnum) bool {
+	return state != core.InstanceLifecycleStateTerminating && state != core.InstanceLifecycleStateTerminated
+}
+
+func instanceName(machineID string) string {
+	return fmt.Sprintf("devpod-%s", machineID)
+}
+
+// DeleteInstance terminates the instance. If wait is set, it blocks until the
+// instance is terminated and its VNIC released, and then deletes the home
+// volume.
+func (o *Oracle) DeleteInstance(ctx context.Context, opts *options.Options, wait bool) error {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		if !IsNotFound(err) {
+			return err
+		}
+
+		// A parked machine only has its boot volume left
+		if err := o.deleteParkedBootVolume(ctx, opts); err != nil {
+			return err
+		}
+		removeState(opts.MachineFolder)
+
+		return o.deleteVolumes(ctx, opts)
 	}
 
 	// Terminate instance
@@ -433,117 +691,262 @@ func (o *Oracle) DeleteInstance(ctx context.Context, machineID string) error {
 		return err
 	}
 
-	return nil
-}
-
-func (o *Oracle) StartInstance(ctx context.Context, machineID string) error {
-	instance, err := o.GetInstance(ctx, machineID)
-	if err != nil {
-		return err
-	}
+	removeState(opts.MachineFolder)
 
-	// Check if instance is already running
-	if instance.LifecycleState == core.InstanceLifecycleStateRunning {
-		return nil
+	// Nothing else would remove the volumes, so they are waited for even
+	// when the caller is not
+	if !wait {
+		hasVolumes, err := o.hasVolumes(ctx, opts)
+		if err != nil || !hasVolumes {
+			return err
+		}
 	}
 
-	// Start instance
-	request := core.InstanceActionRequest{
-		InstanceId: instance.Id,
-		Action:     core.InstanceActionActionStart,
+	err = o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateTerminated, opts.WaitTimeout)
+	if err != nil {
+		return err
 	}
 
-	_, err = o.computeClient.InstanceAction(ctx, request)
-	return err
+	// The volumes are only detached once the instance is gone
+	return o.deleteVolumes(ctx, opts)
 }
 
-func (o *Oracle) StopInstance(ctx context.Context, machineID string) error {
-	instance, err := o.GetInstance(ctx, machineID)
+func (o *Oracle) StartInstance(ctx context.Context, opts *options.Options) error {
+	instance, err := o.GetInstance(ctx, opts)
 	if err != nil {
+		if parked := parkedState(opts); IsNotFound(err) && parked != nil {
+			return o.unparkInstance(ctx, opts, parked)
+		}
 		return err
 	}
 
-	// Check if instance is already stopped
-	if instance.LifecycleState == core.InstanceLifecycleStateStopped {
+	switch instance.LifecycleState {
+	case core.InstanceLifecycleStateRunning:
 		return nil
+	case core.InstanceLifecycleStateProvisioning, core.InstanceLifecycleStateStarting:
+		// Already on its way up
+	default:
+		request := core.InstanceActionRequest{
+			InstanceId: instance.Id,
+			Action:     core.InstanceActionActionStart,
+		}
+
+		if _, err := o.computeClient.InstanceAction(ctx, request); err != nil {
+			return err
+		}
 	}
 
-	// Stop instance
-	request := core.InstanceActionRequest{
-		InstanceId: instance.Id,
-		Action:     core.InstanceActionActionStop,
+	if opts.NoWait {
+		return nil
 	}
 
-	_, err = o.computeClient.InstanceAction(ctx, request)
-	return err
+	return o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateRunning, opts.WaitTimeout)
 }
 
-func (o *Oracle) GetInstanceStatus(ctx context.Context, machineID string) (string, error) {
-	instance, err := o.GetInstance(ctx, machineID)
+// GetInstanceStatus maps the instance lifecycle state to a DevPod status. A
+// parked machine has no instance but reports stopped while its boot volume
+// exists.
+func (o *Oracle) GetInstanceStatus(ctx context.Context, opts *options.Options) (client.Status, error) {
+	instance, err := o.GetInstance(ctx, opts)
 	if err != nil {
-		if IsNotFound(err) {
-			return "not_found", nil
+		if !IsNotFound(err) {
+			return client.StatusNotFound, err
 		}
-		return "", err
+
+		parked, err := o.isParked(ctx, opts)
+		if err != nil {
+			return client.StatusNotFound, err
+		} else if parked {
+			return client.StatusStopped, nil
+		}
+
+		return client.StatusNotFound, nil
 	}
 
 	switch instance.LifecycleState {
 	case core.InstanceLifecycleStateRunning:
-		return "running", nil
+		return client.StatusRunning, nil
 	case core.InstanceLifecycleStateStopped:
-		return "stopped", nil
-	case core.InstanceLifecycleStateTerminated:
-		return "terminated", nil
-	case core.InstanceLifecycleStateProvisioning, core.InstanceLifecycleStateStarting:
-		return "starting", nil
-	case core.InstanceLifecycleStateStopping:
-		return "stopping", nil
+		return client.StatusStopped, nil
 	default:
-		return string(instance.LifecycleState), nil
+		return client.StatusBusy, nil
 	}
 }
 
-func (o *Oracle) GetInstanceIP(ctx context.Context, machineID string) (string, error) {
-	instance, err := o.GetInstance(ctx, machineID)
+// GetInstanceIP returns the public IP of the instance, or the private IP if it
+// has none. The VNIC recorded in the machine state is tried first.
+func (o *Oracle) GetInstanceIP(ctx context.Context, opts *options.Options) (string, error) {
+	state := loadState(opts.MachineFolder)
+	if state != nil && state.VnicID != "" {
+		vnic, err := o.getCachedVnic(ctx, state.VnicID, opts.MachineID)
+		if err != nil {
+			return "", err
+		}
+		if vnic != nil {
+			ip := vnicIP(vnic)
+			if ip != state.IP {
+				state.IP = ip
+				if err := saveState(opts.MachineFolder, state); err != nil {
+					log.Default.Warnf("Unable to save machine state: %v", err)
+				}
+			}
+			return ip, nil
+		}
+
+		log.Default.Debugf("Cached VNIC %s is stale - searching", state.VnicID)
+	}
+
+	instance, err := o.GetInstance(ctx, opts)
 	if err != nil {
 		return "", err
 	}
 
-	// Get VNIC attachments
-	vnicRequest := core.ListVnicAttachmentsRequest{
-		InstanceId: instance.Id,
+	vnic, err := o.getPrimaryVnic(ctx, instance)
+	if err != nil {
+		return "", err
+	}
+
+	if state := loadState(opts.MachineFolder); state != nil && state.InstanceID == *instance.Id {
+		state.VnicID = *vnic.Id
+		state.IP = vnicIP(vnic)
+		if err := saveState(opts.MachineFolder, state); err != nil {
+			log.Default.Warnf("Unable to save machine state: %v", err)
+		}
 	}
 
-	vnicResponse, err := o.computeClient.ListVnicAttachments(ctx, vnicRequest)
+	return vnicIP(vnic), nil
+}
+
+// getPrimaryVnic returns the VNIC of the instance's first attachment
+func (o *Oracle) getPrimaryVnic(ctx context.Context, instance *core.Instance) (*core.Vnic, error) {
+	attachments, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.VnicAttachment, *string, error) {
+		response, err := o.computeClient.ListVnicAttachments(ctx, core.ListVnicAttachmentsRequest{
+			CompartmentId: instance.CompartmentId,
+			InstanceId:    instance.Id,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		if attachment.VnicId == nil || attachment.LifecycleState != core.VnicAttachmentLifecycleStateAttached {
+			continue
+		}
+
+		response, err := o.networkClient.GetVnic(ctx, core.GetVnicRequest{
+			VnicId: attachment.VnicId,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &response.Vnic, nil
 	}
 
-	if len(vnicResponse.Items) == 0 {
-		return "", fmt.Errorf("no VNIC attachments found for instance %s", *instance.Id)
+	return nil, fmt.Errorf("no VNIC attachments found for instance %s", *instance.Id)
+}
+
+// getCachedVnic returns the cached VNIC if it still belongs to the machine,
+// otherwise nil
+func (o *Oracle) getCachedVnic(ctx context.Context, vnicID, machineID string) (*core.Vnic, error) {
+	response, err := o.networkClient.GetVnic(ctx, core.GetVnicRequest{
+		VnicId: &vnicID,
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	// Get VNIC
-	vnicID := vnicResponse.Items[0].VnicId
-	vnicGetRequest := core.GetVnicRequest{
-		VnicId: vnicID,
+	vnic := response.Vnic
+	if vnic.FreeformTags[labelMachineID] != machineID || vnic.LifecycleState != core.VnicLifecycleStateAvailable {
+		return nil, nil
 	}
 
-	vnicGetResponse, err := o.networkClient.GetVnic(ctx, vnicGetRequest)
+	return &vnic, nil
+}
+
+// recordInstance saves the instance and whatever is known about its VNIC and
+// boot volume to the machine state. Attachments may not exist yet while the
+// instance is provisioning, so lookup failures are not fatal.
+func (o *Oracle) recordInstance(ctx context.Context, opts *options.Options, instance *core.Instance) {
+	state := loadState(opts.MachineFolder)
+	if state == nil || state.InstanceID != *instance.Id {
+		launched := &machineState{InstanceID: *instance.Id}
+		if state != nil && state.InstanceID == "" {
+			// Keep the nonce of a launch that has just completed, and the
+			// restore into the home of a parked instance
+			launched.LaunchNonce = state.LaunchNonce
+			launched.RestoredObject = state.RestoredObject
+		}
+		state = launched
+	}
+	state.Region = opts.Region
+	state.CompartmentID = opts.CompartmentID
+	state.ProviderVersion = ProviderVersion
+
+	if instance.LifecycleState == core.InstanceLifecycleStateRunning || instance.LifecycleState == core.InstanceLifecycleStateStopped {
+		if vnic, err := o.getPrimaryVnic(ctx, instance); err != nil {
+			log.Default.Debugf("Unable to resolve VNIC: %v", err)
+		} else {
+			state.VnicID = *vnic.Id
+			state.IP = vnicIP(vnic)
+			if vnic.SubnetId != nil {
+				state.SubnetID = *vnic.SubnetId
+			}
+		}
+
+		if bootVolumeID, err := o.getBootVolumeID(ctx, instance); err != nil {
+			log.Default.Debugf("Unable to resolve boot volume: %v", err)
+		} else {
+			state.BootVolumeID = bootVolumeID
+		}
+	}
+
+	if err := saveState(opts.MachineFolder, state); err != nil {
+		log.Default.Warnf("Unable to save machine state: %v", err)
+	}
+}
+
+func (o *Oracle) getBootVolumeID(ctx context.Context, instance *core.Instance) (string, error) {
+	attachments, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.BootVolumeAttachment, *string, error) {
+		response, err := o.computeClient.ListBootVolumeAttachments(ctx, core.ListBootVolumeAttachmentsRequest{
+			AvailabilityDomain: instance.AvailabilityDomain,
+			CompartmentId:      instance.CompartmentId,
+			InstanceId:         instance.Id,
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	// Return public IP if available, otherwise private IP
-	if vnicGetResponse.Vnic.PublicIp != nil {
-		return *vnicGetResponse.Vnic.PublicIp, nil
+	for _, attachment := range attachments {
+		if attachment.LifecycleState == core.BootVolumeAttachmentLifecycleStateAttached {
+			return *attachment.BootVolumeId, nil
+		}
 	}
 
-	return *vnicGetResponse.Vnic.PrivateIp, nil
+	return "", MissingVolume()
+}
+
+// vnicIP returns the public IP if available, otherwise the private IP
+func vnicIP(vnic *core.Vnic) string {
+	if vnic.PublicIp != nil {
+		return *vnic.PublicIp
+	}
+
+	return *vnic.PrivateIp
 }
 
 func generateSSHKeyFingerprint(publicKey string) (string, error) {
-	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	//nolint:dogsled // correct assignment
+	pubKey, _, _, _, err := cryptoSsh.ParseAuthorizedKey([]byte(publicKey))
 	if err != nil {
 		return "", err
 	}
@@ -562,4 +965,4 @@ func CreateOCIConfigurationProvider(configFilePath, profile string) (common.Conf
 
 	configProvider := common.CustomProfileConfigProvider(configFilePath, profile)
 	return configProvider, nil
-} 
\ No newline at end of file
+}
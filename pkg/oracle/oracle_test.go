@@ -17,9 +17,17 @@
 package oracle
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,18 +42,18 @@ func TestFingerPrintGenerate(t *testing.T) {
 			Name: "rsa-1",
 			//nolint
 			PublicKey:   "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDVEnA5bsxU1ltrt9mPho/JrVeMS17sI9GjIeNCLcb2bIFTzZ6I8d+hFddgmHFItgLJLJWUYDIHjhE0yB6zLKVkDmeQ/T4Qy2UaV2x8O+KQa+7Chl8DaTfnr/0b8flaFG9VSLJKA/QJ/Sl07oCbRQt3l9bHXvVMux0VTGavEjpKwtFFtWkDx/vDxJoFsA+oMkGaF2AP2+jIc3WCATaprllUxI42pav52m065fpPEvMfK8LJ3L6t5IOa49LieoNPz23s5GOsN66E6kmNuuWQ/HH7I0vPovoeHqizX9CkHTdTYuI87Je39yEjVliMQurEUouHlZU075P06SBYGnObp9yp",
-			Fingerprint: "SHA256:Wd9Yd+FVfvQUCkWqwSU+ounQB8/BIZRRrw+/Ql+FsoA",
+			Fingerprint: "SHA256:3KjbpRT4VsGlI1IDkzUJRBBRAH6BfBDmZk56xxQ+hVM",
 		},
 		{
 			Name: "rsa-2",
 			//nolint
 			PublicKey:   "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDEAIu+Kqb3/3Lju+6r4DG7Vj36FtCf98wkWAcJECdvOde9QvBWLNC3butZZDUdu85ceQ0gRQrLXhLO8hwmf9ByRfUbsAiPR/xEMBKrYnHdaZEjwQMELGeoYpm3xQtcKHI5jRBdrR6jd0GLjwev8EDIJYmXF0Mu5GYR1aTadkKQBEPv52XcJgVS17HxI+L5s44xoqUedLUPBR2toj3ga7awzVDBRhlJRrShvmOso0AuOxRm1IfjtA1bsSgov2041v92d/xHURCfCLc6Nu/TEhKgx6DZk4flslMcRUdT5z/HeWfBtrjl0tTrJ6fIHffi/v9MsXXwnKe6dhUn5Ey10brN",
-			Fingerprint: "SHA256:Iy9/3NLnJQgyJmqy/1cUX+nemcxXUIOiSGfWUCB6+Zs",
+			Fingerprint: "SHA256:GNL28jyD+Ms8M94wrm7IYrOWaFNe1JIKSafj2vCRDOE",
 		},
 		{
 			Name:        "ed25519-1",
 			PublicKey:   "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMYMPf45N2zLPaI4SOxE4QJH/f4jhaLt7bSk75RVoIOA vscode@8422b61228f0",
-			Fingerprint: "SHA256:Wd9Yd+FVfvQUCkWqwSU+ounQB8/BIZRRrw+/Ql+FsoA",
+			Fingerprint: "SHA256:xb6JQiXnNDMK8AE37Un5u/JoSpKlGb8za/Dp9FgMzRA",
 		},
 		{
 			Name:      "error",
@@ -111,4 +119,529 @@ func TestIsNotFound(t *testing.T) {
 			assert.Equal(test.Expected, result)
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestGetInstance(t *testing.T) {
+	machineID := "test-machine-id"
+	name := instanceName(machineID)
+
+	instance := func(id string, state core.InstanceLifecycleStateEnum) core.Instance {
+		return core.Instance{
+			Id:             common.String(id),
+			CompartmentId:  common.String("compartment-id"),
+			DisplayName:    common.String(name),
+			LifecycleState: state,
+			FreeformTags:   map[string]string{labelMachineID: machineID},
+		}
+	}
+
+	tests := []struct {
+		Name      string
+		Instances []core.Instance
+		Cached    string
+		Expected  string
+		Error     error
+	}{
+		{
+			Name:      "not found",
+			Instances: []core.Instance{},
+			Error:     MissingServer(),
+		},
+		{
+			Name: "ignores terminated",
+			Instances: []core.Instance{
+				instance("dead-1", core.InstanceLifecycleStateTerminated),
+				instance("live", core.InstanceLifecycleStateStopped),
+				instance("dead-2", core.InstanceLifecycleStateTerminating),
+			},
+			Expected: "live",
+		},
+		{
+			Name: "only terminated",
+			Instances: []core.Instance{
+				instance("dead", core.InstanceLifecycleStateTerminated),
+			},
+			Error: MissingServer(),
+		},
+		{
+			Name: "ignores other compartment",
+			Instances: []core.Instance{
+				func() core.Instance {
+					i := instance("other", core.InstanceLifecycleStateRunning)
+					i.CompartmentId = common.String("other-compartment-id")
+					return i
+				}(),
+			},
+			Error: MissingServer(),
+		},
+		{
+			Name: "multiple live",
+			Instances: []core.Instance{
+				instance("live-1", core.InstanceLifecycleStateRunning),
+				instance("live-2", core.InstanceLifecycleStateProvisioning),
+			},
+			Error: ErrMultipleInstancesFound(name),
+		},
+		{
+			Name: "uses cache",
+			Instances: []core.Instance{
+				instance("live-1", core.InstanceLifecycleStateRunning),
+				instance("live-2", core.InstanceLifecycleStateRunning),
+			},
+			Cached:   "live-2",
+			Expected: "live-2",
+		},
+		{
+			Name: "stale cache",
+			Instances: []core.Instance{
+				instance("dead", core.InstanceLifecycleStateTerminated),
+				instance("live", core.InstanceLifecycleStateRunning),
+			},
+			Cached:   "dead",
+			Expected: "live",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			opts := &options.Options{
+				MachineID:     machineID,
+				MachineFolder: t.TempDir(),
+				CompartmentID: "compartment-id",
+			}
+			if test.Cached != "" {
+				assert.NoError(saveState(opts.MachineFolder, &machineState{InstanceID: test.Cached}))
+			}
+
+			o := &Oracle{computeClient: &fakeCompute{instances: test.Instances}}
+
+			result, err := o.GetInstance(context.Background(), opts)
+
+			if test.Error == nil {
+				assert.NoError(err)
+				assert.Equal(test.Expected, *result.Id)
+				assert.Equal(test.Expected, loadState(opts.MachineFolder).InstanceID)
+			} else {
+				assert.EqualError(err, test.Error.Error())
+				assert.Nil(result)
+				assert.Nil(loadState(opts.MachineFolder))
+			}
+		})
+	}
+}
+
+func TestGetInstanceStaleCacheKeepsState(t *testing.T) {
+	for _, live := range []bool{false, true} {
+		m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+		m.compute.instances[0].Id = common.String("live-id")
+		m.compute.instances[0].LifecycleState = core.InstanceLifecycleStateTerminated
+		if live {
+			m.compute.instances[0].LifecycleState = core.InstanceLifecycleStateRunning
+		}
+		assert.NoError(t, saveState(m.opts.MachineFolder, &machineState{
+			InstanceID:     "dead-id",
+			IP:             "192.0.2.99",
+			LaunchNonce:    "nonce",
+			RestoredObject: "devpod/machine/nightly.tar.gz",
+		}))
+
+		_, err := m.GetInstance(context.Background(), m.opts)
+		expected := ""
+		if live {
+			assert.NoError(t, err)
+			expected = "live-id"
+		} else {
+			assert.EqualError(t, err, MissingServer().Error())
+		}
+
+		state := loadState(m.opts.MachineFolder)
+		if assert.NotNil(t, state) {
+			assert.Equal(t, expected, state.InstanceID)
+			assert.NotEqual(t, "192.0.2.99", state.IP)
+			assert.Equal(t, "nonce", state.LaunchNonce)
+			assert.Equal(t, "devpod/machine/nightly.tar.gz", state.RestoredObject)
+		}
+	}
+}
+
+func TestGetInstanceIP(t *testing.T) {
+	machineID := "test-machine-id"
+
+	instance := core.Instance{
+		Id:                 common.String("instance-id"),
+		AvailabilityDomain: common.String("AD-1"),
+		CompartmentId:      common.String("compartment-id"),
+		DisplayName:        common.String(instanceName(machineID)),
+		LifecycleState:     core.InstanceLifecycleStateRunning,
+		FreeformTags:       map[string]string{labelMachineID: machineID},
+	}
+	vnic := core.Vnic{
+		Id:             common.String("vnic-id"),
+		PublicIp:       common.String("192.0.2.10"),
+		PrivateIp:      common.String("10.0.0.10"),
+		LifecycleState: core.VnicLifecycleStateAvailable,
+		FreeformTags:   map[string]string{labelMachineID: machineID},
+	}
+	attachment := core.VnicAttachment{
+		InstanceId:     instance.Id,
+		VnicId:         vnic.Id,
+		LifecycleState: core.VnicAttachmentLifecycleStateAttached,
+	}
+
+	tests := []struct {
+		Name          string
+		State         *machineState
+		Expected      string
+		InstanceCalls int
+	}{
+		{
+			Name:          "no state",
+			Expected:      "192.0.2.10",
+			InstanceCalls: 1,
+		},
+		{
+			Name:          "cached vnic",
+			State:         &machineState{InstanceID: "instance-id", VnicID: "vnic-id", IP: "192.0.2.10"},
+			Expected:      "192.0.2.10",
+			InstanceCalls: 0,
+		},
+		{
+			Name:          "stale vnic",
+			State:         &machineState{InstanceID: "instance-id", VnicID: "old-vnic-id", IP: "192.0.2.99"},
+			Expected:      "192.0.2.10",
+			InstanceCalls: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			opts := &options.Options{
+				MachineID:     machineID,
+				MachineFolder: t.TempDir(),
+				CompartmentID: "compartment-id",
+				Region:        "us-ashburn-1",
+			}
+			if test.State != nil {
+				assert.NoError(saveState(opts.MachineFolder, test.State))
+			}
+
+			compute := &fakeCompute{
+				instances:       []core.Instance{instance},
+				vnicAttachments: []core.VnicAttachment{attachment},
+			}
+			o := &Oracle{
+				computeClient: compute,
+				networkClient: &fakeNetwork{vnics: []core.Vnic{vnic}},
+			}
+
+			ip, err := o.GetInstanceIP(context.Background(), opts)
+
+			assert.NoError(err)
+			assert.Equal(test.Expected, ip)
+			assert.Equal(test.InstanceCalls, compute.calls["ListInstances"]+compute.calls["GetInstance"])
+
+			state := loadState(opts.MachineFolder)
+			assert.Equal("instance-id", state.InstanceID)
+			assert.Equal("vnic-id", state.VnicID)
+			assert.Equal(test.Expected, state.IP)
+		})
+	}
+}
+
+func TestResumeInstance(t *testing.T) {
+	machineID := "test-machine-id"
+
+	tests := []struct {
+		Name     string
+		State    core.InstanceLifecycleStateEnum
+		Resumed  bool
+		Expected []core.InstanceActionActionEnum
+	}{
+		{
+			Name:    "no instance",
+			Resumed: false,
+		},
+		{
+			Name:    "running",
+			State:   core.InstanceLifecycleStateRunning,
+			Resumed: true,
+		},
+		{
+			Name:     "stopped",
+			State:    core.InstanceLifecycleStateStopped,
+			Resumed:  true,
+			Expected: []core.InstanceActionActionEnum{core.InstanceActionActionStart},
+		},
+		{
+			Name:    "terminated",
+			State:   core.InstanceLifecycleStateTerminated,
+			Resumed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{}
+			if test.State != "" {
+				compute.instances = []core.Instance{
+					{
+						Id:             common.String("instance-id"),
+						DisplayName:    common.String(instanceName(machineID)),
+						LifecycleState: test.State,
+						FreeformTags:   map[string]string{labelMachineID: machineID},
+					},
+				}
+			}
+			o := &Oracle{computeClient: compute}
+
+			resumed, err := o.ResumeInstance(context.Background(), &options.Options{
+				MachineID:     machineID,
+				CompartmentID: "compartment-id",
+			})
+
+			assert.NoError(err)
+			assert.Equal(test.Resumed, resumed)
+			assert.Equal(test.Expected, compute.actions)
+		})
+	}
+}
+
+func TestResumeInstanceAttachesVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	machineID := "test-machine-id"
+	compute := &fakeCompute{
+		instances: []core.Instance{
+			{
+				Id:                 common.String("instance-id"),
+				CompartmentId:      common.String("compartment-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				DisplayName:        common.String(instanceName(machineID)),
+				LifecycleState:     core.InstanceLifecycleStateStopped,
+				FreeformTags:       map[string]string{labelMachineID: machineID},
+			},
+		},
+	}
+	blockstorage := &fakeBlockstorage{}
+	o := &Oracle{computeClient: compute, blockstorageClient: blockstorage}
+	opts := &options.Options{
+		MachineID:          machineID,
+		MachineFolder:      t.TempDir(),
+		CompartmentID:      "compartment-id",
+		AvailabilityDomain: "AD-1",
+		HomeVolumeSize:     50,
+	}
+
+	// A create that failed before attaching leaves a stopped instance without
+	// its home volume
+	resumed, err := o.ResumeInstance(context.Background(), opts)
+	assert.NoError(err)
+	assert.True(resumed)
+	assert.Equal(1, blockstorage.calls["CreateVolume"])
+	assert.Equal(1, compute.calls["AttachVolume"])
+	assert.Equal([]core.InstanceActionActionEnum{core.InstanceActionActionStart}, compute.actions)
+
+	// Resuming again leaves the attachment alone
+	_, err = o.ResumeInstance(context.Background(), opts)
+	assert.NoError(err)
+	assert.Equal(1, blockstorage.calls["CreateVolume"])
+	assert.Equal(1, compute.calls["AttachVolume"])
+}
+
+func TestLaunchRetryToken(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := &options.Options{
+		MachineID:     "test-machine-id",
+		MachineFolder: t.TempDir(),
+	}
+
+	first, err := launchRetryToken(opts)
+	assert.NoError(err)
+	assert.Len(first, 64)
+
+	// A retried create reuses the token
+	second, err := launchRetryToken(opts)
+	assert.NoError(err)
+	assert.Equal(first, second)
+
+	// Deleting the machine forgets it, so a re-create gets a fresh token
+	removeState(opts.MachineFolder)
+	third, err := launchRetryToken(opts)
+	assert.NoError(err)
+	assert.NotEqual(first, third)
+}
+
+func TestLockMachine(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := &options.Options{MachineID: "test", MachineFolder: t.TempDir(), LockTimeout: 300 * time.Millisecond}
+
+	unlock, err := LockMachine(context.Background(), opts)
+	assert.NoError(err)
+
+	_, err = LockMachine(context.Background(), opts)
+	assert.EqualError(err, ErrOperationInProgress("test", os.Getpid()).Error())
+
+	unlock()
+
+	// A lock left behind by a process that died is taken over
+	path := filepath.Join(opts.MachineFolder, machineLockFile)
+	assert.NoError(os.WriteFile(path, []byte(strconv.Itoa(999999999)), 0o644))
+
+	unlock, err = LockMachine(context.Background(), opts)
+	assert.NoError(err)
+	unlock()
+}
+
+func TestLifecycleWaits(t *testing.T) {
+	machineID := "test-machine-id"
+
+	tests := []struct {
+		Name     string
+		State    core.InstanceLifecycleStateEnum
+		Run      func(o *Oracle, opts *options.Options) error
+		NoWait   bool
+		Expected core.InstanceLifecycleStateEnum
+		Actions  []core.InstanceActionActionEnum
+		Error    error
+	}{
+		{
+			Name:     "start waits for running",
+			State:    core.InstanceLifecycleStateStopped,
+			Run:      func(o *Oracle, opts *options.Options) error { return o.StartInstance(context.Background(), opts) },
+			Expected: core.InstanceLifecycleStateRunning,
+			Actions:  []core.InstanceActionActionEnum{core.InstanceActionActionStart},
+		},
+		{
+			Name:     "stop waits for stopped",
+			State:    core.InstanceLifecycleStateRunning,
+			Run:      func(o *Oracle, opts *options.Options) error { return o.StopInstance(context.Background(), opts) },
+			Expected: core.InstanceLifecycleStateStopped,
+			Actions:  []core.InstanceActionActionEnum{core.InstanceActionActionStop},
+		},
+		{
+			Name:  "delete waits for terminated",
+			State: core.InstanceLifecycleStateRunning,
+			Run: func(o *Oracle, opts *options.Options) error {
+				return o.DeleteInstance(context.Background(), opts, true)
+			},
+			Expected: core.InstanceLifecycleStateTerminated,
+		},
+		{
+			Name:     "start already in progress is not repeated",
+			State:    core.InstanceLifecycleStateStarting,
+			Run:      func(o *Oracle, opts *options.Options) error { return o.StartInstance(context.Background(), opts) },
+			NoWait:   true,
+			Expected: core.InstanceLifecycleStateStarting,
+		},
+		{
+			Name:     "times out",
+			State:    core.InstanceLifecycleStateStarting,
+			Run:      func(o *Oracle, opts *options.Options) error { return o.StartInstance(context.Background(), opts) },
+			Expected: core.InstanceLifecycleStateStarting,
+			Error:    ErrWaitTimeout(string(core.InstanceLifecycleStateRunning), 10*time.Millisecond),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{
+				instances: []core.Instance{
+					{
+						Id:             common.String("instance-id"),
+						DisplayName:    common.String(instanceName(machineID)),
+						LifecycleState: test.State,
+						FreeformTags:   map[string]string{labelMachineID: machineID},
+					},
+				},
+			}
+			o := &Oracle{computeClient: compute, blockstorageClient: &fakeBlockstorage{}}
+
+			err := test.Run(o, &options.Options{
+				MachineID:     machineID,
+				CompartmentID: "compartment-id",
+				WaitTimeout:   10 * time.Millisecond,
+				NoWait:        test.NoWait,
+			})
+
+			if test.Error == nil {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, test.Error.Error())
+			}
+			assert.Equal(test.Expected, compute.instances[0].LifecycleState)
+			assert.Equal(test.Actions, compute.actions)
+		})
+	}
+}
+
+func TestBuildInstanceOptionsBootVolume(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		Name     string
+		DiskSize int
+		Error    string
+	}{
+		{
+			Name:     "larger than image",
+			DiskSize: 200,
+		},
+		{
+			Name:     "smaller than image",
+			DiskSize: 50,
+			Error:    "option DISK_SIZE of 50 GB is smaller than image Canonical-Ubuntu-22.04 (61440 MB)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			o := &Oracle{
+				computeClient: &fakeCompute{images: []core.Image{{
+					Id:          common.String("image-id"),
+					DisplayName: common.String("Canonical-Ubuntu-22.04"),
+					SizeInMBs:   common.Int64(60 * 1024),
+				}}},
+				networkClient: &fakeNetwork{},
+			}
+			opts := &options.Options{
+				MachineID:           "test-machine-id",
+				CompartmentID:       "compartment-id",
+				AvailabilityDomain:  "AD-1",
+				DiskImage:           "Canonical-Ubuntu-22.04",
+				DiskSize:            test.DiskSize,
+				BootVolumeVPUsPerGB: 20,
+				KMSKeyID:            "key-id",
+				AgentPlugins:        []options.AgentPlugin{{Name: "Bastion", Enabled: false}},
+			}
+
+			publicKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMYMPf45N2zLPaI4SOxE4QJH/f4jhaLt7bSk75RVoIOA"
+			request, err := o.BuildInstanceOptions(context.Background(), opts, publicKey)
+
+			if test.Error != "" {
+				assert.EqualError(err, test.Error)
+				return
+			}
+			assert.NoError(err)
+			source := request.SourceDetails.(*core.InstanceSourceViaImageDetails)
+			assert.Equal(int64(test.DiskSize), *source.BootVolumeSizeInGBs)
+			assert.Equal(int64(20), *source.BootVolumeVpusPerGB)
+			assert.Equal("key-id", *source.KmsKeyId)
+			assert.True(*request.InstanceOptions.AreLegacyImdsEndpointsDisabled)
+			assert.Equal([]core.InstanceAgentPluginConfigDetails{
+				{Name: common.String("Bastion"), DesiredState: core.InstanceAgentPluginConfigDetailsDesiredStateDisabled},
+			}, request.AgentConfig.PluginsConfig)
+		})
+	}
+}
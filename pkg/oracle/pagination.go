@@ -0,0 +1,47 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+	"fmt"
+)
+
+// listPage fetches a single page of a list call. page is nil for the first
+// page and the returned next page is nil or empty after the last one.
+type listPage[T any] func(ctx context.Context, page *string) (items []T, nextPage *string, err error)
+
+// listAll reads every page of an OCI list call by following OpcNextPage
+func listAll[T any](ctx context.Context, fetch listPage[T]) ([]T, error) {
+	var all []T
+	var page *string
+
+	for i := 0; i < maxListPages; i++ {
+		items, next, err := fetch(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+
+		if next == nil || *next == "" {
+			return all, nil
+		}
+		page = next
+	}
+
+	return nil, fmt.Errorf("exceeded maximum number of list pages: %d", maxListPages)
+}
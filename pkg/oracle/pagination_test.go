@@ -0,0 +1,182 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAll(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Items    []int
+		Error    error
+		Expected []int
+	}{
+		{
+			Name:     "empty",
+			Items:    []int{},
+			Expected: nil,
+		},
+		{
+			Name:     "single page",
+			Items:    []int{1, 2},
+			Expected: []int{1, 2},
+		},
+		{
+			Name:     "multiple pages",
+			Items:    []int{1, 2, 3, 4, 5},
+			Expected: []int{1, 2, 3, 4, 5},
+		},
+		{
+			Name:  "error",
+			Items: []int{1, 2, 3},
+			Error: errors.New("some error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			result, err := listAll(context.Background(), func(_ context.Context, page *string) ([]int, *string, error) {
+				if test.Error != nil && page != nil {
+					return nil, nil, test.Error
+				}
+				items, next := fakePage(test.Items, page)
+				return items, next, nil
+			})
+
+			if test.Error == nil {
+				assert.NoError(err)
+				assert.Equal(test.Expected, result)
+			} else {
+				assert.ErrorIs(err, test.Error)
+				assert.Nil(result)
+			}
+		})
+	}
+}
+
+// filler generates n resources that must be skipped over
+func filler[T any](n int, build func(i int) T) []T {
+	items := make([]T, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, build(i))
+	}
+	return items
+}
+
+func TestGetInstanceOnPageThree(t *testing.T) {
+	assert := assert.New(t)
+
+	machineID := "test-machine-id"
+	displayName := fmt.Sprintf("devpod-%s", machineID)
+
+	instances := filler(2*fakePageSize, func(i int) core.Instance {
+		return core.Instance{
+			Id:          common.String(fmt.Sprintf("other-%d", i)),
+			DisplayName: common.String(fmt.Sprintf("other-%d", i)),
+		}
+	})
+	instances = append(instances, core.Instance{
+		Id:             common.String("instance-id"),
+		DisplayName:    common.String(displayName),
+		LifecycleState: core.InstanceLifecycleStateRunning,
+		FreeformTags:   map[string]string{labelMachineID: machineID},
+	})
+
+	compute := &fakeCompute{instances: instances}
+	o := &Oracle{computeClient: compute}
+
+	instance, err := o.GetInstance(context.Background(), &options.Options{
+		MachineID:     machineID,
+		CompartmentID: "compartment-id",
+	})
+
+	assert.NoError(err)
+	assert.Equal("instance-id", *instance.Id)
+	assert.Equal(3, compute.calls["ListInstances"])
+}
+
+func TestFindImageOnPageThree(t *testing.T) {
+	assert := assert.New(t)
+
+	images := filler(2*fakePageSize, func(i int) core.Image {
+		return core.Image{
+			Id:          common.String(fmt.Sprintf("other-%d", i)),
+			DisplayName: common.String(fmt.Sprintf("other-%d", i)),
+		}
+	})
+	images = append(images, core.Image{
+		Id:          common.String("image-id"),
+		DisplayName: common.String("Canonical-Ubuntu-22.04"),
+	})
+
+	compute := &fakeCompute{images: images}
+	o := &Oracle{computeClient: compute}
+
+	image, err := o.findImage(context.Background(), "compartment-id", "Canonical-Ubuntu-22.04")
+
+	assert.NoError(err)
+	assert.Equal("image-id", *image.Id)
+	assert.Equal(3, compute.calls["ListImages"])
+}
+
+func TestCreateOrGetNetworkOnPageThree(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	vcnID := common.String("vcn-id")
+
+	network := &fakeNetwork{
+		vcns: append(filler(2*fakePageSize, func(i int) core.Vcn {
+			return core.Vcn{Id: common.String(fmt.Sprintf("vcn-%d", i)), DisplayName: common.String(fmt.Sprintf("vcn-%d", i))}
+		}), core.Vcn{Id: vcnID, DisplayName: common.String(networkVCNName), LifecycleState: core.VcnLifecycleStateAvailable}),
+		igs: append(filler(2*fakePageSize, func(i int) core.InternetGateway {
+			return core.InternetGateway{Id: common.String(fmt.Sprintf("ig-%d", i)), DisplayName: common.String(fmt.Sprintf("ig-%d", i))}
+		}), core.InternetGateway{Id: common.String("ig-id"), DisplayName: common.String(networkInternetGatewayName)}),
+		rts: append(filler(2*fakePageSize, func(i int) core.RouteTable {
+			return core.RouteTable{Id: common.String(fmt.Sprintf("rt-%d", i)), DisplayName: common.String(fmt.Sprintf("rt-%d", i))}
+		}), core.RouteTable{Id: common.String("rt-id"), DisplayName: common.String(networkRouteTableName)}),
+		subnets: append(filler(2*fakePageSize, func(i int) core.Subnet {
+			return core.Subnet{Id: common.String(fmt.Sprintf("subnet-%d", i)), DisplayName: common.String(fmt.Sprintf("subnet-%d", i))}
+		}), core.Subnet{Id: common.String("subnet-id"), DisplayName: common.String(networkSubnetName)}),
+	}
+	o := &Oracle{networkClient: network}
+
+	vcn, subnet, err := o.createOrGetNetwork(context.Background(), "compartment-id", "AD-1")
+
+	assert.NoError(err)
+	assert.Equal(*vcnID, *vcn.Id)
+	assert.Equal("subnet-id", *subnet.Id)
+
+	for _, call := range []string{"ListVcns", "ListInternetGateways", "ListRouteTables", "ListSubnets"} {
+		assert.Equal(3, network.calls[call], call)
+	}
+	for _, call := range []string{"CreateVcn", "CreateInternetGateway", "CreateRouteTable", "CreateSubnet"} {
+		assert.Zero(network.calls[call], call)
+	}
+}
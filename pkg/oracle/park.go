@@ -0,0 +1,233 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// A machine is parked when a stop in terminate mode has terminated its
+// instance and only the boot volume is left. Compute is not billed while
+// parked, and start launches a new instance from the boot volume.
+
+// parkInstance stops the instance gracefully and terminates it, preserving
+// the boot volume and recording what is needed to launch it again
+func (o *Oracle) parkInstance(ctx context.Context, opts *options.Options, instance *core.Instance) error {
+	parked, err := o.describeForPark(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	// A shutdown first so that the guest flushes its disks. It is waited for
+	// even with NoWait, which only skips the wait for the termination.
+	if instance.LifecycleState != core.InstanceLifecycleStateStopped {
+		shutdownOpts := *opts
+		shutdownOpts.NoWait = false
+		if err := o.shutdown(ctx, &shutdownOpts, instance); err != nil {
+			return err
+		}
+	}
+
+	// Record the boot volume before terminating so that it is never lost
+	state := loadState(opts.MachineFolder)
+	if state == nil {
+		state = &machineState{}
+	}
+	state.InstanceID = ""
+	state.VnicID = ""
+	state.IP = ""
+	state.BootVolumeID = parked.BootVolumeID
+	state.Parked = parked
+	if err := saveState(opts.MachineFolder, state); err != nil {
+		return errors.Wrap(err, "save machine state")
+	}
+
+	log.Default.Infof("Terminating instance %s and keeping boot volume %s", *instance.Id, parked.BootVolumeID)
+
+	_, err = o.computeClient.TerminateInstance(ctx, core.TerminateInstanceRequest{
+		InstanceId:         instance.Id,
+		PreserveBootVolume: common.Bool(true),
+	})
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	if opts.NoWait {
+		return nil
+	}
+
+	return o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateTerminated, opts.WaitTimeout)
+}
+
+func (o *Oracle) describeForPark(ctx context.Context, instance *core.Instance) (*parkedInstance, error) {
+	bootVolumeID, err := o.getBootVolumeID(ctx, instance)
+	if err != nil {
+		return nil, errors.Wrap(err, "get boot volume")
+	}
+
+	vnic, err := o.getPrimaryVnic(ctx, instance)
+	if err != nil {
+		return nil, errors.Wrap(err, "get primary VNIC")
+	}
+
+	parked := &parkedInstance{
+		BootVolumeID:       bootVolumeID,
+		AvailabilityDomain: *instance.AvailabilityDomain,
+		Shape:              *instance.Shape,
+		SubnetID:           *vnic.SubnetId,
+		Metadata:           instance.Metadata,
+	}
+	if instance.ShapeConfig != nil {
+		parked.Ocpus = instance.ShapeConfig.Ocpus
+		parked.MemoryInGBs = instance.ShapeConfig.MemoryInGBs
+	}
+
+	return parked, nil
+}
+
+// unparkInstance launches a new instance from the parked boot volume with the
+// shape, subnet and metadata of the instance that was terminated
+func (o *Oracle) unparkInstance(ctx context.Context, opts *options.Options, parked *parkedInstance) error {
+	log.Default.Infof("Launching instance from boot volume %s", parked.BootVolumeID)
+
+	token, err := launchRetryToken(opts)
+	if err != nil {
+		return errors.Wrap(err, "generate retry token")
+	}
+
+	platformConfig, err := o.platformConfig(ctx, opts, parked.Shape, nil)
+	if err != nil {
+		return err
+	}
+
+	details := core.LaunchInstanceDetails{
+		AvailabilityDomain: &parked.AvailabilityDomain,
+		CompartmentId:      &opts.CompartmentID,
+		Shape:              &parked.Shape,
+		DisplayName:        common.String(instanceName(opts.MachineID)),
+		SourceDetails: core.InstanceSourceViaBootVolumeDetails{
+			BootVolumeId: &parked.BootVolumeID,
+		},
+		LaunchOptions: &core.LaunchOptions{
+			BootVolumeType:                  core.LaunchOptionsBootVolumeTypeParavirtualized,
+			NetworkType:                     core.LaunchOptionsNetworkTypeParavirtualized,
+			IsConsistentVolumeNamingEnabled: common.Bool(true),
+			IsPvEncryptionInTransitEnabled:  common.Bool(opts.PvEncryptionInTransit),
+		},
+		IsPvEncryptionInTransitEnabled: common.Bool(opts.PvEncryptionInTransit),
+		CreateVnicDetails: &core.CreateVnicDetails{
+			SubnetId:       &parked.SubnetID,
+			AssignPublicIp: common.Bool(true),
+			FreeformTags: map[string]string{
+				labelMachineID: opts.MachineID,
+				labelType:      labelTypeDevPod,
+			},
+		},
+		Metadata: parked.Metadata,
+		FreeformTags: map[string]string{
+			labelMachineID: opts.MachineID,
+			labelType:      labelTypeDevPod,
+		},
+		PlatformConfig:            platformConfig,
+		InstanceOptions:           instanceOptions(opts),
+		AgentConfig:               agentConfig(opts),
+		PreemptibleInstanceConfig: preemptibleConfig(opts),
+		CapacityReservationId:     optionalString(opts.CapacityReservationID),
+		DedicatedVmHostId:         optionalString(opts.DedicatedVMHostID),
+	}
+	if parked.Ocpus != nil || parked.MemoryInGBs != nil {
+		details.ShapeConfig = &core.LaunchInstanceShapeConfigDetails{
+			Ocpus:       parked.Ocpus,
+			MemoryInGBs: parked.MemoryInGBs,
+		}
+	}
+
+	response, err := o.computeClient.LaunchInstance(ctx, core.LaunchInstanceRequest{
+		LaunchInstanceDetails: details,
+		// The launch token would replay the instance that was parked
+		OpcRetryToken: common.String(retryToken(token, "unpark", parked.BootVolumeID)),
+	})
+	if err != nil {
+		return o.explainLaunchError(ctx, opts, parked.Shape, err)
+	}
+	instance := &response.Instance
+
+	o.recordInstance(ctx, opts, instance)
+
+	if err := o.AttachVolumes(ctx, opts, instance); err != nil {
+		return errors.Wrap(err, "attach volumes")
+	}
+
+	if opts.NoWait {
+		return nil
+	}
+
+	return o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateRunning, opts.WaitTimeout)
+}
+
+// isParked returns true if the machine has no instance but its parked boot
+// volume still exists
+func (o *Oracle) isParked(ctx context.Context, opts *options.Options) (bool, error) {
+	parked := parkedState(opts)
+	if parked == nil {
+		return false, nil
+	}
+
+	response, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{
+		BootVolumeId: &parked.BootVolumeID,
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return !isTerminal(string(response.LifecycleState)), nil
+}
+
+// deleteParkedBootVolume removes the boot volume of a parked machine
+func (o *Oracle) deleteParkedBootVolume(ctx context.Context, opts *options.Options) error {
+	parked := parkedState(opts)
+	if parked == nil {
+		return nil
+	}
+
+	log.Default.Infof("Deleting boot volume %s", parked.BootVolumeID)
+
+	_, err := o.blockstorageClient.DeleteBootVolume(ctx, core.DeleteBootVolumeRequest{
+		BootVolumeId: &parked.BootVolumeID,
+	})
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrap(err, "delete boot volume")
+	}
+
+	return nil
+}
+
+func parkedState(opts *options.Options) *parkedInstance {
+	state := loadState(opts.MachineFolder)
+	if state == nil {
+		return nil
+	}
+	return state.Parked
+}
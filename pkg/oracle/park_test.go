@@ -0,0 +1,96 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/devpod/pkg/client"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopModeTerminate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+
+	assert.Equal([]core.InstanceActionActionEnum{core.InstanceActionActionStop}, m.compute.actions)
+	assert.Equal(core.InstanceLifecycleStateTerminated, m.compute.instances[0].LifecycleState)
+	assert.Equal("boot-volume-id", loadState(m.opts.MachineFolder).Parked.BootVolumeID)
+
+	status, err := m.GetInstanceStatus(ctx, m.opts)
+	assert.NoError(err)
+	assert.Equal(client.StatusStopped, status)
+
+	// Stopping again is a no-op
+	assert.NoError(m.StopInstance(ctx, m.opts))
+
+	assert.NoError(m.StartInstance(ctx, m.opts))
+
+	if assert.Len(m.compute.launches, 1) {
+		launch := m.compute.launches[0]
+		assert.Equal("boot-volume-id", *launch.SourceDetails.(core.InstanceSourceViaBootVolumeDetails).BootVolumeId)
+		assert.Equal("VM.Standard.E4.Flex", *launch.Shape)
+		assert.Equal(float32(2), *launch.ShapeConfig.Ocpus)
+		assert.Equal("subnet-id", *launch.CreateVnicDetails.SubnetId)
+		assert.Equal("AD-1", *launch.AvailabilityDomain)
+		assert.Equal("data", launch.Metadata["user_data"])
+	}
+	assert.Nil(loadState(m.opts.MachineFolder).Parked)
+
+	status, err = m.GetInstanceStatus(ctx, m.opts)
+	assert.NoError(err)
+	assert.Equal(client.StatusRunning, status)
+}
+
+func TestStopModeTerminateNoWait(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.opts.StopMode = options.StopModeTerminate
+	m.compute.ignoreSoftstop = true
+	m.opts.StopGracePeriod = 10 * time.Millisecond
+	m.opts.NoWait = true
+
+	// The guest is still shut down, and forced off, before it is terminated
+	assert.NoError(m.StopInstance(context.Background(), m.opts))
+	assert.Equal([]core.InstanceActionActionEnum{core.InstanceActionActionSoftstop, core.InstanceActionActionStop}, m.compute.actions)
+	assert.Equal(1, m.compute.calls["TerminateInstance"])
+	assert.Equal("boot-volume-id", loadState(m.opts.MachineFolder).Parked.BootVolumeID)
+}
+
+func TestDeleteParked(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+
+	assert.NoError(m.DeleteInstance(ctx, m.opts, true))
+
+	assert.Equal(1, m.blockstorage.calls["DeleteBootVolume"])
+	assert.Nil(loadState(m.opts.MachineFolder))
+
+	status, err := m.GetInstanceStatus(ctx, m.opts)
+	assert.NoError(err)
+	assert.Equal(client.StatusNotFound, status)
+}
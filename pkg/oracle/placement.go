@@ -0,0 +1,160 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"strings"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// validateCapacityReservation checks that the capacity reservation can hold
+// the machine: it must be active, in the configured availability domain and
+// reserve the configured shape in any fault domain, as instances are launched
+// without one
+func (o *Oracle) validateCapacityReservation(ctx context.Context, opts *options.Options) error {
+	if opts.CapacityReservationID == "" {
+		return nil
+	}
+
+	response, err := o.computeClient.GetComputeCapacityReservation(ctx, core.GetComputeCapacityReservationRequest{
+		CapacityReservationId: &opts.CapacityReservationID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "get capacity reservation")
+	}
+	reservation := response.ComputeCapacityReservation
+
+	if reservation.LifecycleState != core.ComputeCapacityReservationLifecycleStateActive &&
+		reservation.LifecycleState != core.ComputeCapacityReservationLifecycleStateUpdating {
+		return ErrPlacementNotActive("capacity reservation", opts.CapacityReservationID, string(reservation.LifecycleState))
+	}
+	if *reservation.AvailabilityDomain != opts.AvailabilityDomain {
+		return ErrPlacementAvailabilityDomain("capacity reservation", opts.CapacityReservationID, *reservation.AvailabilityDomain)
+	}
+
+	config := reservationConfig(&reservation, opts.MachineType)
+	if config == nil {
+		var shapes, faultDomains []string
+		for _, c := range reservation.InstanceReservationConfigs {
+			shapes = append(shapes, *c.InstanceShape)
+			if *c.InstanceShape == opts.MachineType && c.FaultDomain != nil {
+				faultDomains = append(faultDomains, *c.FaultDomain)
+			}
+		}
+		if len(faultDomains) > 0 {
+			return ErrCapacityReservationFaultDomain(opts.CapacityReservationID, opts.MachineType, strings.Join(faultDomains, ", "))
+		}
+		return ErrPlacementShape("capacity reservation", opts.CapacityReservationID, opts.MachineType, strings.Join(shapes, ", "))
+	}
+
+	if *config.UsedCount >= *config.ReservedCount {
+		log.Default.Warnf("Capacity reservation %s has no free %s capacity right now (%d of %d used)",
+			opts.CapacityReservationID, opts.MachineType, *config.UsedCount, *config.ReservedCount)
+	}
+
+	return nil
+}
+
+// validateDedicatedVMHost checks that the dedicated VM host is active, in the
+// configured availability domain and able to run the configured shape
+func (o *Oracle) validateDedicatedVMHost(ctx context.Context, opts *options.Options) error {
+	if opts.DedicatedVMHostID == "" {
+		return nil
+	}
+
+	response, err := o.computeClient.GetDedicatedVmHost(ctx, core.GetDedicatedVmHostRequest{
+		DedicatedVmHostId: &opts.DedicatedVMHostID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "get dedicated VM host")
+	}
+	host := response.DedicatedVmHost
+
+	if host.LifecycleState != core.DedicatedVmHostLifecycleStateActive {
+		return ErrPlacementNotActive("dedicated VM host", opts.DedicatedVMHostID, string(host.LifecycleState))
+	}
+	if *host.AvailabilityDomain != opts.AvailabilityDomain {
+		return ErrPlacementAvailabilityDomain("dedicated VM host", opts.DedicatedVMHostID, *host.AvailabilityDomain)
+	}
+
+	shapes, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.DedicatedVmHostInstanceShapeSummary, *string, error) {
+		response, err := o.computeClient.ListDedicatedVmHostInstanceShapes(ctx, core.ListDedicatedVmHostInstanceShapesRequest{
+			CompartmentId:        &opts.CompartmentID,
+			AvailabilityDomain:   host.AvailabilityDomain,
+			DedicatedVmHostShape: host.DedicatedVmHostShape,
+			Page:                 page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "list dedicated VM host shapes")
+	}
+
+	var names []string
+	for _, s := range shapes {
+		if *s.InstanceShapeName == opts.MachineType {
+			return nil
+		}
+		names = append(names, *s.InstanceShapeName)
+	}
+
+	return ErrPlacementShape("dedicated VM host", opts.DedicatedVMHostID, opts.MachineType, strings.Join(names, ", "))
+}
+
+// explainLaunchError replaces an opaque launch failure with a clear message
+// when the capacity reservation has run out of room for the shape
+func (o *Oracle) explainLaunchError(ctx context.Context, opts *options.Options, shape string, launchErr error) error {
+	if opts.CapacityReservationID == "" {
+		return launchErr
+	}
+
+	response, err := o.computeClient.GetComputeCapacityReservation(ctx, core.GetComputeCapacityReservationRequest{
+		CapacityReservationId: &opts.CapacityReservationID,
+	})
+	if err != nil {
+		return launchErr
+	}
+
+	config := reservationConfig(&response.ComputeCapacityReservation, shape)
+	if config == nil || *config.UsedCount < *config.ReservedCount {
+		return launchErr
+	}
+
+	return errors.Wrap(launchErr, ErrCapacityReservationExhausted(opts.CapacityReservationID, shape, *config.ReservedCount).Error())
+}
+
+// reservationConfig returns the reserved capacity for the shape that is not
+// tied to a fault domain
+func reservationConfig(reservation *core.ComputeCapacityReservation, shape string) *core.InstanceReservationConfig {
+	for i, c := range reservation.InstanceReservationConfigs {
+		if *c.InstanceShape == shape && c.FaultDomain == nil {
+			return &reservation.InstanceReservationConfigs[i]
+		}
+	}
+	return nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
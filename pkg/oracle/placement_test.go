@@ -0,0 +1,181 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReservation(used int64) *core.ComputeCapacityReservation {
+	return &core.ComputeCapacityReservation{
+		AvailabilityDomain: common.String("AD-1"),
+		LifecycleState:     core.ComputeCapacityReservationLifecycleStateActive,
+		InstanceReservationConfigs: []core.InstanceReservationConfig{
+			{InstanceShape: common.String("VM.Standard.E4.Flex"), ReservedCount: common.Int64(2), UsedCount: common.Int64(used)},
+		},
+	}
+}
+
+func TestInitPlacement(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Opts    options.Options
+		Compute *fakeCompute
+		Error   string
+	}{
+		{
+			Name: "no placement",
+			Opts: options.Options{},
+		},
+		{
+			Name:    "reservation",
+			Opts:    options.Options{CapacityReservationID: "reservation-id"},
+			Compute: &fakeCompute{reservation: testReservation(0)},
+		},
+		{
+			Name:    "full reservation only warns",
+			Opts:    options.Options{CapacityReservationID: "reservation-id"},
+			Compute: &fakeCompute{reservation: testReservation(2)},
+		},
+		{
+			Name: "reservation in other availability domain",
+			Opts: options.Options{CapacityReservationID: "reservation-id"},
+			Compute: &fakeCompute{reservation: func() *core.ComputeCapacityReservation {
+				r := testReservation(0)
+				r.AvailabilityDomain = common.String("AD-2")
+				return r
+			}()},
+			Error: "capacity reservation reservation-id is in availability domain AD-2 - set AVAILABILITY_DOMAIN to match",
+		},
+		{
+			Name:    "reservation for other shape",
+			Opts:    options.Options{CapacityReservationID: "reservation-id", MachineType: "VM.Standard.A1.Flex"},
+			Compute: &fakeCompute{reservation: testReservation(0)},
+			Error:   "capacity reservation reservation-id cannot run shape VM.Standard.A1.Flex (supported: VM.Standard.E4.Flex)",
+		},
+		{
+			Name: "reservation in a fault domain",
+			Opts: options.Options{CapacityReservationID: "reservation-id"},
+			Compute: &fakeCompute{reservation: func() *core.ComputeCapacityReservation {
+				r := testReservation(0)
+				r.InstanceReservationConfigs[0].FaultDomain = common.String("FAULT-DOMAIN-2")
+				return r
+			}()},
+			Error: "capacity reservation reservation-id only reserves shape VM.Standard.E4.Flex in fault domains FAULT-DOMAIN-2, " +
+				"but instances are launched without one",
+		},
+		{
+			Name: "inactive reservation",
+			Opts: options.Options{CapacityReservationID: "reservation-id"},
+			Compute: &fakeCompute{reservation: func() *core.ComputeCapacityReservation {
+				r := testReservation(0)
+				r.LifecycleState = core.ComputeCapacityReservationLifecycleStateDeleted
+				return r
+			}()},
+			Error: "capacity reservation reservation-id is DELETED, not ACTIVE",
+		},
+		{
+			Name: "dedicated host",
+			Opts: options.Options{DedicatedVMHostID: "host-id"},
+			Compute: &fakeCompute{
+				dedicatedHost: &core.DedicatedVmHost{
+					AvailabilityDomain:   common.String("AD-1"),
+					DedicatedVmHostShape: common.String("DVH.Standard.E4.128"),
+					LifecycleState:       core.DedicatedVmHostLifecycleStateActive,
+				},
+				hostShapes: []core.DedicatedVmHostInstanceShapeSummary{
+					{InstanceShapeName: common.String("VM.Standard.E3.Flex")},
+					{InstanceShapeName: common.String("VM.Standard.E4.Flex")},
+				},
+			},
+		},
+		{
+			Name: "dedicated host for other shape",
+			Opts: options.Options{DedicatedVMHostID: "host-id"},
+			Compute: &fakeCompute{
+				dedicatedHost: &core.DedicatedVmHost{
+					AvailabilityDomain:   common.String("AD-1"),
+					DedicatedVmHostShape: common.String("DVH.Standard.E3.128"),
+					LifecycleState:       core.DedicatedVmHostLifecycleStateActive,
+				},
+				hostShapes: []core.DedicatedVmHostInstanceShapeSummary{
+					{InstanceShapeName: common.String("VM.Standard.E3.Flex")},
+				},
+			},
+			Error: "dedicated VM host host-id cannot run shape VM.Standard.E4.Flex (supported: VM.Standard.E3.Flex)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			opts := test.Opts
+			opts.CompartmentID = "compartment-id"
+			opts.AvailabilityDomain = "AD-1"
+			if opts.MachineType == "" {
+				opts.MachineType = "VM.Standard.E4.Flex"
+			}
+			compute := test.Compute
+			if compute == nil {
+				compute = &fakeCompute{}
+			}
+			o := &Oracle{computeClient: compute}
+
+			err := o.validateCapacityReservation(context.Background(), &opts)
+			if err == nil {
+				err = o.validateDedicatedVMHost(context.Background(), &opts)
+			}
+
+			if test.Error == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, test.Error)
+			}
+		})
+	}
+}
+
+func TestLaunchIntoExhaustedReservation(t *testing.T) {
+	assert := assert.New(t)
+
+	launchErr := errors.New("Out of host capacity")
+	compute := &fakeCompute{reservation: testReservation(2), launchErr: launchErr}
+	o := &Oracle{computeClient: compute}
+	opts := &options.Options{
+		MachineID:             "test-machine-id",
+		MachineFolder:         t.TempDir(),
+		CapacityReservationID: "reservation-id",
+	}
+
+	_, err := o.LaunchInstance(context.Background(), opts, &core.LaunchInstanceRequest{
+		LaunchInstanceDetails: core.LaunchInstanceDetails{
+			Shape:                 common.String("VM.Standard.E4.Flex"),
+			CapacityReservationId: common.String("reservation-id"),
+		},
+	})
+
+	assert.ErrorIs(err, launchErr)
+	assert.Contains(err.Error(), "capacity reservation reservation-id is exhausted: all 2 reserved VM.Standard.E4.Flex instances are in use")
+	assert.Equal("reservation-id", *compute.launches[0].CapacityReservationId)
+}
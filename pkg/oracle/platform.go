@@ -0,0 +1,156 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// platformConfig returns the platform configuration that turns on shielded
+// instance or confidential computing features for the shape, or nil if
+// neither is wanted. If an image is given, the shape must be compatible with
+// it, and shielded instances also need an image that boots with UEFI.
+func (o *Oracle) platformConfig(
+	ctx context.Context, opts *options.Options, shape string, image *core.Image,
+) (core.LaunchInstancePlatformConfig, error) {
+	if !opts.ShieldedInstance && !opts.ConfidentialComputing {
+		return nil, nil
+	}
+
+	if opts.ShieldedInstance && image != nil && image.LaunchOptions != nil &&
+		image.LaunchOptions.Firmware != "" && image.LaunchOptions.Firmware != core.LaunchOptionsFirmwareUefi64 {
+		return nil, ErrPlatformImage(*image.DisplayName, "shielded instances need UEFI firmware, not "+string(image.LaunchOptions.Firmware))
+	}
+
+	platform, err := o.shapePlatformOptions(ctx, opts, shape, image)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ShieldedInstance {
+		if platform == nil || platform.SecureBootOptions == nil || platform.MeasuredBootOptions == nil ||
+			platform.TrustedPlatformModuleOptions == nil ||
+			!contains(platform.SecureBootOptions.AllowedValues, true) ||
+			!contains(platform.MeasuredBootOptions.AllowedValues, true) ||
+			!contains(platform.TrustedPlatformModuleOptions.AllowedValues, true) {
+			return nil, ErrPlatformShape(shape, "shielded instances")
+		}
+	}
+	if opts.ConfidentialComputing {
+		if platform == nil || platform.MemoryEncryptionOptions == nil || !contains(platform.MemoryEncryptionOptions.AllowedValues, true) {
+			return nil, ErrPlatformShape(shape, "confidential computing")
+		}
+	}
+
+	shielded := common.Bool(opts.ShieldedInstance)
+	confidential := common.Bool(opts.ConfidentialComputing)
+
+	switch platform.Type {
+	case core.ShapePlatformConfigOptionsTypeAmdVm:
+		return core.AmdVmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelVm:
+		return core.IntelVmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdMilanBm:
+		return core.AmdMilanBmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdRomeBm:
+		return core.AmdRomeBmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelIcelakeBm:
+		return core.IntelIcelakeBmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelSkylakeBm:
+		return core.IntelSkylakeBmLaunchInstancePlatformConfig{
+			IsSecureBootEnabled:            shielded,
+			IsMeasuredBootEnabled:          shielded,
+			IsTrustedPlatformModuleEnabled: shielded,
+			IsMemoryEncryptionEnabled:      confidential,
+		}, nil
+	}
+
+	return nil, ErrPlatformShape(shape, "platform configuration of type "+string(platform.Type))
+}
+
+// shapePlatformOptions returns the platform options of the shape, or nil if
+// it has none. With an image, only shapes compatible with it are listed.
+func (o *Oracle) shapePlatformOptions(
+	ctx context.Context, opts *options.Options, shape string, image *core.Image,
+) (*core.ShapePlatformConfigOptions, error) {
+	var imageID *string
+	if image != nil {
+		imageID = image.Id
+	}
+
+	shapes, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Shape, *string, error) {
+		response, err := o.computeClient.ListShapes(ctx, core.ListShapesRequest{
+			CompartmentId:      &opts.CompartmentID,
+			AvailabilityDomain: &opts.AvailabilityDomain,
+			ImageId:            imageID,
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list shapes")
+	}
+
+	for _, s := range shapes {
+		if *s.Shape == shape {
+			return s.PlatformConfigOptions, nil
+		}
+	}
+
+	if image != nil {
+		return nil, ErrPlatformImage(*image.DisplayName, "it cannot run shape "+shape)
+	}
+	return nil, ErrPlatformShape(shape, "this availability domain")
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformConfig(t *testing.T) {
+	all := []bool{false, true}
+	shapes := []core.Shape{
+		{
+			Shape: common.String("VM.Standard.E4.Flex"),
+			PlatformConfigOptions: &core.ShapePlatformConfigOptions{
+				Type:                         core.ShapePlatformConfigOptionsTypeAmdVm,
+				SecureBootOptions:            &core.ShapeSecureBootOptions{AllowedValues: all},
+				MeasuredBootOptions:          &core.ShapeMeasuredBootOptions{AllowedValues: all},
+				TrustedPlatformModuleOptions: &core.ShapeTrustedPlatformModuleOptions{AllowedValues: all},
+				MemoryEncryptionOptions:      &core.ShapeMemoryEncryptionOptions{AllowedValues: all},
+			},
+		},
+		{
+			Shape: common.String("VM.Standard3.Flex"),
+			PlatformConfigOptions: &core.ShapePlatformConfigOptions{
+				Type:                         core.ShapePlatformConfigOptionsTypeIntelVm,
+				SecureBootOptions:            &core.ShapeSecureBootOptions{AllowedValues: all},
+				MeasuredBootOptions:          &core.ShapeMeasuredBootOptions{AllowedValues: all},
+				TrustedPlatformModuleOptions: &core.ShapeTrustedPlatformModuleOptions{AllowedValues: all},
+				MemoryEncryptionOptions:      &core.ShapeMemoryEncryptionOptions{AllowedValues: []bool{false}},
+			},
+		},
+		{
+			Shape: common.String("VM.Standard.A1.Flex"),
+		},
+	}
+	uefi := &core.Image{
+		Id:            common.String("uefi-image"),
+		DisplayName:   common.String("uefi"),
+		LaunchOptions: &core.LaunchOptions{Firmware: core.LaunchOptionsFirmwareUefi64},
+	}
+	bios := &core.Image{
+		Id:            common.String("bios-image"),
+		DisplayName:   common.String("bios"),
+		LaunchOptions: &core.LaunchOptions{Firmware: core.LaunchOptionsFirmwareBios},
+	}
+	imageShapes := map[string][]string{
+		"uefi-image": {"VM.Standard.E4.Flex", "VM.Standard3.Flex"},
+		"bios-image": {"VM.Standard.E4.Flex"},
+	}
+
+	tests := []struct {
+		Name         string
+		Shielded     bool
+		Confidential bool
+		Shape        string
+		Image        *core.Image
+		Expected     core.LaunchInstancePlatformConfig
+		Error        string
+	}{
+		{
+			Name:  "neither",
+			Shape: "VM.Standard.A1.Flex",
+			Image: uefi,
+		},
+		{
+			Name:     "shielded AMD",
+			Shielded: true,
+			Shape:    "VM.Standard.E4.Flex",
+			Image:    uefi,
+			Expected: core.AmdVmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(true),
+				IsMeasuredBootEnabled:          common.Bool(true),
+				IsTrustedPlatformModuleEnabled: common.Bool(true),
+				IsMemoryEncryptionEnabled:      common.Bool(false),
+			},
+		},
+		{
+			Name:     "shielded Intel",
+			Shielded: true,
+			Shape:    "VM.Standard3.Flex",
+			Image:    uefi,
+			Expected: core.IntelVmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(true),
+				IsMeasuredBootEnabled:          common.Bool(true),
+				IsTrustedPlatformModuleEnabled: common.Bool(true),
+				IsMemoryEncryptionEnabled:      common.Bool(false),
+			},
+		},
+		{
+			Name:         "confidential AMD",
+			Confidential: true,
+			Shape:        "VM.Standard.E4.Flex",
+			Image:        bios,
+			Expected: core.AmdVmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(false),
+				IsMeasuredBootEnabled:          common.Bool(false),
+				IsTrustedPlatformModuleEnabled: common.Bool(false),
+				IsMemoryEncryptionEnabled:      common.Bool(true),
+			},
+		},
+		{
+			Name:         "confidential Intel",
+			Confidential: true,
+			Shape:        "VM.Standard3.Flex",
+			Image:        uefi,
+			Error:        "shape VM.Standard3.Flex does not support confidential computing",
+		},
+		{
+			Name:     "shielded without platform options",
+			Shielded: true,
+			Shape:    "VM.Standard.A1.Flex",
+			Error:    "shape VM.Standard.A1.Flex does not support shielded instances",
+		},
+		{
+			Name:     "shielded BIOS image",
+			Shielded: true,
+			Shape:    "VM.Standard.E4.Flex",
+			Image:    bios,
+			Error:    "image bios cannot be used: shielded instances need UEFI firmware, not BIOS",
+		},
+		{
+			Name:         "image incompatible with shape",
+			Confidential: true,
+			Shape:        "VM.Standard3.Flex",
+			Image:        bios,
+			Error:        "image bios cannot be used: it cannot run shape VM.Standard3.Flex",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			o := &Oracle{computeClient: &fakeCompute{shapes: shapes, imageShapes: imageShapes}}
+			opts := &options.Options{
+				CompartmentID:         "compartment-id",
+				AvailabilityDomain:    "AD-1",
+				ShieldedInstance:      test.Shielded,
+				ConfidentialComputing: test.Confidential,
+			}
+
+			config, err := o.platformConfig(context.Background(), opts, test.Shape, test.Image)
+
+			if test.Error == "" {
+				assert.NoError(err)
+				assert.Equal(test.Expected, config)
+			} else {
+				assert.EqualError(err, test.Error)
+			}
+		})
+	}
+}
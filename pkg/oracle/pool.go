@@ -0,0 +1,300 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// FillPool launches instances into the warm pool until it holds
+// WARM_POOL_SIZE of them. A pooled instance powers itself off once cloud-init
+// has provisioned it and waits stopped until a workspace claims it.
+func (o *Oracle) FillPool(ctx context.Context, opts *options.Options) ([]core.Instance, error) {
+	key := poolKey(opts)
+
+	pooled, err := o.poolInstances(ctx, opts, key)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := opts.WarmPoolSize - len(pooled)
+	if missing <= 0 {
+		log.Default.Infof("Warm pool %s already holds %d instance(s)", key, len(pooled))
+		return nil, nil
+	}
+
+	request, err := o.buildLaunchRequest(ctx, opts, &core.InstanceSourceViaImageDetails{}, func(provisioned bool, sharedSource string) (string, error) {
+		return renderCloudConfig(poolCloudConfigData(opts, provisioned, sharedSource))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	details := request.LaunchInstanceDetails
+	details.FreeformTags = poolTags(key)
+	vnic := *details.CreateVnicDetails
+	vnic.FreeformTags = poolTags(key)
+	details.CreateVnicDetails = &vnic
+
+	var launched []core.Instance
+	for i := 0; i < missing; i++ {
+		details.DisplayName = common.String(fmt.Sprintf("devpod-pool-%s-%s", key[:8], uuid.NewString()[:8]))
+
+		response, err := o.computeClient.LaunchInstance(ctx, core.LaunchInstanceRequest{LaunchInstanceDetails: details})
+		if err != nil {
+			return launched, o.explainLaunchError(ctx, opts, *details.Shape, err)
+		}
+
+		log.Default.Infof("Launched pooled instance %s", *response.Id)
+		launched = append(launched, response.Instance)
+	}
+
+	if opts.NoWait {
+		return launched, nil
+	}
+
+	for _, instance := range launched {
+		err := o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateStopped, opts.WaitTimeout)
+		if err != nil {
+			return launched, err
+		}
+	}
+
+	return launched, nil
+}
+
+// DrainPool terminates the unclaimed instances of the warm pool
+func (o *Oracle) DrainPool(ctx context.Context, opts *options.Options) (int, error) {
+	pooled, err := o.poolInstances(ctx, opts, poolKey(opts))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, instance := range pooled {
+		log.Default.Infof("Terminating pooled instance %s", *instance.Id)
+
+		_, err := o.computeClient.TerminateInstance(ctx, core.TerminateInstanceRequest{
+			InstanceId:         instance.Id,
+			PreserveBootVolume: common.Bool(false),
+		})
+		if err != nil && !IsNotFound(err) {
+			return 0, err
+		}
+	}
+
+	return len(pooled), nil
+}
+
+// ClaimPoolInstance takes a stopped instance from the warm pool for the
+// machine. It returns nil if the pool is off or has no stopped instances, in
+// which case the caller launches a new one.
+func (o *Oracle) ClaimPoolInstance(ctx context.Context, opts *options.Options, publicKey string) (*core.Instance, error) {
+	if opts.WarmPoolSize == 0 || opts.RestoreFromBackup != "" {
+		return nil, nil
+	}
+
+	pooled, err := o.poolInstances(ctx, opts, poolKey(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range pooled {
+		if candidate.LifecycleState != core.InstanceLifecycleStateStopped {
+			continue
+		}
+
+		instance, err := o.claimInstance(ctx, opts, candidate.Id, publicKey)
+		if err != nil || instance != nil {
+			return instance, err
+		}
+	}
+
+	log.Default.Info("Warm pool has no stopped instances")
+
+	return nil, nil
+}
+
+// claimInstance retags a pooled instance for the machine and leaves the SSH
+// key in its metadata. The update is conditional on the etag, so when two
+// workspaces claim the same instance only one of them gets it and the other
+// gets nil.
+func (o *Oracle) claimInstance(ctx context.Context, opts *options.Options, instanceID *string, publicKey string) (*core.Instance, error) {
+	current, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{InstanceId: instanceID})
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if current.FreeformTags[labelPool] == "" || current.LifecycleState != core.InstanceLifecycleStateStopped {
+		return nil, nil
+	}
+
+	// user_data cannot change after launch, so the rest of the metadata is
+	// sent back as it is
+	metadata := map[string]string{}
+	for k, v := range current.Metadata {
+		metadata[k] = v
+	}
+	metadata[poolClaimKeyMetadata] = strings.TrimSpace(publicKey)
+
+	response, err := o.computeClient.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId: instanceID,
+		IfMatch:    current.Etag,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			DisplayName: common.String(instanceName(opts.MachineID)),
+			FreeformTags: map[string]string{
+				labelMachineID: opts.MachineID,
+				labelType:      labelTypeDevPod,
+			},
+			Metadata: metadata,
+		},
+	})
+	if isPreconditionFailed(err) {
+		log.Default.Debugf("Pooled instance %s was claimed by another workspace", *instanceID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Default.Infof("Claimed instance %s from the warm pool", *instanceID)
+
+	instance := response.Instance
+	vnic, err := o.getPrimaryVnic(ctx, &instance)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = o.networkClient.UpdateVnic(ctx, core.UpdateVnicRequest{
+		VnicId: vnic.Id,
+		UpdateVnicDetails: core.UpdateVnicDetails{
+			FreeformTags: map[string]string{
+				labelMachineID: opts.MachineID,
+				labelType:      labelTypeDevPod,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o.recordInstance(ctx, opts, &instance)
+
+	return &instance, nil
+}
+
+// poolInstances returns the unclaimed live instances of the pool
+func (o *Oracle) poolInstances(ctx context.Context, opts *options.Options, key string) ([]core.Instance, error) {
+	instances, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Instance, *string, error) {
+		response, err := o.computeClient.ListInstances(ctx, core.ListInstancesRequest{
+			CompartmentId:      &opts.CompartmentID,
+			AvailabilityDomain: &opts.AvailabilityDomain,
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pooled []core.Instance
+	for _, instance := range instances {
+		if instance.FreeformTags[labelPool] == key && isLiveInstance(instance.LifecycleState) {
+			pooled = append(pooled, instance)
+		}
+	}
+
+	return pooled, nil
+}
+
+// poolKey identifies the pool that fits the launch options, so that a
+// workspace only claims an instance that it would have launched itself
+func poolKey(opts *options.Options) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		opts.AvailabilityDomain,
+		opts.MachineType,
+		opts.DiskImage,
+		strconv.Itoa(opts.DiskSize),
+		strconv.Itoa(opts.BootVolumeVPUsPerGB),
+		strconv.FormatBool(opts.HomeVolumeSize > 0),
+		opts.DockerData,
+		opts.FSSMountTarget,
+		opts.FSSExportPath,
+		opts.FSSMountPath,
+		opts.CapacityType,
+		opts.CapacityReservationID,
+		opts.DedicatedVMHostID,
+		opts.KMSKeyID,
+		strconv.FormatBool(opts.PvEncryptionInTransit),
+		strconv.FormatBool(opts.ShieldedInstance),
+		strconv.FormatBool(opts.ConfidentialComputing),
+		strconv.FormatBool(opts.LegacyIMDSEndpoints),
+		agentPluginsKey(opts.AgentPlugins),
+	}, "/")))
+
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func agentPluginsKey(plugins []options.AgentPlugin) string {
+	var entries []string
+	for _, p := range plugins {
+		entries = append(entries, fmt.Sprintf("%s=%t", p.Name, p.Enabled))
+	}
+	return strings.Join(entries, ",")
+}
+
+func poolTags(key string) map[string]string {
+	return map[string]string{
+		labelType: labelTypeDevPod,
+		labelPool: key,
+	}
+}
+
+func poolCloudConfigData(opts *options.Options, provisioned bool, sharedSource string) cloudConfigData {
+	data := cloudConfigData{
+		DockerDevice: dockerDataDevice(opts),
+		Provisioned:  provisioned,
+		SharedSource: sharedSource,
+		SharedPath:   opts.FSSMountPath,
+		Pool:         true,
+		ClaimKey:     poolClaimKeyMetadata,
+	}
+	if opts.HomeVolumeSize > 0 {
+		data.HomeDevice = homeVolumeDevice
+	}
+
+	return data
+}
+
+func isPreconditionFailed(err error) bool {
+	var serviceErr common.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.GetHTTPStatusCode() == 412
+	}
+	return false
+}
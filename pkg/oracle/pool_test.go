@@ -0,0 +1,183 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func poolOptions(t *testing.T) *options.Options {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	return &options.Options{
+		MachineID:          "test-machine-id",
+		MachineFolder:      t.TempDir(),
+		CompartmentID:      "compartment-id",
+		AvailabilityDomain: "AD-1",
+		MachineType:        "VM.Standard.E4.Flex",
+		DiskImage:          "image",
+		DiskSize:           50,
+		WarmPoolSize:       2,
+	}
+}
+
+// pooledMachines returns stopped pool instances, each with a VNIC
+func pooledMachines(key string, count int) (*fakeCompute, *fakeNetwork) {
+	compute := &fakeCompute{images: []core.Image{{Id: common.String("image-id"), DisplayName: common.String("image")}}}
+	network := &fakeNetwork{}
+	for i := 1; i <= count; i++ {
+		id := fmt.Sprintf("pooled-%d", i)
+		compute.instances = append(compute.instances, core.Instance{
+			Id:                 common.String(id),
+			AvailabilityDomain: common.String("AD-1"),
+			CompartmentId:      common.String("compartment-id"),
+			DisplayName:        common.String(id),
+			Metadata:           map[string]string{"user_data": "pool-data"},
+			LifecycleState:     core.InstanceLifecycleStateStopped,
+			FreeformTags:       poolTags(key),
+		})
+		compute.vnicAttachments = append(compute.vnicAttachments, core.VnicAttachment{
+			InstanceId:     common.String(id),
+			VnicId:         common.String(id + "-vnic"),
+			LifecycleState: core.VnicAttachmentLifecycleStateAttached,
+		})
+		network.vnics = append(network.vnics, core.Vnic{
+			Id:             common.String(id + "-vnic"),
+			PrivateIp:      common.String(fmt.Sprintf("10.0.0.%d", i)),
+			LifecycleState: core.VnicLifecycleStateAvailable,
+			FreeformTags:   poolTags(key),
+		})
+	}
+	return compute, network
+}
+
+func TestFillPool(t *testing.T) {
+	opts := poolOptions(t)
+	opts.NoWait = true
+	compute, network := pooledMachines(poolKey(opts), 1)
+	o := &Oracle{computeClient: compute, networkClient: network}
+
+	launched, err := o.FillPool(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Len(t, launched, 1)
+
+	details := compute.launches[0]
+	assert.Equal(t, poolTags(poolKey(opts)), details.FreeformTags)
+	assert.Equal(t, poolTags(poolKey(opts)), details.CreateVnicDetails.FreeformTags)
+
+	userData, err := base64.StdEncoding.DecodeString(details.Metadata["user_data"])
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "mode: poweroff")
+	assert.Contains(t, string(userData), "condition: \"! curl -sf -H 'Authorization: Bearer Oracle' "+
+		"http://169.254.169.254/opc/v2/instance/metadata/"+poolClaimKeyMetadata)
+	assert.Contains(t, string(userData), "metadata/"+poolClaimKeyMetadata)
+	assert.NotContains(t, string(userData), "ssh_authorized_keys")
+
+	// The pool is full now
+	launched, err = o.FillPool(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Empty(t, launched)
+	assert.Len(t, compute.launches, 1)
+}
+
+func TestClaimPoolInstance(t *testing.T) {
+	opts := poolOptions(t)
+	compute, network := pooledMachines(poolKey(opts), 1)
+	o := &Oracle{computeClient: compute, networkClient: network}
+
+	instance, err := o.ClaimPoolInstance(context.Background(), opts, "ssh-ed25519 AAAA test\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "pooled-1", *instance.Id)
+
+	claimed := compute.instances[0]
+	assert.Equal(t, instanceName(opts.MachineID), *claimed.DisplayName)
+	assert.Equal(t, map[string]string{labelMachineID: opts.MachineID, labelType: labelTypeDevPod}, claimed.FreeformTags)
+	assert.Equal(t, map[string]string{"user_data": "pool-data", poolClaimKeyMetadata: "ssh-ed25519 AAAA test"}, claimed.Metadata)
+	assert.Equal(t, opts.MachineID, network.vnics[0].FreeformTags[labelMachineID])
+	assert.Equal(t, "pooled-1", loadState(opts.MachineFolder).InstanceID)
+
+	// The claimed instance is the machine's and has left the pool
+	found, err := o.GetInstance(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "pooled-1", *found.Id)
+
+	instance, err = o.ClaimPoolInstance(context.Background(), &options.Options{
+		MachineID: "other-machine-id", CompartmentID: "compartment-id", AvailabilityDomain: "AD-1",
+		MachineType: "VM.Standard.E4.Flex", DiskImage: "image", DiskSize: 50, WarmPoolSize: 2,
+	}, "ssh-ed25519 AAAA other")
+	assert.NoError(t, err)
+	assert.Nil(t, instance)
+}
+
+func TestClaimPoolInstanceRace(t *testing.T) {
+	opts := poolOptions(t)
+	compute, network := pooledMachines(poolKey(opts), 2)
+	o := &Oracle{computeClient: compute, networkClient: network}
+
+	// Another workspace claims the first instance between our read and update
+	compute.beforeUpdate = func(instanceID string) {
+		if instanceID == "pooled-1" && compute.versions[instanceID] == 0 {
+			compute.versions = map[string]int{instanceID: 1}
+		}
+	}
+
+	instance, err := o.ClaimPoolInstance(context.Background(), opts, "ssh-ed25519 AAAA test")
+	assert.NoError(t, err)
+	assert.Equal(t, "pooled-2", *instance.Id)
+	assert.Equal(t, poolTags(poolKey(opts)), compute.instances[0].FreeformTags)
+}
+
+func TestClaimPoolInstanceSkipsOtherPools(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(opts *options.Options)
+	}{
+		{Name: "pool off", Modify: func(opts *options.Options) { opts.WarmPoolSize = 0 }},
+		{Name: "other shape", Modify: func(opts *options.Options) { opts.MachineType = "VM.Standard.A1.Flex" }},
+		{Name: "other disk size", Modify: func(opts *options.Options) { opts.DiskSize = 100 }},
+		{Name: "restore from backup", Modify: func(opts *options.Options) { opts.RestoreFromBackup = "backup-id" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			opts := poolOptions(t)
+			compute, network := pooledMachines(poolKey(opts), 1)
+			o := &Oracle{computeClient: compute, networkClient: network}
+			test.Modify(opts)
+
+			instance, err := o.ClaimPoolInstance(context.Background(), opts, "ssh-ed25519 AAAA test")
+			assert.NoError(t, err)
+			assert.Nil(t, instance)
+			assert.Zero(t, compute.calls["UpdateInstance"])
+		})
+	}
+}
+
+func TestPoolKeyAgentPlugins(t *testing.T) {
+	opts := poolOptions(t)
+	key := poolKey(opts)
+
+	opts.AgentPlugins = []options.AgentPlugin{{Name: "Bastion", Enabled: true}}
+	assert.NotEqual(t, key, poolKey(opts))
+}
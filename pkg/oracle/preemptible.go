@@ -0,0 +1,87 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// preemptibleConfig returns the launch configuration for preemptible
+// capacity, or nil for on-demand. The boot volume is kept on preemption when
+// the machine is to be relaunched from it.
+func preemptibleConfig(opts *options.Options) *core.PreemptibleInstanceConfigDetails {
+	if opts.CapacityType != options.CapacityTypePreemptible {
+		return nil
+	}
+
+	return &core.PreemptibleInstanceConfigDetails{
+		PreemptionAction: core.TerminatePreemptionAction{
+			PreserveBootVolume: common.Bool(opts.PreemptibleRelaunch),
+		},
+	}
+}
+
+// parkPreempted handles an instance that OCI terminated to reclaim
+// preemptible capacity. We remove the machine state whenever we terminate an
+// instance ourselves, so a terminated preemptible instance that is still
+// recorded was preempted. If its boot volume was kept, the machine is parked
+// so that the next start relaunches it.
+func (o *Oracle) parkPreempted(opts *options.Options, state *machineState, instance *core.Instance) bool {
+	if instance.PreemptibleInstanceConfig == nil || !isTerminal(string(instance.LifecycleState)) {
+		return false
+	}
+
+	log.Default.Warnf("Instance %s was preempted by OCI", *instance.Id)
+
+	action, ok := instance.PreemptibleInstanceConfig.PreemptionAction.(core.TerminatePreemptionAction)
+	if !ok || action.PreserveBootVolume == nil || !*action.PreserveBootVolume {
+		return false
+	}
+	if state.BootVolumeID == "" || state.SubnetID == "" {
+		log.Default.Warnf("The boot volume of instance %s is not recorded and cannot be relaunched", *instance.Id)
+		return false
+	}
+
+	parked := &parkedInstance{
+		BootVolumeID:       state.BootVolumeID,
+		AvailabilityDomain: *instance.AvailabilityDomain,
+		Shape:              *instance.Shape,
+		SubnetID:           state.SubnetID,
+		Metadata:           instance.Metadata,
+	}
+	if instance.ShapeConfig != nil {
+		parked.Ocpus = instance.ShapeConfig.Ocpus
+		parked.MemoryInGBs = instance.ShapeConfig.MemoryInGBs
+	}
+
+	state.InstanceID = ""
+	state.VnicID = ""
+	state.IP = ""
+	state.Parked = parked
+	state.Preempted = true
+
+	if err := saveState(opts.MachineFolder, state); err != nil {
+		log.Default.Warnf("Unable to save machine state: %v", err)
+		return false
+	}
+
+	log.Default.Infof("Boot volume %s was kept - start relaunches the instance from it", state.BootVolumeID)
+
+	return true
+}
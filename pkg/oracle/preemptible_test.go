@@ -0,0 +1,206 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/devpod/pkg/client"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreempted(t *testing.T) {
+	machineID := "test-machine-id"
+
+	tests := []struct {
+		Name     string
+		Instance func(i *core.Instance)
+		Status   client.Status
+		Parked   bool
+	}{
+		{
+			Name:   "boot volume kept",
+			Status: client.StatusStopped,
+			Parked: true,
+		},
+		{
+			Name: "boot volume deleted",
+			Instance: func(i *core.Instance) {
+				i.PreemptibleInstanceConfig.PreemptionAction = core.TerminatePreemptionAction{PreserveBootVolume: common.Bool(false)}
+			},
+			Status: client.StatusNotFound,
+		},
+		{
+			Name: "terminated on-demand instance",
+			Instance: func(i *core.Instance) {
+				i.PreemptibleInstanceConfig = nil
+			},
+			Status: client.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+
+			instance := core.Instance{
+				Id:                 common.String("instance-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				CompartmentId:      common.String("compartment-id"),
+				DisplayName:        common.String(instanceName(machineID)),
+				Shape:              common.String("VM.Standard.E4.Flex"),
+				LifecycleState:     core.InstanceLifecycleStateTerminated,
+				FreeformTags:       map[string]string{labelMachineID: machineID},
+				PreemptibleInstanceConfig: &core.PreemptibleInstanceConfigDetails{
+					PreemptionAction: core.TerminatePreemptionAction{PreserveBootVolume: common.Bool(true)},
+				},
+			}
+			if test.Instance != nil {
+				test.Instance(&instance)
+			}
+
+			compute := &fakeCompute{instances: []core.Instance{instance}}
+			blockstorage := &fakeBlockstorage{
+				bootVolumes: []core.BootVolume{
+					{Id: common.String("boot-volume-id"), LifecycleState: core.BootVolumeLifecycleStateAvailable},
+				},
+			}
+			o := &Oracle{computeClient: compute, blockstorageClient: blockstorage}
+
+			opts := &options.Options{
+				MachineID:           machineID,
+				MachineFolder:       t.TempDir(),
+				CompartmentID:       "compartment-id",
+				CapacityType:        options.CapacityTypePreemptible,
+				PreemptibleRelaunch: true,
+			}
+			assert.NoError(saveState(opts.MachineFolder, &machineState{
+				InstanceID:   "instance-id",
+				BootVolumeID: "boot-volume-id",
+				SubnetID:     "subnet-id",
+			}))
+
+			status, err := o.GetInstanceStatus(ctx, opts)
+			assert.NoError(err)
+			assert.Equal(test.Status, status)
+
+			if !test.Parked {
+				assert.Nil(loadState(opts.MachineFolder))
+				return
+			}
+
+			assert.True(loadState(opts.MachineFolder).Preempted)
+
+			// Start relaunches from the kept boot volume, still preemptible
+			assert.NoError(o.StartInstance(ctx, opts))
+
+			if assert.Len(compute.launches, 1) {
+				launch := compute.launches[0]
+				assert.Equal("boot-volume-id", *launch.SourceDetails.(core.InstanceSourceViaBootVolumeDetails).BootVolumeId)
+				assert.Equal("subnet-id", *launch.CreateVnicDetails.SubnetId)
+				assert.NotNil(launch.PreemptibleInstanceConfig)
+			}
+		})
+	}
+}
+
+func TestPreemptibleConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(preemptibleConfig(&options.Options{CapacityType: options.CapacityTypeOnDemand}))
+
+	config := preemptibleConfig(&options.Options{CapacityType: options.CapacityTypePreemptible, PreemptibleRelaunch: false})
+	assert.False(*config.PreemptionAction.(core.TerminatePreemptionAction).PreserveBootVolume)
+}
+
+func TestPreemptedAfterLaunch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	machineID := "test-machine-id"
+
+	compute := &fakeCompute{}
+	network := &fakeNetwork{
+		vnics: []core.Vnic{
+			{
+				Id:             common.String("vnic-id"),
+				SubnetId:       common.String("subnet-id"),
+				PrivateIp:      common.String("10.0.0.2"),
+				LifecycleState: core.VnicLifecycleStateAvailable,
+			},
+		},
+	}
+	blockstorage := &fakeBlockstorage{
+		bootVolumes: []core.BootVolume{
+			{Id: common.String("boot-volume-id"), LifecycleState: core.BootVolumeLifecycleStateAvailable},
+		},
+	}
+	o := &Oracle{computeClient: compute, networkClient: network, blockstorageClient: blockstorage}
+
+	opts := &options.Options{
+		MachineID:           machineID,
+		MachineFolder:       t.TempDir(),
+		CompartmentID:       "compartment-id",
+		CapacityType:        options.CapacityTypePreemptible,
+		PreemptibleRelaunch: true,
+	}
+
+	instance, err := o.LaunchInstance(ctx, opts, &core.LaunchInstanceRequest{
+		LaunchInstanceDetails: core.LaunchInstanceDetails{
+			AvailabilityDomain: common.String("AD-1"),
+			CompartmentId:      common.String("compartment-id"),
+			DisplayName:        common.String(instanceName(machineID)),
+			Shape:              common.String("VM.Standard.E4.Flex"),
+			FreeformTags:       map[string]string{labelMachineID: machineID},
+			PreemptibleInstanceConfig: &core.PreemptibleInstanceConfigDetails{
+				PreemptionAction: core.TerminatePreemptionAction{PreserveBootVolume: common.Bool(true)},
+			},
+		},
+	})
+	assert.NoError(err)
+
+	// Nothing is attached yet when the launch is recorded
+	assert.Empty(loadState(opts.MachineFolder).BootVolumeID)
+
+	compute.vnicAttachments = []core.VnicAttachment{
+		{InstanceId: instance.Id, VnicId: common.String("vnic-id"), LifecycleState: core.VnicAttachmentLifecycleStateAttached},
+	}
+	compute.bootAttachments = []core.BootVolumeAttachment{
+		{InstanceId: instance.Id, BootVolumeId: common.String("boot-volume-id"), LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached},
+	}
+
+	status, err := o.GetInstanceStatus(ctx, opts)
+	assert.NoError(err)
+	assert.Equal(client.StatusRunning, status)
+
+	compute.instances[0].LifecycleState = core.InstanceLifecycleStateTerminated
+
+	status, err = o.GetInstanceStatus(ctx, opts)
+	assert.NoError(err)
+	assert.Equal(client.StatusStopped, status)
+	assert.True(loadState(opts.MachineFolder).Preempted)
+
+	assert.NoError(o.StartInstance(ctx, opts))
+	if assert.Len(compute.launches, 2) {
+		launch := compute.launches[1]
+		assert.Equal("boot-volume-id", *launch.SourceDetails.(core.InstanceSourceViaBootVolumeDetails).BootVolumeId)
+		assert.Equal("subnet-id", *launch.CreateVnicDetails.SubnetId)
+	}
+}
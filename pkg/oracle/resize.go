@@ -0,0 +1,309 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// ShapePricesAsOf is when shapePrices were taken from the OCI price list
+const ShapePricesAsOf = "June 2024"
+
+// shapePrices are the pay-as-you-go list prices of the flexible shapes in USD
+// per hour, per OCPU and per GB of memory, as of ShapePricesAsOf. They are an
+// estimate that ignores discounts and price changes since, and other shapes
+// have no known cost.
+var shapePrices = map[string]struct{ ocpu, memory float64 }{
+	"VM.Standard.A1.Flex": {ocpu: 0.01, memory: 0.0015},
+	"VM.Standard.E3.Flex": {ocpu: 0.025, memory: 0.0015},
+	"VM.Standard.E4.Flex": {ocpu: 0.025, memory: 0.0015},
+	"VM.Standard.E5.Flex": {ocpu: 0.03, memory: 0.002},
+	"VM.Standard3.Flex":   {ocpu: 0.04, memory: 0.0015},
+	"VM.Optimized3.Flex":  {ocpu: 0.054, memory: 0.0015},
+}
+
+// Size is the shape of an instance with its OCPUs and memory
+type Size struct {
+	Shape       string
+	Ocpus       float32
+	MemoryInGBs float32
+}
+
+// Resize is the size of an instance before and after a resize
+type Resize struct {
+	Before Size
+	After  Size
+}
+
+// ResizeInstance changes the shape, OCPUs or memory of the instance. Zero
+// values keep what the instance has. OCPUs and memory of a running instance
+// are changed live where OCI allows it; otherwise, and for a shape change,
+// the instance is stopped gracefully, updated and started again. A stopped
+// instance stays stopped and a parked one is launched with the new size.
+func (o *Oracle) ResizeInstance(ctx context.Context, opts *options.Options, target Size) (*Resize, error) {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		if parked := parkedState(opts); IsNotFound(err) && parked != nil {
+			return o.resizeParked(ctx, opts, parked, target)
+		}
+		return nil, err
+	}
+
+	before := instanceSize(instance)
+	after, shape, err := o.resolveSize(ctx, opts, instance.ImageId, before, target)
+	if err != nil {
+		return nil, err
+	}
+
+	resize := &Resize{Before: before, After: after}
+	if after == before {
+		log.Default.Infof("Instance is already %s", after)
+		return resize, nil
+	}
+
+	details := core.UpdateInstanceDetails{}
+	if after.Shape != before.Shape {
+		details.Shape = &after.Shape
+	}
+	if isFlexible(shape) {
+		details.ShapeConfig = &core.UpdateInstanceShapeConfigDetails{
+			Ocpus:       common.Float32(after.Ocpus),
+			MemoryInGBs: common.Float32(after.MemoryInGBs),
+		}
+	}
+
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning {
+		log.Default.Infof("Resizing instance to %s", after)
+		return resize, o.updateInstance(ctx, instance.Id, details)
+	}
+
+	if after.Shape == before.Shape {
+		log.Default.Infof("Resizing running instance to %s", after)
+
+		details.UpdateOperationConstraint = core.UpdateInstanceDetailsUpdateOperationConstraintAvoidDowntime
+		err := o.updateInstance(ctx, instance.Id, details)
+		if !needsDowntime(err) {
+			return resize, err
+		}
+		details.UpdateOperationConstraint = ""
+
+		log.Default.Info("The instance cannot be resized live - restarting it")
+	}
+
+	return resize, o.resizeStopped(ctx, opts, instance, details)
+}
+
+// resizeStopped stops the instance, applies the update and starts it again.
+// The instance is started at its old size if the update fails.
+func (o *Oracle) resizeStopped(
+	ctx context.Context, opts *options.Options, instance *core.Instance, details core.UpdateInstanceDetails,
+) error {
+	wait := *opts
+	wait.NoWait = false
+	if err := o.shutdown(ctx, &wait, instance); err != nil {
+		return err
+	}
+
+	if err := o.updateInstance(ctx, instance.Id, details); err != nil {
+		if startErr := o.StartInstance(ctx, opts); startErr != nil {
+			log.Default.Errorf("Unable to start instance %s again: %v", *instance.Id, startErr)
+		}
+		return err
+	}
+
+	return o.StartInstance(ctx, opts)
+}
+
+// resizeParked records the new size for the next launch of a parked instance
+func (o *Oracle) resizeParked(ctx context.Context, opts *options.Options, parked *parkedInstance, target Size) (*Resize, error) {
+	before := Size{Shape: parked.Shape}
+	if parked.Ocpus != nil && parked.MemoryInGBs != nil {
+		before.Ocpus, before.MemoryInGBs = *parked.Ocpus, *parked.MemoryInGBs
+	}
+
+	after, shape, err := o.resolveSize(ctx, opts, nil, before, target)
+	if err != nil {
+		return nil, err
+	}
+
+	state := loadState(opts.MachineFolder)
+	state.Parked.Shape = after.Shape
+	state.Parked.Ocpus, state.Parked.MemoryInGBs = nil, nil
+	if isFlexible(shape) {
+		state.Parked.Ocpus, state.Parked.MemoryInGBs = common.Float32(after.Ocpus), common.Float32(after.MemoryInGBs)
+	}
+	if err := saveState(opts.MachineFolder, state); err != nil {
+		return nil, err
+	}
+
+	log.Default.Infof("Instance will be launched as %s on the next start", after)
+
+	return &Resize{Before: before, After: after}, nil
+}
+
+func (o *Oracle) updateInstance(ctx context.Context, instanceID *string, details core.UpdateInstanceDetails) error {
+	_, err := o.computeClient.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId:            instanceID,
+		UpdateInstanceDetails: details,
+	})
+	return err
+}
+
+// resolveSize fills in the target size from the current one and checks it
+// against the shapes available in the availability domain. With an image,
+// only the shapes compatible with it are available.
+func (o *Oracle) resolveSize(
+	ctx context.Context, opts *options.Options, imageID *string, current, target Size,
+) (Size, *core.Shape, error) {
+	shapes, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Shape, *string, error) {
+		response, err := o.computeClient.ListShapes(ctx, core.ListShapesRequest{
+			CompartmentId:      &opts.CompartmentID,
+			AvailabilityDomain: &opts.AvailabilityDomain,
+			ImageId:            imageID,
+			Page:               page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return Size{}, nil, err
+	}
+
+	size := current
+	if target.Shape != "" {
+		size.Shape = target.Shape
+	}
+
+	shape := findShape(shapes, size.Shape)
+	if shape == nil {
+		return Size{}, nil, ErrResizeInvalid(size.Shape, "the shape is not available in "+opts.AvailabilityDomain)
+	}
+
+	if size.Shape != current.Shape {
+		if from := findShape(shapes, current.Shape); from != nil && len(from.ResizeCompatibleShapes) > 0 &&
+			!contains(from.ResizeCompatibleShapes, size.Shape) {
+			return Size{}, nil, ErrResizeInvalid(size.Shape, "instances cannot be resized to it from "+current.Shape)
+		}
+	}
+
+	if !isFlexible(shape) {
+		// A fixed shape comes with its OCPUs and memory
+		if target.Ocpus != 0 || target.MemoryInGBs != 0 {
+			return Size{}, nil, ErrResizeInvalid(size.Shape, "OCPUs and memory can only be set for flexible shapes")
+		}
+		size.Ocpus, size.MemoryInGBs = 0, 0
+		if shape.Ocpus != nil && shape.MemoryInGBs != nil {
+			size.Ocpus, size.MemoryInGBs = *shape.Ocpus, *shape.MemoryInGBs
+		}
+		return size, shape, nil
+	}
+
+	if target.Ocpus != 0 {
+		size.Ocpus = target.Ocpus
+	}
+	if target.MemoryInGBs != 0 {
+		size.MemoryInGBs = target.MemoryInGBs
+	}
+
+	return size, shape, validateFlexibleSize(shape, size)
+}
+
+// validateFlexibleSize checks OCPUs and memory against the limits of a
+// flexible shape
+func validateFlexibleSize(shape *core.Shape, size Size) error {
+	ocpu, memory := shape.OcpuOptions, shape.MemoryOptions
+
+	if size.Ocpus == 0 || size.MemoryInGBs == 0 {
+		return ErrResizeInvalid(size.Shape, "set both OCPUs and memory for a flexible shape")
+	}
+	if outside(size.Ocpus, ocpu.Min, ocpu.Max) {
+		return ErrResizeInvalid(size.Shape, fmt.Sprintf("OCPUs must be between %g and %g", *ocpu.Min, *ocpu.Max))
+	}
+	if outside(size.MemoryInGBs, memory.MinInGBs, memory.MaxInGBs) {
+		return ErrResizeInvalid(size.Shape, fmt.Sprintf("memory must be between %g and %g GB", *memory.MinInGBs, *memory.MaxInGBs))
+	}
+	if outside(size.MemoryInGBs/size.Ocpus, memory.MinPerOcpuInGBs, memory.MaxPerOcpuInGBs) {
+		return ErrResizeInvalid(size.Shape,
+			fmt.Sprintf("memory must be between %g and %g GB per OCPU", *memory.MinPerOcpuInGBs, *memory.MaxPerOcpuInGBs))
+	}
+
+	return nil
+}
+
+func outside(value float32, min, max *float32) bool {
+	return (min != nil && value < *min) || (max != nil && value > *max)
+}
+
+func isFlexible(shape *core.Shape) bool {
+	return shape.OcpuOptions != nil && shape.MemoryOptions != nil
+}
+
+func findShape(shapes []core.Shape, name string) *core.Shape {
+	for i := range shapes {
+		if shapes[i].Shape != nil && *shapes[i].Shape == name {
+			return &shapes[i]
+		}
+	}
+	return nil
+}
+
+func instanceSize(instance *core.Instance) Size {
+	size := Size{Shape: *instance.Shape}
+	if instance.ShapeConfig != nil && instance.ShapeConfig.Ocpus != nil && instance.ShapeConfig.MemoryInGBs != nil {
+		size.Ocpus, size.MemoryInGBs = *instance.ShapeConfig.Ocpus, *instance.ShapeConfig.MemoryInGBs
+	}
+	return size
+}
+
+// needsDowntime returns true if OCI refused to resize a running instance
+// without rebooting it, which it reports as a 409 IncorrectState. Other
+// refusals, such as a lack of host capacity, are not helped by a reboot.
+func needsDowntime(err error) bool {
+	var serviceErr common.ServiceError
+	if !errors.As(err, &serviceErr) {
+		return false
+	}
+	return serviceErr.GetHTTPStatusCode() == 409 && serviceErr.GetCode() == "IncorrectState"
+}
+
+// HourlyCost estimates the pay-as-you-go cost of the size in USD per hour. It
+// returns false for shapes without a known price.
+func (s Size) HourlyCost() (float64, bool) {
+	price, ok := shapePrices[s.Shape]
+	if !ok {
+		return 0, false
+	}
+	return price.ocpu*float64(s.Ocpus) + price.memory*float64(s.MemoryInGBs), true
+}
+
+// MonthlyCost estimates the pay-as-you-go cost of the size in USD per month
+func (s Size) MonthlyCost() (float64, bool) {
+	hourly, ok := s.HourlyCost()
+	return hourly * hoursPerMonth, ok
+}
+
+func (s Size) String() string {
+	if s.Ocpus == 0 {
+		return s.Shape
+	}
+	return fmt.Sprintf("%s with %g OCPUs and %g GB", s.Shape, s.Ocpus, s.MemoryInGBs)
+}
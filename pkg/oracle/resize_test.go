@@ -0,0 +1,235 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func resizeShapes() []core.Shape {
+	return []core.Shape{
+		{
+			Shape:       common.String("VM.Standard.E4.Flex"),
+			OcpuOptions: &core.ShapeOcpuOptions{Min: common.Float32(1), Max: common.Float32(64)},
+			MemoryOptions: &core.ShapeMemoryOptions{
+				MinInGBs:        common.Float32(1),
+				MaxInGBs:        common.Float32(1024),
+				MinPerOcpuInGBs: common.Float32(1),
+				MaxPerOcpuInGBs: common.Float32(64),
+			},
+			ResizeCompatibleShapes: []string{"VM.Standard.E5.Flex", "VM.Standard2.1"},
+		},
+		{
+			Shape:       common.String("VM.Standard.E5.Flex"),
+			OcpuOptions: &core.ShapeOcpuOptions{Min: common.Float32(1), Max: common.Float32(94)},
+			MemoryOptions: &core.ShapeMemoryOptions{
+				MinInGBs:        common.Float32(1),
+				MaxInGBs:        common.Float32(1049),
+				MinPerOcpuInGBs: common.Float32(1),
+				MaxPerOcpuInGBs: common.Float32(64),
+			},
+		},
+		{Shape: common.String("VM.Standard2.1"), Ocpus: common.Float32(1), MemoryInGBs: common.Float32(15)},
+		{Shape: common.String("VM.Standard.A1.Flex"), OcpuOptions: &core.ShapeOcpuOptions{}, MemoryOptions: &core.ShapeMemoryOptions{}},
+	}
+}
+
+func TestResizeInstance(t *testing.T) {
+	tests := []struct {
+		Name             string
+		State            core.InstanceLifecycleStateEnum
+		RejectLiveResize bool
+		Target           Size
+		Expected         Size
+		Actions          []core.InstanceActionActionEnum
+		Constraint       core.UpdateInstanceDetailsUpdateOperationConstraintEnum
+	}{
+		{
+			Name:     "stopped instance stays stopped",
+			State:    core.InstanceLifecycleStateStopped,
+			Target:   Size{Ocpus: 4},
+			Expected: Size{Shape: "VM.Standard.E4.Flex", Ocpus: 4, MemoryInGBs: 16},
+		},
+		{
+			Name:       "running instance is resized live",
+			State:      core.InstanceLifecycleStateRunning,
+			Target:     Size{Ocpus: 4, MemoryInGBs: 32},
+			Expected:   Size{Shape: "VM.Standard.E4.Flex", Ocpus: 4, MemoryInGBs: 32},
+			Constraint: core.UpdateInstanceDetailsUpdateOperationConstraintAvoidDowntime,
+		},
+		{
+			Name:             "running instance is restarted if it cannot be resized live",
+			State:            core.InstanceLifecycleStateRunning,
+			RejectLiveResize: true,
+			Target:           Size{MemoryInGBs: 8},
+			Expected:         Size{Shape: "VM.Standard.E4.Flex", Ocpus: 2, MemoryInGBs: 8},
+			Actions:          []core.InstanceActionActionEnum{core.InstanceActionActionStop, core.InstanceActionActionStart},
+		},
+		{
+			Name:     "running instance is restarted for a shape change",
+			State:    core.InstanceLifecycleStateRunning,
+			Target:   Size{Shape: "VM.Standard.E5.Flex"},
+			Expected: Size{Shape: "VM.Standard.E5.Flex", Ocpus: 2, MemoryInGBs: 16},
+			Actions:  []core.InstanceActionActionEnum{core.InstanceActionActionStop, core.InstanceActionActionStart},
+		},
+		{
+			Name:     "fixed shape",
+			State:    core.InstanceLifecycleStateStopped,
+			Target:   Size{Shape: "VM.Standard2.1"},
+			Expected: Size{Shape: "VM.Standard2.1", Ocpus: 1, MemoryInGBs: 15},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			m := newFakeMachine(t, test.State)
+			m.compute.shapes = resizeShapes()
+			m.compute.rejectLiveResize = test.RejectLiveResize
+
+			resize, err := m.ResizeInstance(context.Background(), m.opts, test.Target)
+			assert.NoError(t, err)
+
+			assert.Equal(t, Size{Shape: "VM.Standard.E4.Flex", Ocpus: 2, MemoryInGBs: 16}, resize.Before)
+			assert.Equal(t, test.Expected, resize.After)
+			assert.Equal(t, test.Expected, instanceSize(&m.compute.instances[0]))
+			assert.Equal(t, test.State, m.compute.instances[0].LifecycleState)
+			assert.Equal(t, test.Actions, m.compute.actions)
+			assert.Equal(t, test.Constraint, m.compute.updates[len(m.compute.updates)-1].UpdateOperationConstraint)
+		})
+	}
+}
+
+func TestResizeInstanceFails(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Target   Size
+		Actions  []core.InstanceActionActionEnum
+		Expected string
+	}{
+		{
+			Name:     "live resize without capacity is not retried with a restart",
+			Target:   Size{Ocpus: 4},
+			Expected: "service error 500: InternalError",
+		},
+		{
+			Name:     "instance is started again if the stopped resize fails",
+			Target:   Size{Shape: "VM.Standard.E5.Flex"},
+			Actions:  []core.InstanceActionActionEnum{core.InstanceActionActionStop, core.InstanceActionActionStart},
+			Expected: "service error 500: InternalError",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+			m.compute.shapes = resizeShapes()
+			m.compute.updateErr = fakeServiceError{status: 500, code: "InternalError", message: "Out of host capacity."}
+
+			_, err := m.ResizeInstance(context.Background(), m.opts, test.Target)
+
+			assert.ErrorContains(t, err, test.Expected)
+			assert.Equal(t, test.Actions, m.compute.actions)
+			assert.Equal(t, core.InstanceLifecycleStateRunning, m.compute.instances[0].LifecycleState)
+		})
+	}
+}
+
+func TestNeedsDowntime(t *testing.T) {
+	assert.True(t, needsDowntime(fakeServiceError{status: 409, code: "IncorrectState"}))
+	assert.False(t, needsDowntime(fakeServiceError{status: 409, code: "Conflict"}))
+	assert.False(t, needsDowntime(fakeServiceError{status: 500, code: "InternalError", message: "Out of host capacity."}))
+	assert.False(t, needsDowntime(nil))
+}
+
+func TestResizeInstanceInvalid(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Target   Size
+		Expected string
+	}{
+		{
+			Name:     "unknown shape",
+			Target:   Size{Shape: "VM.Unknown"},
+			Expected: "cannot resize to VM.Unknown: the shape is not available in AD-1",
+		},
+		{
+			Name:     "incompatible shape",
+			Target:   Size{Shape: "VM.Standard.A1.Flex"},
+			Expected: "cannot resize to VM.Standard.A1.Flex: instances cannot be resized to it from VM.Standard.E4.Flex",
+		},
+		{
+			Name:     "too many OCPUs",
+			Target:   Size{Ocpus: 128},
+			Expected: "cannot resize to VM.Standard.E4.Flex: OCPUs must be between 1 and 64",
+		},
+		{
+			Name:     "too much memory per OCPU",
+			Target:   Size{MemoryInGBs: 256},
+			Expected: "cannot resize to VM.Standard.E4.Flex: memory must be between 1 and 64 GB per OCPU",
+		},
+		{
+			Name:     "OCPUs of a fixed shape",
+			Target:   Size{Shape: "VM.Standard2.1", Ocpus: 2},
+			Expected: "cannot resize to VM.Standard2.1: OCPUs and memory can only be set for flexible shapes",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+			m.compute.shapes = resizeShapes()
+
+			_, err := m.ResizeInstance(context.Background(), m.opts, test.Target)
+
+			assert.EqualError(t, err, test.Expected)
+			assert.Empty(t, m.compute.updates)
+		})
+	}
+}
+
+func TestResizeParkedInstance(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+	m.compute.shapes = resizeShapes()
+
+	resize, err := m.ResizeInstance(context.Background(), m.opts, Size{Ocpus: 4, MemoryInGBs: 64})
+	assert.NoError(t, err)
+	assert.Equal(t, Size{Shape: "VM.Standard.E4.Flex", Ocpus: 2, MemoryInGBs: 16}, resize.Before)
+
+	parked := loadState(m.opts.MachineFolder).Parked
+	assert.Equal(t, "VM.Standard.E4.Flex", parked.Shape)
+	assert.Equal(t, float32(4), *parked.Ocpus)
+	assert.Equal(t, float32(64), *parked.MemoryInGBs)
+	assert.Empty(t, m.compute.updates)
+}
+
+func TestSizeCost(t *testing.T) {
+	hourly, ok := Size{Shape: "VM.Standard.E4.Flex", Ocpus: 2, MemoryInGBs: 16}.HourlyCost()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.074, hourly, 1e-9)
+
+	monthly, ok := Size{Shape: "VM.Standard.E4.Flex", Ocpus: 2, MemoryInGBs: 16}.MonthlyCost()
+	assert.True(t, ok)
+	assert.InDelta(t, 55.056, monthly, 1e-9)
+
+	_, ok = Size{Shape: "VM.Standard2.1", Ocpus: 1, MemoryInGBs: 15}.HourlyCost()
+	assert.False(t, ok)
+}
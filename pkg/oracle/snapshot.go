@@ -0,0 +1,468 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is a named checkpoint of a machine: a backup of its boot volume
+// and, if it has one, of its home volume. Both backups carry the machine and
+// snapshot tags, which is how they are found again.
+type Snapshot struct {
+	Name               string
+	Created            time.Time
+	State              string
+	BootVolumeBackupID string
+	HomeVolumeBackupID string
+}
+
+// CreateSnapshot backs up the boot and home volumes of the machine. The
+// backups are crash consistent, so the instance can keep running.
+func (o *Oracle) CreateSnapshot(ctx context.Context, opts *options.Options, name string) (*Snapshot, error) {
+	if name == "" {
+		name = time.Now().UTC().Format("20060102-150405")
+	}
+
+	existing, err := o.ListSnapshots(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range existing {
+		if s.Name == name {
+			return nil, ErrSnapshotExists(name)
+		}
+	}
+
+	bootVolumeID, err := o.machineBootVolumeID(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Default.Infof("Backing up boot volume %s as snapshot %s", bootVolumeID, name)
+
+	// The token replays the backup of a snapshot that was deleted and created
+	// again under the same name, so a terminated backup is created anew
+	bootBackup, err := createWithRetryToken(retryToken("snapshot", opts.MachineID, name, "boot"),
+		func(token *string) (core.BootVolumeBackup, error) {
+			response, err := o.blockstorageClient.CreateBootVolumeBackup(ctx, core.CreateBootVolumeBackupRequest{
+				CreateBootVolumeBackupDetails: core.CreateBootVolumeBackupDetails{
+					BootVolumeId: &bootVolumeID,
+					DisplayName:  common.String(snapshotBackupName(opts.MachineID, name, "boot")),
+					Type:         core.CreateBootVolumeBackupDetailsTypeIncremental,
+					KmsKeyId:     optionalString(opts.KMSKeyID),
+					FreeformTags: snapshotTags(opts.MachineID, name, ""),
+				},
+				OpcRetryToken: token,
+			})
+			return response.BootVolumeBackup, err
+		},
+		func(b core.BootVolumeBackup) bool { return isTerminal(string(b.LifecycleState)) },
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "back up boot volume")
+	}
+
+	snapshot := &Snapshot{
+		Name:               name,
+		State:              string(bootBackup.LifecycleState),
+		BootVolumeBackupID: *bootBackup.Id,
+	}
+	if bootBackup.TimeCreated != nil {
+		snapshot.Created = bootBackup.TimeCreated.Time
+	}
+
+	home, err := o.homeVolume(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if home != nil {
+		log.Default.Infof("Backing up home volume %s", *home.Id)
+
+		homeBackup, err := createWithRetryToken(retryToken("snapshot", opts.MachineID, name, labelVolumeHome),
+			func(token *string) (core.VolumeBackup, error) {
+				response, err := o.blockstorageClient.CreateVolumeBackup(ctx, core.CreateVolumeBackupRequest{
+					CreateVolumeBackupDetails: core.CreateVolumeBackupDetails{
+						VolumeId:     home.Id,
+						DisplayName:  common.String(snapshotBackupName(opts.MachineID, name, labelVolumeHome)),
+						Type:         core.CreateVolumeBackupDetailsTypeIncremental,
+						KmsKeyId:     optionalString(opts.KMSKeyID),
+						FreeformTags: snapshotTags(opts.MachineID, name, labelVolumeHome),
+					},
+					OpcRetryToken: token,
+				})
+				return response.VolumeBackup, err
+			},
+			func(b core.VolumeBackup) bool { return isTerminal(string(b.LifecycleState)) },
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "back up home volume")
+		}
+		snapshot.HomeVolumeBackupID = *homeBackup.Id
+	}
+
+	if opts.NoWait {
+		return snapshot, nil
+	}
+
+	if err := o.waitForSnapshot(ctx, opts, snapshot); err != nil {
+		return nil, err
+	}
+	snapshot.State = string(core.BootVolumeBackupLifecycleStateAvailable)
+
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of the machine, oldest first
+func (o *Oracle) ListSnapshots(ctx context.Context, opts *options.Options) ([]Snapshot, error) {
+	bootBackups, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.BootVolumeBackup, *string, error) {
+		response, err := o.blockstorageClient.ListBootVolumeBackups(ctx, core.ListBootVolumeBackupsRequest{
+			CompartmentId: &opts.CompartmentID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list boot volume backups")
+	}
+
+	homeBackups, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.VolumeBackup, *string, error) {
+		response, err := o.blockstorageClient.ListVolumeBackups(ctx, core.ListVolumeBackupsRequest{
+			CompartmentId: &opts.CompartmentID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list volume backups")
+	}
+
+	homeByName := map[string]string{}
+	for _, b := range homeBackups {
+		if isSnapshotBackup(b.FreeformTags, opts.MachineID) && !isTerminal(string(b.LifecycleState)) {
+			homeByName[b.FreeformTags[labelSnapshot]] = *b.Id
+		}
+	}
+
+	var snapshots []Snapshot
+	for _, b := range bootBackups {
+		if !isSnapshotBackup(b.FreeformTags, opts.MachineID) || isTerminal(string(b.LifecycleState)) {
+			continue
+		}
+
+		name := b.FreeformTags[labelSnapshot]
+		snapshot := Snapshot{
+			Name:               name,
+			State:              string(b.LifecycleState),
+			BootVolumeBackupID: *b.Id,
+			HomeVolumeBackupID: homeByName[name],
+		}
+		if b.TimeCreated != nil {
+			snapshot.Created = b.TimeCreated.Time
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// DeleteSnapshot deletes the boot and home volume backups of a snapshot
+func (o *Oracle) DeleteSnapshot(ctx context.Context, opts *options.Options, name string) error {
+	snapshot, err := o.findSnapshot(ctx, opts, name)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Infof("Deleting boot volume backup %s", snapshot.BootVolumeBackupID)
+
+	_, err = o.blockstorageClient.DeleteBootVolumeBackup(ctx, core.DeleteBootVolumeBackupRequest{
+		BootVolumeBackupId: &snapshot.BootVolumeBackupID,
+	})
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrap(err, "delete boot volume backup")
+	}
+
+	if snapshot.HomeVolumeBackupID == "" {
+		return nil
+	}
+
+	log.Default.Infof("Deleting home volume backup %s", snapshot.HomeVolumeBackupID)
+
+	_, err = o.blockstorageClient.DeleteVolumeBackup(ctx, core.DeleteVolumeBackupRequest{
+		VolumeBackupId: &snapshot.HomeVolumeBackupID,
+	})
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrap(err, "delete home volume backup")
+	}
+
+	return nil
+}
+
+// RestoreSnapshot replaces the boot and home volumes of the machine with new
+// ones restored from a snapshot. The instance is terminated, keeping its boot
+// volume until the restored one is ready, and launched again from the
+// restored volume, so the workspace is running afterwards.
+func (o *Oracle) RestoreSnapshot(ctx context.Context, opts *options.Options, name string) error {
+	snapshot, err := o.findSnapshot(ctx, opts, name)
+	if err != nil {
+		return err
+	}
+	if snapshot.State != string(core.BootVolumeBackupLifecycleStateAvailable) {
+		return ErrSnapshotNotAvailable(name, snapshot.State)
+	}
+
+	// Restoring needs the instance gone, so always wait for it
+	restoreOpts := *opts
+	restoreOpts.NoWait = false
+
+	instance, err := o.GetInstance(ctx, &restoreOpts)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	if instance != nil {
+		if err := o.parkInstance(ctx, &restoreOpts, instance); err != nil {
+			return errors.Wrap(err, "terminate instance")
+		}
+	}
+
+	state := loadState(opts.MachineFolder)
+	if state == nil || state.Parked == nil {
+		return MissingServer()
+	}
+	parked := state.Parked
+	oldBootVolumeID := parked.BootVolumeID
+
+	token := retryToken("restore", opts.MachineID, snapshot.BootVolumeBackupID, oldBootVolumeID)
+	bootVolume, err := o.restoreBootVolume(ctx, &restoreOpts, snapshot.BootVolumeBackupID, parked.AvailabilityDomain, token)
+	if err != nil {
+		return err
+	}
+
+	parked.BootVolumeID = *bootVolume.Id
+	state.BootVolumeID = *bootVolume.Id
+	if err := saveState(opts.MachineFolder, state); err != nil {
+		return errors.Wrap(err, "save machine state")
+	}
+
+	if oldBootVolumeID != *bootVolume.Id {
+		log.Default.Infof("Deleting replaced boot volume %s", oldBootVolumeID)
+		_, err := o.blockstorageClient.DeleteBootVolume(ctx, core.DeleteBootVolumeRequest{BootVolumeId: &oldBootVolumeID})
+		if err != nil && !IsNotFound(err) {
+			log.Default.Warnf("Unable to delete replaced boot volume %s: %v", oldBootVolumeID, err)
+		}
+	}
+
+	if snapshot.HomeVolumeBackupID != "" && opts.HomeVolumeSize > 0 {
+		if err := o.restoreHomeVolume(ctx, &restoreOpts, snapshot); err != nil {
+			return err
+		}
+	}
+
+	return o.unparkInstance(ctx, opts, parked)
+}
+
+// restoreBootVolume creates a boot volume from a backup and waits for it to
+// become available
+func (o *Oracle) restoreBootVolume(
+	ctx context.Context, opts *options.Options, backupID, availabilityDomain, token string,
+) (*core.BootVolume, error) {
+	log.Default.Infof("Restoring boot volume from backup %s", backupID)
+
+	response, err := o.blockstorageClient.CreateBootVolume(ctx, core.CreateBootVolumeRequest{
+		CreateBootVolumeDetails: core.CreateBootVolumeDetails{
+			CompartmentId:      &opts.CompartmentID,
+			AvailabilityDomain: &availabilityDomain,
+			DisplayName:        common.String(instanceName(opts.MachineID) + " (Boot Volume)"),
+			SourceDetails:      core.BootVolumeSourceFromBootVolumeBackupDetails{Id: &backupID},
+			KmsKeyId:           optionalString(opts.KMSKeyID),
+			VpusPerGB:          common.Int64(int64(opts.BootVolumeVPUsPerGB)),
+			FreeformTags: map[string]string{
+				labelMachineID: opts.MachineID,
+				labelType:      labelTypeDevPod,
+			},
+		},
+		OpcRetryToken: &token,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "restore boot volume")
+	}
+
+	err = o.waitForAvailable(ctx, opts, "boot volume", func(ctx context.Context) (string, error) {
+		response, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{BootVolumeId: response.Id})
+		return string(response.LifecycleState), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.BootVolume, nil
+}
+
+// restoreHomeVolume replaces the home volume with one restored from the
+// snapshot. The old volume has to go first, as the home volume is found by
+// name.
+func (o *Oracle) restoreHomeVolume(ctx context.Context, opts *options.Options, snapshot *Snapshot) error {
+	if err := o.deleteVolume(ctx, opts, labelVolumeHome); err != nil {
+		return err
+	}
+
+	volume, err := o.createHomeVolumeFromBackup(ctx, opts, snapshot.HomeVolumeBackupID)
+	if err != nil {
+		return err
+	}
+
+	return o.waitForVolumeAvailable(ctx, opts, volume.Id)
+}
+
+// restoredBootVolumeSource restores the boot volume backup named by
+// RESTORE_FROM_BACKUP, which may belong to another machine, for a new
+// instance to launch from
+func (o *Oracle) restoredBootVolumeSource(ctx context.Context, opts *options.Options) (core.InstanceSourceDetails, error) {
+	backup, err := o.blockstorageClient.GetBootVolumeBackup(ctx, core.GetBootVolumeBackupRequest{
+		BootVolumeBackupId: &opts.RestoreFromBackup,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get boot volume backup")
+	}
+	if backup.LifecycleState != core.BootVolumeBackupLifecycleStateAvailable {
+		return nil, ErrBackupNotAvailable(opts.RestoreFromBackup, string(backup.LifecycleState))
+	}
+
+	token, err := launchRetryToken(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bootVolume, err := o.restoreBootVolume(ctx, opts, opts.RestoreFromBackup, opts.AvailabilityDomain, retryToken(token, "restore"))
+	if err != nil {
+		return nil, err
+	}
+
+	return core.InstanceSourceViaBootVolumeDetails{BootVolumeId: bootVolume.Id}, nil
+}
+
+// snapshotHomeBackupID returns the home volume backup taken in the same
+// snapshot as the RESTORE_FROM_BACKUP boot volume backup, or "" if the
+// snapshot has none
+func (o *Oracle) snapshotHomeBackupID(ctx context.Context, opts *options.Options) (string, error) {
+	backup, err := o.blockstorageClient.GetBootVolumeBackup(ctx, core.GetBootVolumeBackupRequest{
+		BootVolumeBackupId: &opts.RestoreFromBackup,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "get boot volume backup")
+	}
+
+	machineID := backup.FreeformTags[labelMachineID]
+	name := backup.FreeformTags[labelSnapshot]
+	if !isSnapshotBackup(backup.FreeformTags, machineID) {
+		return "", nil
+	}
+
+	source := *opts
+	source.MachineID = machineID
+	snapshot, err := o.findSnapshot(ctx, &source, name)
+	if err != nil {
+		return "", err
+	}
+
+	return snapshot.HomeVolumeBackupID, nil
+}
+
+// findSnapshot returns the machine's snapshot with the name
+func (o *Oracle) findSnapshot(ctx context.Context, opts *options.Options, name string) (*Snapshot, error) {
+	snapshots, err := o.ListSnapshots(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return &snapshots[i], nil
+		}
+	}
+
+	return nil, ErrSnapshotNotFound(name)
+}
+
+// machineBootVolumeID returns the boot volume of the instance, or of the
+// parked machine if it has no instance
+func (o *Oracle) machineBootVolumeID(ctx context.Context, opts *options.Options) (string, error) {
+	instance, err := o.GetInstance(ctx, opts)
+	if err == nil {
+		return o.getBootVolumeID(ctx, instance)
+	}
+	if !IsNotFound(err) {
+		return "", err
+	}
+
+	if parked := parkedState(opts); parked != nil {
+		return parked.BootVolumeID, nil
+	}
+
+	return "", err
+}
+
+func (o *Oracle) waitForSnapshot(ctx context.Context, opts *options.Options, snapshot *Snapshot) error {
+	err := o.waitForAvailable(ctx, opts, "boot volume backup", func(ctx context.Context) (string, error) {
+		response, err := o.blockstorageClient.GetBootVolumeBackup(ctx, core.GetBootVolumeBackupRequest{
+			BootVolumeBackupId: &snapshot.BootVolumeBackupID,
+		})
+		return string(response.LifecycleState), err
+	})
+	if err != nil || snapshot.HomeVolumeBackupID == "" {
+		return err
+	}
+
+	return o.waitForAvailable(ctx, opts, "home volume backup", func(ctx context.Context) (string, error) {
+		response, err := o.blockstorageClient.GetVolumeBackup(ctx, core.GetVolumeBackupRequest{
+			VolumeBackupId: &snapshot.HomeVolumeBackupID,
+		})
+		return string(response.LifecycleState), err
+	})
+}
+
+func isSnapshotBackup(tags map[string]string, machineID string) bool {
+	return tags[labelMachineID] == machineID && tags[labelType] == labelTypeDevPod && tags[labelSnapshot] != ""
+}
+
+func snapshotTags(machineID, name, volume string) map[string]string {
+	tags := map[string]string{
+		labelMachineID: machineID,
+		labelType:      labelTypeDevPod,
+		labelSnapshot:  name,
+	}
+	if volume != "" {
+		tags[labelVolume] = volume
+	}
+	return tags
+}
+
+func snapshotBackupName(machineID, name, volume string) string {
+	return fmt.Sprintf("%s-%s-%s", instanceName(machineID), name, volume)
+}
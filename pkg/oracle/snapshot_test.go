@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+
+	snapshot, err := m.CreateSnapshot(ctx, m.opts, "before-upgrade")
+	assert.NoError(err)
+	assert.Equal("boot-volume-id", *m.blockstorage.bootBackups[0].BootVolumeId)
+	assert.Equal("home-volume-id", *m.blockstorage.volumeBackups[0].VolumeId)
+
+	_, err = m.CreateSnapshot(ctx, m.opts, "before-upgrade")
+	assert.EqualError(err, "snapshot before-upgrade already exists")
+
+	snapshots, err := m.ListSnapshots(ctx, m.opts)
+	assert.NoError(err)
+	assert.Equal([]Snapshot{*snapshot}, snapshots)
+	assert.Equal("AVAILABLE", snapshots[0].State)
+
+	assert.NoError(m.RestoreSnapshot(ctx, m.opts, "before-upgrade"))
+
+	// The boot volume was restored and the old one deleted
+	restored := m.blockstorage.bootVolumes[1]
+	assert.Equal(core.BootVolumeSourceFromBootVolumeBackupDetails{Id: &snapshot.BootVolumeBackupID}, restored.SourceDetails)
+	assert.Equal(core.BootVolumeLifecycleStateTerminated, m.blockstorage.bootVolumes[0].LifecycleState)
+	source := m.compute.launches[0].SourceDetails.(core.InstanceSourceViaBootVolumeDetails)
+	assert.Equal(*restored.Id, *source.BootVolumeId)
+
+	// So was the home volume, which is attached to the new instance
+	assert.Equal(core.VolumeLifecycleStateTerminated, m.blockstorage.volumes[0].LifecycleState)
+	assert.Equal(core.VolumeSourceFromVolumeBackupDetails{Id: &snapshot.HomeVolumeBackupID}, m.blockstorage.volumes[1].SourceDetails)
+	attached := m.compute.volumeAttachments[0].(core.ParavirtualizedVolumeAttachment)
+	assert.Equal(*m.blockstorage.volumes[1].Id, *attached.VolumeId)
+
+	assert.NoError(m.DeleteSnapshot(ctx, m.opts, "before-upgrade"))
+	snapshots, err = m.ListSnapshots(ctx, m.opts)
+	assert.NoError(err)
+	assert.Empty(snapshots)
+
+	assert.EqualError(m.RestoreSnapshot(ctx, m.opts, "before-upgrade"),
+		"snapshot before-upgrade not found - run snapshot list to see the snapshots of this workspace")
+}
+
+func TestSnapshotNameReused(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+
+	_, err := m.CreateSnapshot(ctx, m.opts, "nightly")
+	assert.NoError(err)
+	assert.NoError(m.DeleteSnapshot(ctx, m.opts, "nightly"))
+
+	// The retry token replays the deleted backup, which must not be reused
+	snapshot, err := m.CreateSnapshot(ctx, m.opts, "nightly")
+	assert.NoError(err)
+	assert.Equal("boot-backup-1", snapshot.BootVolumeBackupID)
+
+	snapshots, err := m.ListSnapshots(ctx, m.opts)
+	assert.NoError(err)
+	assert.Equal([]Snapshot{*snapshot}, snapshots)
+}
+
+func TestRestoreFromBackup(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ctx := context.Background()
+
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.park(t)
+
+	snapshot, err := m.CreateSnapshot(ctx, m.opts, "golden")
+	assert.NoError(err)
+
+	// A new machine launched from the snapshot of another one
+	opts := *m.opts
+	opts.MachineID = "other-machine-id"
+	opts.MachineFolder = t.TempDir()
+	opts.RestoreFromBackup = snapshot.BootVolumeBackupID
+
+	request, err := m.BuildInstanceOptions(ctx, &opts, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMYMPf45N2zLPaI4SOxE4QJH/f4jhaLt7bSk75RVoIOA")
+	assert.NoError(err)
+
+	restored := m.blockstorage.bootVolumes[len(m.blockstorage.bootVolumes)-1]
+	assert.Equal(core.InstanceSourceViaBootVolumeDetails{BootVolumeId: restored.Id}, request.SourceDetails)
+	assert.Equal("other-machine-id", restored.FreeformTags[labelMachineID])
+
+	volume, err := m.createHomeVolume(ctx, &opts)
+	assert.NoError(err)
+	assert.Equal(core.VolumeSourceFromVolumeBackupDetails{Id: &snapshot.HomeVolumeBackupID}, volume.SourceDetails)
+	assert.Equal(homeVolumeName("other-machine-id"), *volume.DisplayName)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/pkg/errors"
+)
+
+// RunCommand runs a command on the instance over SSH as the devpod user,
+// authenticating with the key generated for the machine on create
+func (o *Oracle) RunCommand(ctx context.Context, opts *options.Options, command string, stdout, stderr io.Writer) error {
+	return o.runCommand(ctx, opts, command, nil, stdout, stderr)
+}
+
+// runCommand is RunCommand with the command reading stdin
+func (o *Oracle) runCommand(ctx context.Context, opts *options.Options, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	ip, err := o.GetInstanceIP(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "get instance IP")
+	}
+
+	privateKey, err := os.ReadFile(filepath.Join(opts.MachineFolder, sshKeyDir, sshPrivateKeyFile))
+	if err != nil {
+		return errors.Wrap(err, "read private key")
+	}
+
+	client, err := ssh.NewSSHClient(sshUser, net.JoinHostPort(ip, "22"), privateKey)
+	if err != nil {
+		return errors.Wrap(err, "connect")
+	}
+	defer client.Close()
+
+	return ssh.Run(ctx, client, command, stdin, stdout, stderr, nil)
+}
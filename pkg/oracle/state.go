@@ -0,0 +1,149 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oracle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/loft-sh/log"
+)
+
+// ProviderVersion is recorded in the machine state. It is set by the CLI.
+var ProviderVersion = "dev"
+
+// machineState records the cloud resources that belong to a machine so that
+// commands can address them directly instead of searching by name and tag.
+// Everything in it is a hint - it is verified before use and rewritten when
+// it turns out to be stale.
+type machineState struct {
+	InstanceID      string `json:"instanceId"`
+	VnicID          string `json:"vnicId,omitempty"`
+	SubnetID        string `json:"subnetId,omitempty"`
+	BootVolumeID    string `json:"bootVolumeId,omitempty"`
+	IP              string `json:"ip,omitempty"`
+	Region          string `json:"region,omitempty"`
+	CompartmentID   string `json:"compartmentId,omitempty"`
+	ProviderVersion string `json:"providerVersion,omitempty"`
+
+	// LaunchNonce makes the launch retry token unique to this machine folder
+	LaunchNonce string `json:"launchNonce,omitempty"`
+
+	// Parked is set while the instance is terminated by a stop in terminate
+	// mode. It is the only record of the boot volume to start from.
+	Parked *parkedInstance `json:"parked,omitempty"`
+
+	// Preempted is set when the parked instance was terminated by OCI to
+	// reclaim preemptible capacity rather than by a stop
+	Preempted bool `json:"preempted,omitempty"`
+
+	// RestoredObject is the backup object that was restored into the home,
+	// so that a retried create does not restore it again
+	RestoredObject string `json:"restoredObject,omitempty"`
+}
+
+// parkedInstance holds what is needed to launch a parked instance again
+type parkedInstance struct {
+	BootVolumeID       string            `json:"bootVolumeId"`
+	AvailabilityDomain string            `json:"availabilityDomain"`
+	Shape              string            `json:"shape"`
+	Ocpus              *float32          `json:"ocpus,omitempty"`
+	MemoryInGBs        *float32          `json:"memoryInGBs,omitempty"`
+	SubnetID           string            `json:"subnetId"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// loadState returns the machine state, or nil if there is no usable state
+func loadState(machineFolder string) *machineState {
+	if machineFolder == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(machineFolder, stateFile))
+	if err != nil {
+		return nil
+	}
+
+	var state machineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Default.Warnf("Ignoring unreadable machine state: %v", err)
+		return nil
+	}
+
+	return &state
+}
+
+// saveState writes the machine state atomically so that a concurrent reader
+// never sees a partial file
+func saveState(machineFolder string, state *machineState) error {
+	if machineFolder == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(machineFolder, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(machineFolder, stateFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(machineFolder, stateFile))
+}
+
+// forgetInstance drops a stale instance from the machine state. What
+// outlives the instance is kept: the launch nonce, the parked boot volume and
+// the restored backup. The state is removed if there is none of these.
+func forgetInstance(machineFolder string, state *machineState) {
+	kept := &machineState{
+		LaunchNonce:    state.LaunchNonce,
+		Parked:         state.Parked,
+		Preempted:      state.Preempted,
+		RestoredObject: state.RestoredObject,
+	}
+	if *kept == (machineState{}) {
+		removeState(machineFolder)
+		return
+	}
+	if err := saveState(machineFolder, kept); err != nil {
+		log.Default.Warnf("Unable to save machine state: %v", err)
+	}
+}
+
+func removeState(machineFolder string) {
+	if machineFolder == "" {
+		return
+	}
+
+	_ = os.Remove(filepath.Join(machineFolder, stateFile))
+}
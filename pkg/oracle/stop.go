@@ -0,0 +1,127 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"errors"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/sirupsen/logrus"
+)
+
+// StopInstance shuts the instance down gracefully. The optional pre-stop
+// command runs first, then the instance is sent an ACPI shutdown (SOFTSTOP).
+// If it is still up once the grace period is over, it is stopped hard. With
+// NoWait only the wait for the forced stop is skipped, as the guest may
+// ignore the ACPI shutdown. In terminate mode the stopped instance is then
+// terminated, keeping only its boot volume.
+func (o *Oracle) StopInstance(ctx context.Context, opts *options.Options) error {
+	instance, err := o.GetInstance(ctx, opts)
+	if err != nil {
+		if IsNotFound(err) && parkedState(opts) != nil {
+			return nil
+		}
+		return err
+	}
+
+	if opts.StopMode == options.StopModeTerminate {
+		return o.parkInstance(ctx, opts, instance)
+	}
+
+	return o.shutdown(ctx, opts, instance)
+}
+
+func (o *Oracle) shutdown(ctx context.Context, opts *options.Options, instance *core.Instance) error {
+	switch instance.LifecycleState {
+	case core.InstanceLifecycleStateStopped:
+		return nil
+	case core.InstanceLifecycleStateStopping:
+		// Already on its way down
+	default:
+		if instance.LifecycleState == core.InstanceLifecycleStateRunning && opts.PreStopCommand != "" {
+			o.runPreStopCommand(ctx, opts)
+		}
+
+		action := core.InstanceActionActionSoftstop
+		if opts.StopGracePeriod == 0 {
+			action = core.InstanceActionActionStop
+		}
+
+		if err := o.instanceAction(ctx, instance.Id, action); err != nil {
+			return err
+		}
+
+		if action == core.InstanceActionActionSoftstop {
+			return o.escalateStop(ctx, opts, instance.Id)
+		}
+	}
+
+	if opts.NoWait {
+		return nil
+	}
+
+	return o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateStopped, opts.WaitTimeout)
+}
+
+// escalateStop waits out the grace period after a SOFTSTOP and forces the
+// stop if the guest has not shut itself down by then
+func (o *Oracle) escalateStop(ctx context.Context, opts *options.Options, instanceID *string) error {
+	err := o.waitForInstanceState(ctx, instanceID, core.InstanceLifecycleStateStopped, opts.StopGracePeriod)
+	if !errors.Is(err, errWaitTimeout) {
+		return err
+	}
+
+	log.Default.Warnf("Instance did not shut down within %s, forcing it to stop", opts.StopGracePeriod)
+
+	if err := o.instanceAction(ctx, instanceID, core.InstanceActionActionStop); err != nil {
+		return err
+	}
+
+	if opts.NoWait {
+		return nil
+	}
+
+	return o.waitForInstanceState(ctx, instanceID, core.InstanceLifecycleStateStopped, opts.WaitTimeout)
+}
+
+// runPreStopCommand gives the workload a chance to shut down cleanly. A
+// failure is logged rather than returned so that it cannot block the stop.
+func (o *Oracle) runPreStopCommand(ctx context.Context, opts *options.Options) {
+	ctx, cancel := context.WithTimeout(ctx, preStopCommandTimeout)
+	defer cancel()
+
+	log.Default.Infof("Running pre-stop command: %s", opts.PreStopCommand)
+
+	writer := log.Default.Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	if err := o.RunCommand(ctx, opts, opts.PreStopCommand, writer, writer); err != nil {
+		log.Default.Warnf("Pre-stop command failed, stopping anyway: %v", err)
+	}
+}
+
+func (o *Oracle) instanceAction(ctx context.Context, instanceID *string, action core.InstanceActionActionEnum) error {
+	log.Default.Infof("Sending %s to instance", action)
+
+	_, err := o.computeClient.InstanceAction(ctx, core.InstanceActionRequest{
+		InstanceId: instanceID,
+		Action:     action,
+	})
+	return err
+}
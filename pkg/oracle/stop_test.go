@@ -0,0 +1,100 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopInstance(t *testing.T) {
+	machineID := "test-machine-id"
+
+	tests := []struct {
+		Name           string
+		State          core.InstanceLifecycleStateEnum
+		GracePeriod    time.Duration
+		IgnoreSoftstop bool
+		NoWait         bool
+		Expected       []core.InstanceActionActionEnum
+	}{
+		{
+			Name:        "graceful",
+			State:       core.InstanceLifecycleStateRunning,
+			GracePeriod: time.Minute,
+			Expected:    []core.InstanceActionActionEnum{core.InstanceActionActionSoftstop},
+		},
+		{
+			Name:           "forced after grace period",
+			State:          core.InstanceLifecycleStateRunning,
+			GracePeriod:    10 * time.Millisecond,
+			IgnoreSoftstop: true,
+			Expected:       []core.InstanceActionActionEnum{core.InstanceActionActionSoftstop, core.InstanceActionActionStop},
+		},
+		{
+			Name:     "no grace period",
+			State:    core.InstanceLifecycleStateRunning,
+			Expected: []core.InstanceActionActionEnum{core.InstanceActionActionStop},
+		},
+		{
+			Name:           "no wait still forced after grace period",
+			State:          core.InstanceLifecycleStateRunning,
+			GracePeriod:    10 * time.Millisecond,
+			IgnoreSoftstop: true,
+			NoWait:         true,
+			Expected:       []core.InstanceActionActionEnum{core.InstanceActionActionSoftstop, core.InstanceActionActionStop},
+		},
+		{
+			Name:  "already stopped",
+			State: core.InstanceLifecycleStateStopped,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{
+				instances: []core.Instance{
+					{
+						Id:             common.String("instance-id"),
+						DisplayName:    common.String(instanceName(machineID)),
+						LifecycleState: test.State,
+						FreeformTags:   map[string]string{labelMachineID: machineID},
+					},
+				},
+				ignoreSoftstop: test.IgnoreSoftstop,
+			}
+			o := &Oracle{computeClient: compute}
+
+			err := o.StopInstance(context.Background(), &options.Options{
+				MachineID:       machineID,
+				CompartmentID:   "compartment-id",
+				StopGracePeriod: test.GracePeriod,
+				NoWait:          test.NoWait,
+			})
+
+			assert.NoError(err)
+			assert.Equal(test.Expected, compute.actions)
+		})
+	}
+}
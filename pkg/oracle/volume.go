@@ -0,0 +1,331 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/pkg/errors"
+)
+
+// AttachVolumes attaches the machine's home and Docker data volumes to the
+// instance, creating those that do not exist yet
+func (o *Oracle) AttachVolumes(ctx context.Context, opts *options.Options, instance *core.Instance) error {
+	if err := o.AttachHomeVolume(ctx, opts, instance); err != nil {
+		return err
+	}
+
+	if opts.DockerData != options.DockerDataBlock {
+		return nil
+	}
+
+	return o.attachVolume(ctx, opts, instance, labelVolumeDocker, dockerVolumeDevice, func() (*core.Volume, error) {
+		return o.createVolume(ctx, opts, labelVolumeDocker, opts.DockerDataSize)
+	})
+}
+
+// AttachHomeVolume attaches the machine's home volume to the instance,
+// creating the volume first if this is the machine's first instance. The
+// volume outlives the instance, so an instance launched again for the same
+// machine picks up the existing home directory.
+func (o *Oracle) AttachHomeVolume(ctx context.Context, opts *options.Options, instance *core.Instance) error {
+	if opts.HomeVolumeSize == 0 {
+		return nil
+	}
+
+	return o.attachVolume(ctx, opts, instance, labelVolumeHome, homeVolumeDevice, func() (*core.Volume, error) {
+		return o.createHomeVolume(ctx, opts)
+	})
+}
+
+// attachVolume attaches the machine's volume with the label at the device,
+// creating it if the machine has none
+func (o *Oracle) attachVolume(
+	ctx context.Context, opts *options.Options, instance *core.Instance, label, device string, create func() (*core.Volume, error),
+) error {
+	volume, err := o.machineVolume(ctx, opts, label)
+	if err != nil {
+		return err
+	}
+
+	if volume == nil {
+		volume, err = create()
+		if err != nil {
+			return errors.Wrapf(err, "create %s volume", label)
+		}
+	} else {
+		log.Default.Infof("Reusing %s volume %s (%d GB)", label, *volume.Id, *volume.SizeInGBs)
+	}
+
+	if *volume.AvailabilityDomain != *instance.AvailabilityDomain {
+		return ErrVolumeInOtherAvailabilityDomain(*volume.Id, *volume.AvailabilityDomain)
+	}
+
+	if err := o.waitForVolumeAvailable(ctx, opts, volume.Id); err != nil {
+		return err
+	}
+
+	// Volumes can only be attached to a running or stopped instance
+	if instance.LifecycleState != core.InstanceLifecycleStateRunning && instance.LifecycleState != core.InstanceLifecycleStateStopped {
+		err := o.waitForInstanceState(ctx, instance.Id, core.InstanceLifecycleStateRunning, opts.WaitTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	attached, err := o.isVolumeAttached(ctx, instance, volume.Id)
+	if err != nil || attached {
+		return err
+	}
+
+	log.Default.Infof("Attaching %s volume %s", label, *volume.Id)
+
+	_, err = o.computeClient.AttachVolume(ctx, core.AttachVolumeRequest{
+		AttachVolumeDetails: core.AttachParavirtualizedVolumeDetails{
+			InstanceId:                     instance.Id,
+			VolumeId:                       volume.Id,
+			Device:                         common.String(device),
+			DisplayName:                    volume.DisplayName,
+			IsPvEncryptionInTransitEnabled: common.Bool(opts.PvEncryptionInTransit),
+		},
+	})
+	return err
+}
+
+func (o *Oracle) createHomeVolume(ctx context.Context, opts *options.Options) (*core.Volume, error) {
+	if opts.RestoreFromBackup != "" {
+		backupID, err := o.snapshotHomeBackupID(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if backupID != "" {
+			return o.createHomeVolumeFromBackup(ctx, opts, backupID)
+		}
+	}
+
+	return o.createVolume(ctx, opts, labelVolumeHome, opts.HomeVolumeSize)
+}
+
+func (o *Oracle) createVolume(ctx context.Context, opts *options.Options, label string, size int) (*core.Volume, error) {
+	log.Default.Infof("Creating a %d GB %s volume", size, label)
+
+	token, err := launchRetryToken(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := o.blockstorageClient.CreateVolume(ctx, core.CreateVolumeRequest{
+		CreateVolumeDetails: volumeDetails(opts, label, size),
+		OpcRetryToken:       common.String(retryToken(token, label)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.Volume, nil
+}
+
+// createHomeVolumeFromBackup creates the home volume from a volume backup,
+// at the size of the backup
+func (o *Oracle) createHomeVolumeFromBackup(ctx context.Context, opts *options.Options, backupID string) (*core.Volume, error) {
+	log.Default.Infof("Restoring home volume from backup %s", backupID)
+
+	token, err := launchRetryToken(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	details := volumeDetails(opts, labelVolumeHome, opts.HomeVolumeSize)
+	details.SizeInGBs = nil
+	details.SourceDetails = core.VolumeSourceFromVolumeBackupDetails{Id: &backupID}
+
+	// The same backup can be restored again after the volume is deleted
+	volume, err := createWithRetryToken(retryToken(token, labelVolumeHome, backupID), func(token *string) (core.Volume, error) {
+		response, err := o.blockstorageClient.CreateVolume(ctx, core.CreateVolumeRequest{
+			CreateVolumeDetails: details,
+			OpcRetryToken:       token,
+		})
+		return response.Volume, err
+	}, func(v core.Volume) bool { return isTerminal(string(v.LifecycleState)) })
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+func volumeDetails(opts *options.Options, label string, size int) core.CreateVolumeDetails {
+	return core.CreateVolumeDetails{
+		CompartmentId:      &opts.CompartmentID,
+		AvailabilityDomain: &opts.AvailabilityDomain,
+		DisplayName:        common.String(volumeName(opts.MachineID, label)),
+		SizeInGBs:          common.Int64(int64(size)),
+		KmsKeyId:           optionalString(opts.KMSKeyID),
+		FreeformTags: map[string]string{
+			labelMachineID: opts.MachineID,
+			labelType:      labelTypeDevPod,
+			labelVolume:    label,
+		},
+	}
+}
+
+// homeVolume returns the machine's home volume, or nil if it has none
+func (o *Oracle) homeVolume(ctx context.Context, opts *options.Options) (*core.Volume, error) {
+	return o.machineVolume(ctx, opts, labelVolumeHome)
+}
+
+// machineVolume returns the machine's volume with the label, or nil if it has
+// none
+func (o *Oracle) machineVolume(ctx context.Context, opts *options.Options, label string) (*core.Volume, error) {
+	name := volumeName(opts.MachineID, label)
+
+	volumes, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.Volume, *string, error) {
+		response, err := o.blockstorageClient.ListVolumes(ctx, core.ListVolumesRequest{
+			CompartmentId: &opts.CompartmentID,
+			DisplayName:   &name,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []core.Volume
+	for _, v := range volumes {
+		if v.FreeformTags[labelMachineID] == opts.MachineID && !isTerminal(string(v.LifecycleState)) {
+			matches = append(matches, v)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, ErrMultipleVolumesFound(name)
+	}
+}
+
+func (o *Oracle) isVolumeAttached(ctx context.Context, instance *core.Instance, volumeID *string) (bool, error) {
+	attachments, err := listAll(ctx, func(ctx context.Context, page *string) ([]core.VolumeAttachment, *string, error) {
+		response, err := o.computeClient.ListVolumeAttachments(ctx, core.ListVolumeAttachmentsRequest{
+			CompartmentId: instance.CompartmentId,
+			InstanceId:    instance.Id,
+			VolumeId:      volumeID,
+			Page:          page,
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, a := range attachments {
+		state := a.GetLifecycleState()
+		if state == core.VolumeAttachmentLifecycleStateAttaching || state == core.VolumeAttachmentLifecycleStateAttached {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (o *Oracle) waitForVolumeAvailable(ctx context.Context, opts *options.Options, volumeID *string) error {
+	if opts.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.WaitTimeout)
+		defer cancel()
+	}
+
+	for {
+		response, err := o.blockstorageClient.GetVolume(ctx, core.GetVolumeRequest{VolumeId: volumeID})
+		if err != nil {
+			return err
+		}
+
+		switch response.LifecycleState {
+		case core.VolumeLifecycleStateAvailable:
+			return nil
+		case core.VolumeLifecycleStateProvisioning, core.VolumeLifecycleStateRestoring:
+			log.Default.Debugf("Volume is %s", response.LifecycleState)
+		default:
+			return fmt.Errorf("volume %s is %s", *volumeID, response.LifecycleState)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(deletePollInterval):
+		}
+	}
+}
+
+// deleteVolumes removes the home and Docker data volumes once the instance
+// has released them. They are removed even if HOME_VOLUME_SIZE or
+// DOCKER_DATA have changed since they were created, as nothing else would
+// ever remove them.
+func (o *Oracle) deleteVolumes(ctx context.Context, opts *options.Options) error {
+	if err := o.deleteVolume(ctx, opts, labelVolumeHome); err != nil {
+		return err
+	}
+
+	return o.deleteVolume(ctx, opts, labelVolumeDocker)
+}
+
+// hasVolumes reports whether the machine has a home or Docker data volume
+// left to delete
+func (o *Oracle) hasVolumes(ctx context.Context, opts *options.Options) (bool, error) {
+	for _, label := range []string{labelVolumeHome, labelVolumeDocker} {
+		volume, err := o.machineVolume(ctx, opts, label)
+		if err != nil || volume != nil {
+			return volume != nil, err
+		}
+	}
+
+	return false, nil
+}
+
+func (o *Oracle) deleteVolume(ctx context.Context, opts *options.Options, label string) error {
+	volume, err := o.machineVolume(ctx, opts, label)
+	if err != nil || volume == nil {
+		return err
+	}
+
+	log.Default.Infof("Deleting %s volume %s", label, *volume.Id)
+
+	_, err = o.blockstorageClient.DeleteVolume(ctx, core.DeleteVolumeRequest{VolumeId: volume.Id})
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrapf(err, "delete %s volume", label)
+	}
+
+	return nil
+}
+
+func homeVolumeName(machineID string) string {
+	return volumeName(machineID, labelVolumeHome)
+}
+
+func volumeName(machineID, label string) string {
+	return fmt.Sprintf("%s-%s", instanceName(machineID), label)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 DevPod Oracle Provider Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oracle
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/haroondilshad/devpod-provider-oracle-cloud/pkg/options"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAttachHomeVolume(t *testing.T) {
+	machineID := "test-machine-id"
+
+	volume := func(id, availabilityDomain string) core.Volume {
+		return core.Volume{
+			Id:                 common.String(id),
+			AvailabilityDomain: common.String(availabilityDomain),
+			DisplayName:        common.String(homeVolumeName(machineID)),
+			SizeInGBs:          common.Int64(50),
+			LifecycleState:     core.VolumeLifecycleStateAvailable,
+			FreeformTags:       map[string]string{labelMachineID: machineID},
+		}
+	}
+
+	tests := []struct {
+		Name        string
+		Volumes     []core.Volume
+		Attachments []core.VolumeAttachment
+		Created     bool
+		Attached    bool
+		Error       error
+	}{
+		{
+			Name:     "first instance creates the volume",
+			Created:  true,
+			Attached: true,
+		},
+		{
+			Name:     "re-created instance reuses the volume",
+			Volumes:  []core.Volume{volume("existing", "AD-1")},
+			Attached: true,
+		},
+		{
+			Name:    "already attached",
+			Volumes: []core.Volume{volume("existing", "AD-1")},
+			Attachments: []core.VolumeAttachment{
+				core.ParavirtualizedVolumeAttachment{
+					InstanceId:     common.String("instance-id"),
+					VolumeId:       common.String("existing"),
+					LifecycleState: core.VolumeAttachmentLifecycleStateAttached,
+				},
+			},
+		},
+		{
+			Name: "deleted volume is ignored",
+			Volumes: []core.Volume{func() core.Volume {
+				v := volume("deleted", "AD-1")
+				v.LifecycleState = core.VolumeLifecycleStateTerminated
+				return v
+			}()},
+			Created:  true,
+			Attached: true,
+		},
+		{
+			Name:    "other availability domain",
+			Volumes: []core.Volume{volume("existing", "AD-2")},
+			Error:   ErrVolumeInOtherAvailabilityDomain("existing", "AD-2"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			compute := &fakeCompute{volumeAttachments: test.Attachments}
+			blockstorage := &fakeBlockstorage{volumes: test.Volumes}
+			o := &Oracle{computeClient: compute, blockstorageClient: blockstorage}
+
+			err := o.AttachHomeVolume(context.Background(), &options.Options{
+				MachineID:          machineID,
+				MachineFolder:      t.TempDir(),
+				CompartmentID:      "compartment-id",
+				AvailabilityDomain: "AD-1",
+				HomeVolumeSize:     50,
+			}, &core.Instance{
+				Id:                 common.String("instance-id"),
+				CompartmentId:      common.String("compartment-id"),
+				AvailabilityDomain: common.String("AD-1"),
+				LifecycleState:     core.InstanceLifecycleStateRunning,
+			})
+
+			if test.Error == nil {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, test.Error.Error())
+			}
+			assert.Equal(test.Created, blockstorage.calls["CreateVolume"] == 1)
+			assert.Equal(test.Attached, compute.calls["AttachVolume"] == 1)
+		})
+	}
+}
+
+func TestDeleteHomeVolumeUnset(t *testing.T) {
+	m := newFakeMachine(t, core.InstanceLifecycleStateRunning)
+	m.opts.HomeVolumeSize = 0
+
+	// The volume goes with the machine, even if HOME_VOLUME_SIZE changed
+	assert.NoError(t, m.DeleteInstance(context.Background(), m.opts, false))
+	assert.Equal(t, core.VolumeLifecycleStateTerminated, m.blockstorage.volumes[0].LifecycleState)
+}
+
+func TestGenerateCloudConfigHomeVolume(t *testing.T) {
+	assert := assert.New(t)
+	o := &Oracle{}
+
+	for _, size := range []int{0, 50} {
+		config, err := o.generateCloudConfig("ssh-ed25519 AAAA", &options.Options{HomeVolumeSize: size}, false, "")
+		assert.NoError(err)
+
+		var parsed map[string]interface{}
+		assert.NoError(yaml.Unmarshal([]byte(config), &parsed))
+		assert.Equal(size > 0, strings.Contains(config, homeVolumeDevice))
+	}
+}